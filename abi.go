@@ -0,0 +1,252 @@
+package merkletree
+
+import (
+	"errors"
+	"math/big"
+)
+
+// abiWordLen is the byte length of a word of the Solidity ABI encoding.
+const abiWordLen = 32
+
+// ErrInvalidABIEncoding is used when ABI encoded data can't be decoded.
+var ErrInvalidABIEncoding = errors.New("invalid ABI encoding")
+
+// ABIEncode returns the Solidity ABI encoding of the CircomVerifierProof, as
+// the arguments (without function selector) of a verifier function with
+// signature:
+//
+//	(uint256 root, uint256[] siblings, uint256 oldKey, uint256 oldValue,
+//	 bool isOld0, uint256 key, uint256 value, uint256 fnc)
+func (p *CircomVerifierProof) ABIEncode() []byte {
+	var e abiEncoder
+	e.hash(p.Root)
+	e.siblings(p.Siblings)
+	e.hash(p.OldKey)
+	e.hash(p.OldValue)
+	e.bool(p.IsOld0)
+	e.hash(p.Key)
+	e.hash(p.Value)
+	e.int(p.Fnc)
+	return e.bytes()
+}
+
+// NewCircomVerifierProofFromABI decodes a CircomVerifierProof from its
+// Solidity ABI encoding, as returned by CircomVerifierProof.ABIEncode.
+func NewCircomVerifierProofFromABI(b []byte) (*CircomVerifierProof, error) {
+	d := abiDecoder{data: b, headLen: 8 * abiWordLen}
+	var p CircomVerifierProof
+	p.Root = d.hash()
+	p.Siblings = d.siblings()
+	p.OldKey = d.hash()
+	p.OldValue = d.hash()
+	p.IsOld0 = d.bool()
+	p.Key = d.hash()
+	p.Value = d.hash()
+	p.Fnc = d.int()
+	if err := d.finish(); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// ABIEncode returns the Solidity ABI encoding of the CircomProcessorProof, as
+// the arguments (without function selector) of a processor function with
+// signature:
+//
+//	(uint256 oldRoot, uint256 newRoot, uint256[] siblings, uint256 oldKey,
+//	 uint256 oldValue, uint256 newKey, uint256 newValue, bool isOld0,
+//	 uint256 fnc)
+func (p *CircomProcessorProof) ABIEncode() []byte {
+	var e abiEncoder
+	e.hash(p.OldRoot)
+	e.hash(p.NewRoot)
+	e.siblings(p.Siblings)
+	e.hash(p.OldKey)
+	e.hash(p.OldValue)
+	e.hash(p.NewKey)
+	e.hash(p.NewValue)
+	e.bool(p.IsOld0)
+	e.int(p.Fnc)
+	return e.bytes()
+}
+
+// NewCircomProcessorProofFromABI decodes a CircomProcessorProof from its
+// Solidity ABI encoding, as returned by CircomProcessorProof.ABIEncode.
+func NewCircomProcessorProofFromABI(b []byte) (*CircomProcessorProof, error) {
+	d := abiDecoder{data: b, headLen: 9 * abiWordLen}
+	var p CircomProcessorProof
+	p.OldRoot = d.hash()
+	p.NewRoot = d.hash()
+	p.Siblings = d.siblings()
+	p.OldKey = d.hash()
+	p.OldValue = d.hash()
+	p.NewKey = d.hash()
+	p.NewValue = d.hash()
+	p.IsOld0 = d.bool()
+	p.Fnc = d.int()
+	if err := d.finish(); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// abiEncoder encodes a tuple of static values and uint256 arrays. The head
+// words are written in order, and the arrays are appended to the tail once
+// the head is complete.
+type abiEncoder struct {
+	head [][abiWordLen]byte
+	// tails contains the words of each array, indexed by the position of
+	// its offset word in the head
+	tails map[int][][abiWordLen]byte
+}
+
+func (e *abiEncoder) hash(h *Hash) {
+	if h == nil {
+		h = &HashZero
+	}
+	var w [abiWordLen]byte
+	// Hash is little endian, ABI words are big endian
+	copy(w[:], SwapEndianness(h[:]))
+	e.head = append(e.head, w)
+}
+
+func (e *abiEncoder) int(v int) {
+	var w [abiWordLen]byte
+	big.NewInt(int64(v)).FillBytes(w[:])
+	e.head = append(e.head, w)
+}
+
+func (e *abiEncoder) bool(v bool) {
+	if v {
+		e.int(1)
+	} else {
+		e.int(0)
+	}
+}
+
+func (e *abiEncoder) siblings(siblings []*Hash) {
+	var a abiEncoder
+	a.int(len(siblings))
+	for _, s := range siblings {
+		a.hash(s)
+	}
+	if e.tails == nil {
+		e.tails = make(map[int][][abiWordLen]byte)
+	}
+	e.tails[len(e.head)] = a.head
+	// placeholder for the offset, set in bytes()
+	e.head = append(e.head, [abiWordLen]byte{})
+}
+
+func (e *abiEncoder) bytes() []byte {
+	words := append([][abiWordLen]byte{}, e.head...)
+	for i := range e.head {
+		tail, ok := e.tails[i]
+		if !ok {
+			continue
+		}
+		big.NewInt(int64(len(words) * abiWordLen)).FillBytes(words[i][:])
+		words = append(words, tail...)
+	}
+	b := make([]byte, 0, len(words)*abiWordLen)
+	for _, w := range words {
+		b = append(b, w[:]...)
+	}
+	return b
+}
+
+// abiDecoder decodes a tuple encoded by abiEncoder. The first error found is
+// kept and returned by finish, so the values can be decoded without checking
+// the error of each one.
+type abiDecoder struct {
+	data    []byte
+	headLen int
+	pos     int
+	err     error
+}
+
+// word returns the word at the given byte offset as a *big.Int
+func (d *abiDecoder) word(offset int) *big.Int {
+	if d.err != nil {
+		return big.NewInt(0)
+	}
+	if offset < 0 || offset+abiWordLen > len(d.data) {
+		d.err = ErrInvalidABIEncoding
+		return big.NewInt(0)
+	}
+	return new(big.Int).SetBytes(d.data[offset : offset+abiWordLen])
+}
+
+func (d *abiDecoder) next() *big.Int {
+	w := d.word(d.pos)
+	d.pos += abiWordLen
+	return w
+}
+
+func (d *abiDecoder) toHash(w *big.Int) *Hash {
+	h, err := NewHashFromBigInt(w)
+	if err != nil {
+		if d.err == nil {
+			d.err = ErrInvalidABIEncoding
+		}
+		return &HashZero
+	}
+	return h
+}
+
+func (d *abiDecoder) hash() *Hash {
+	return d.toHash(d.next())
+}
+
+func (d *abiDecoder) int() int {
+	w := d.next()
+	if w.BitLen() > 31 {
+		if d.err == nil {
+			d.err = ErrInvalidABIEncoding
+		}
+		return 0
+	}
+	return int(w.Int64())
+}
+
+func (d *abiDecoder) bool() bool {
+	w := d.next()
+	if w.Cmp(big.NewInt(1)) > 0 {
+		if d.err == nil {
+			d.err = ErrInvalidABIEncoding
+		}
+		return false
+	}
+	return w.Sign() == 1
+}
+
+func (d *abiDecoder) siblings() []*Hash {
+	offsetW := d.next()
+	if d.err != nil {
+		return nil
+	}
+	if !offsetW.IsInt64() || offsetW.Int64() < int64(d.headLen) ||
+		offsetW.Int64() > int64(len(d.data)) {
+		d.err = ErrInvalidABIEncoding
+		return nil
+	}
+	offset := int(offsetW.Int64())
+	lenW := d.word(offset)
+	if d.err != nil {
+		return nil
+	}
+	if !lenW.IsInt64() ||
+		lenW.Int64() > int64((len(d.data)-offset)/abiWordLen) {
+		d.err = ErrInvalidABIEncoding
+		return nil
+	}
+	siblings := make([]*Hash, lenW.Int64())
+	for i := range siblings {
+		siblings[i] = d.toHash(d.word(offset + (i+1)*abiWordLen))
+	}
+	return siblings
+}
+
+func (d *abiDecoder) finish() error {
+	return d.err
+}
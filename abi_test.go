@@ -0,0 +1,103 @@
+package merkletree_test
+
+import (
+	"context"
+	"encoding/hex"
+	"math/big"
+	"testing"
+
+	"github.com/iden3/go-merkletree-sql/v2"
+	"github.com/iden3/go-merkletree-sql/v2/db/memory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCircomVerifierProof_ABIEncode(t *testing.T) {
+	ctx := context.Background()
+	mt, err := merkletree.NewMerkleTree(ctx, memory.NewMemoryStorage(), 4)
+	require.NoError(t, err)
+	for i := int64(1); i <= 4; i++ {
+		require.NoError(t, mt.Add(ctx, big.NewInt(i), big.NewInt(i*11)))
+	}
+
+	cvp, err := mt.GenerateSCVerifierProof(ctx, big.NewInt(2), nil)
+	require.NoError(t, err)
+
+	expected := "" +
+		"1df9a6c242f8655d9d0bc819504c0de4cee13f4275a53ee48130f9e232fb2d64" +
+		"0000000000000000000000000000000000000000000000000000000000000100" +
+		"0000000000000000000000000000000000000000000000000000000000000000" +
+		"0000000000000000000000000000000000000000000000000000000000000000" +
+		"0000000000000000000000000000000000000000000000000000000000000000" +
+		"0000000000000000000000000000000000000000000000000000000000000002" +
+		"0000000000000000000000000000000000000000000000000000000000000016" +
+		"0000000000000000000000000000000000000000000000000000000000000000" +
+		"0000000000000000000000000000000000000000000000000000000000000002" +
+		"19b0c2c381d291ee65dd9a8a971147b07721680d6288ef3691de8ea590812106" +
+		"0b6775ee97e66a55c38a88a0b2996d0ddc5f22b401e337f666735fd650a3c29c"
+	b := cvp.ABIEncode()
+	assert.Equal(t, expected, hex.EncodeToString(b))
+
+	cvp2, err := merkletree.NewCircomVerifierProofFromABI(b)
+	require.NoError(t, err)
+	assert.Equal(t, cvp, cvp2)
+
+	// non-existence proof with empty siblings
+	cvp, err = mt.GenerateSCVerifierProof(ctx, big.NewInt(8), nil)
+	require.NoError(t, err)
+	cvp2, err = merkletree.NewCircomVerifierProofFromABI(cvp.ABIEncode())
+	require.NoError(t, err)
+	assert.Equal(t, cvp, cvp2)
+}
+
+func TestCircomProcessorProof_ABIEncode(t *testing.T) {
+	ctx := context.Background()
+	mt, err := merkletree.NewMerkleTree(ctx, memory.NewMemoryStorage(), 10)
+	require.NoError(t, err)
+	for i := int64(0); i < 16; i++ {
+		require.NoError(t, mt.Add(ctx, big.NewInt(i), big.NewInt(i*2)))
+	}
+	cpp, err := mt.Update(ctx, big.NewInt(10), big.NewInt(1024))
+	require.NoError(t, err)
+
+	b := cpp.ABIEncode()
+	require.Len(t, b, (9+1+len(cpp.Siblings))*32)
+	// offset of the siblings array
+	assert.Equal(t, big.NewInt(9*32), new(big.Int).SetBytes(b[64:96]))
+
+	cpp2, err := merkletree.NewCircomProcessorProofFromABI(b)
+	require.NoError(t, err)
+	assert.Equal(t, cpp, cpp2)
+}
+
+func TestABIDecodeErrors(t *testing.T) {
+	ctx := context.Background()
+	mt, err := merkletree.NewMerkleTree(ctx, memory.NewMemoryStorage(), 4)
+	require.NoError(t, err)
+	require.NoError(t, mt.Add(ctx, big.NewInt(1), big.NewInt(11)))
+	require.NoError(t, mt.Add(ctx, big.NewInt(2), big.NewInt(22)))
+	cvp, err := mt.GenerateSCVerifierProof(ctx, big.NewInt(2), nil)
+	require.NoError(t, err)
+	b := cvp.ABIEncode()
+
+	_, err = merkletree.NewCircomVerifierProofFromABI(b[:len(b)-1])
+	assert.Equal(t, merkletree.ErrInvalidABIEncoding, err)
+
+	// isOld0 is not a bool
+	invalid := append([]byte{}, b...)
+	invalid[5*32-1] = 2
+	_, err = merkletree.NewCircomVerifierProofFromABI(invalid)
+	assert.Equal(t, merkletree.ErrInvalidABIEncoding, err)
+
+	// root outside of the finite field
+	invalid = append([]byte{}, b...)
+	invalid[0] = 0xff
+	_, err = merkletree.NewCircomVerifierProofFromABI(invalid)
+	assert.Equal(t, merkletree.ErrInvalidABIEncoding, err)
+
+	// offset of the siblings inside the head
+	invalid = append([]byte{}, b...)
+	invalid[2*32-1] = 0x20
+	_, err = merkletree.NewCircomVerifierProofFromABI(invalid)
+	assert.Equal(t, merkletree.ErrInvalidABIEncoding, err)
+}
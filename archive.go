@@ -0,0 +1,320 @@
+package merkletree
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// The archive format written by ExportArchive is:
+//
+//	header: magic (8 bytes) | version (1 byte) | hasher name length (1 byte) |
+//	        hasher name | current root (32 bytes)
+//	roots:  archiveFrameRoot (1 byte) | root (32 bytes)
+//	nodes:  archiveFrameNode (1 byte) | key (32 bytes) | Node.Value (65 bytes)
+//	end:    archiveFrameEnd (1 byte) | number of roots (8 bytes) |
+//	        number of nodes (8 bytes) | sha256 of all the previous bytes
+//
+// All the integers are big endian.
+const (
+	archiveVersion1  = 1
+	archiveFrameEnd  = 0x00
+	archiveFrameNode = 0x01
+	archiveFrameRoot = 0x02
+	// archiveNodeLen is the length of the Value of the stored nodes, which
+	// are always middle nodes or leafs
+	archiveNodeLen = 1 + 2*ElemBytesLen
+)
+
+var archiveMagic = []byte("\x89MTARCH\n")
+
+var (
+	// ErrInvalidArchive is used when an archive can't be decoded.
+	ErrInvalidArchive = errors.New("invalid archive")
+	// ErrNodeListingNotSupported is used when all the nodes of a Storage are
+	// needed, and it doesn't implement NodeLister.
+	ErrNodeListingNotSupported = errors.New("the storage can't list its nodes")
+	// ErrRootListingNotSupported is used when the root history of a Storage
+	// is needed, and it doesn't implement RootLister.
+	ErrRootListingNotSupported = errors.New("the storage can't list its roots")
+)
+
+// ExportArchive writes to w an archive with all the nodes reachable from the
+// given roots, which form the root history of the archive, and the current
+// Root of the MerkleTree. Unlike a leaf dump, the archive keeps the nodes of
+// the old roots, so they can still be used with Snapshot once imported with
+// ImportArchive. If no roots are given, all the nodes of the Storage are
+// exported, which requires the Storage to implement NodeLister, and the root
+// history is the one kept by the Storage if it implements RootLister, like
+// the storages in db/memory and db/file. Otherwise, the root history only
+// contains the current Root, and the roots of the history must be given to
+// keep them.
+func (mt *MerkleTree) ExportArchive(ctx context.Context, w io.Writer,
+	roots []*Hash) error {
+	name := mt.hasher.Name()
+	if len(name) > 0xff {
+		return fmt.Errorf("hasher name too long: %v", name)
+	}
+	current := mt.Root()
+	lister, canList := mt.db.(NodeLister)
+	all := len(roots) == 0
+	if all {
+		if !canList {
+			return ErrNodeListingNotSupported
+		}
+		var err error
+		roots, err = mt.rootHistory(ctx)
+		if err != nil {
+			return err
+		}
+	}
+
+	bw := bufio.NewWriter(w)
+	sum := sha256.New()
+	aw := io.MultiWriter(bw, sum)
+	header := append([]byte{}, archiveMagic...)
+	header = append(header, archiveVersion1, byte(len(name)))
+	header = append(header, name...)
+	header = append(header, current[:]...)
+	if _, err := aw.Write(header); err != nil {
+		return err
+	}
+	for _, root := range roots {
+		frame := append([]byte{archiveFrameRoot}, root[:]...)
+		if _, err := aw.Write(frame); err != nil {
+			return err
+		}
+	}
+
+	var nodes uint64
+	writeNode := func(key []byte, n *Node) error {
+		if n.Type != NodeTypeMiddle && n.Type != NodeTypeLeaf {
+			return ErrInvalidNodeFound
+		}
+		frame := append([]byte{archiveFrameNode}, key...)
+		frame = append(frame, n.Value()...)
+		if _, err := aw.Write(frame); err != nil {
+			return err
+		}
+		nodes++
+		return nil
+	}
+	var err error
+	if all {
+		err = lister.ListNodes(ctx, writeNode)
+	} else {
+		err = mt.exportReachableNodes(ctx, roots, writeNode)
+	}
+	if err != nil {
+		return err
+	}
+
+	end := make([]byte, 1+8+8)
+	end[0] = archiveFrameEnd
+	binary.BigEndian.PutUint64(end[1:], uint64(len(roots)))
+	binary.BigEndian.PutUint64(end[9:], nodes)
+	if _, err := aw.Write(end); err != nil {
+		return err
+	}
+	if _, err := bw.Write(sum.Sum(nil)); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// ListRoots calls f for each root of the history kept by the Storage, oldest
+// first, and stops at the first error returned by f. If the Storage doesn't
+// implement RootLister, ErrRootListingNotSupported is returned.
+func (mt *MerkleTree) ListRoots(ctx context.Context,
+	f func(root *Hash) error) error {
+	rl, ok := mt.db.(RootLister)
+	if !ok {
+		return ErrRootListingNotSupported
+	}
+	return rl.ListRoots(ctx, f)
+}
+
+// rootHistory returns the roots of the Storage if it implements RootLister,
+// ending with the current Root of the MerkleTree.
+func (mt *MerkleTree) rootHistory(ctx context.Context) ([]*Hash, error) {
+	var roots []*Hash
+	err := mt.ListRoots(ctx, func(root *Hash) error {
+		r := *root
+		roots = append(roots, &r)
+		return nil
+	})
+	if err != nil && !errors.Is(err, ErrRootListingNotSupported) {
+		return nil, err
+	}
+	current := mt.Root()
+	if len(roots) == 0 || !roots[len(roots)-1].Equals(current) {
+		roots = append(roots, current)
+	}
+	return roots, nil
+}
+
+// exportReachableNodes calls f for each node reachable from the roots. The
+// nodes shared by several roots are only exported once.
+func (mt *MerkleTree) exportReachableNodes(ctx context.Context, roots []*Hash,
+	f func(key []byte, n *Node) error) error {
+	exported := make(map[Hash]struct{})
+	for _, root := range roots {
+		err := mt.WalkNodes(ctx, root,
+			func(n *Node, _ int, _ []bool) (WalkAction, error) {
+				if n.Type == NodeTypeEmpty {
+					return WalkContinue, nil
+				}
+				k, err := n.KeyWithHasher(mt.hasher)
+				if err != nil {
+					return WalkStop, err
+				}
+				if _, ok := exported[*k]; ok {
+					return WalkSkipChildren, nil
+				}
+				exported[*k] = struct{}{}
+				return WalkContinue, f(k[:], n)
+			})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ImportArchive reads an archive written by ExportArchive, stores all its
+// nodes in the given Storage, and sets the current root of the archive as the
+// root of the Storage. The key of each node is verified with the Hasher of the
+// archive, which must be registered. It returns the root history of the
+// archive, which can be used with Snapshot. The roots of the history are set
+// in order before the current root, so a Storage that implements RootLister
+// keeps the history. If the Storage implements HasherStorage, the name of the
+// Hasher of the archive is stored, and ErrHasherMismatch is returned if the
+// Storage already has a different one.
+func ImportArchive(ctx context.Context, r io.Reader,
+	storage Storage) ([]*Hash, error) {
+	d := &dumpReader{r: bufio.NewReader(r), sum: sha256.New(),
+		invalid: ErrInvalidArchive}
+	if !bytes.Equal(d.read(len(archiveMagic)), archiveMagic) {
+		if d.err != nil {
+			return nil, d.err
+		}
+		return nil, ErrInvalidArchive
+	}
+	if v := d.read(1); d.err == nil && v[0] != archiveVersion1 {
+		return nil, fmt.Errorf("%w: unsupported version %d",
+			ErrInvalidArchive, v[0])
+	}
+	nameLen := d.read(1)
+	if d.err != nil {
+		return nil, d.err
+	}
+	name := d.read(int(nameLen[0]))
+	var current Hash
+	copy(current[:], d.read(len(Hash{})))
+	if d.err != nil {
+		return nil, d.err
+	}
+	hasher, err := HasherByName(string(name))
+	if err != nil {
+		return nil, err
+	}
+	storedName, err := storedHasherName(ctx, storage)
+	if err != nil {
+		return nil, err
+	}
+	if storedName != "" {
+		if err := checkHasherName(storedName, hasher.Name()); err != nil {
+			return nil, err
+		}
+	}
+
+	var roots []*Hash
+	var nodes uint64
+	for done := false; !done; {
+		tag := d.read(1)
+		if d.err != nil {
+			return nil, d.err
+		}
+		switch tag[0] {
+		case archiveFrameEnd:
+			done = true
+		case archiveFrameRoot:
+			var root Hash
+			copy(root[:], d.read(len(Hash{})))
+			roots = append(roots, &root)
+		case archiveFrameNode:
+			key := d.read(len(Hash{}))
+			value := d.read(archiveNodeLen)
+			if d.err != nil {
+				return nil, d.err
+			}
+			if err := importArchiveNode(ctx, storage, hasher, key,
+				value); err != nil {
+				return nil, err
+			}
+			nodes++
+		default:
+			return nil, fmt.Errorf("%w: unknown frame %#x", ErrInvalidArchive,
+				tag[0])
+		}
+	}
+	counts := d.read(16)
+	if d.err != nil {
+		return nil, d.err
+	}
+	expectedSum := d.sum.Sum(nil)
+	sum := d.read(sha256.Size)
+	if d.err != nil {
+		return nil, d.err
+	}
+	if !bytes.Equal(sum, expectedSum) {
+		return nil, fmt.Errorf("%w: checksum mismatch", ErrInvalidArchive)
+	}
+	if binary.BigEndian.Uint64(counts) != uint64(len(roots)) ||
+		binary.BigEndian.Uint64(counts[8:]) != nodes {
+		return nil, fmt.Errorf("%w: count mismatch", ErrInvalidArchive)
+	}
+
+	for _, root := range append(roots, &current) {
+		if root.Equals(&HashZero) {
+			continue
+		}
+		if _, err := storage.Get(ctx, root[:]); err != nil {
+			return nil, fmt.Errorf("%w: root %v: %v", ErrInvalidArchive,
+				root.Hex(), err)
+		}
+	}
+	if storedName == "" {
+		if err := storeHasherName(ctx, storage, hasher.Name()); err != nil {
+			return nil, err
+		}
+	}
+	for _, root := range roots {
+		if err := storage.SetRoot(ctx, root); err != nil {
+			return nil, err
+		}
+	}
+	return roots, storage.SetRoot(ctx, &current)
+}
+
+// importArchiveNode verifies the key of a node of an archive and stores it.
+func importArchiveNode(ctx context.Context, storage Storage, hasher Hasher,
+	key, value []byte) error {
+	n, err := NewNodeFromBytes(value)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidArchive, err)
+	}
+	k, err := n.KeyWithHasher(hasher)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(k[:], key) {
+		return fmt.Errorf("%w: key mismatch of node %x", ErrInvalidArchive, key)
+	}
+	return storage.Put(ctx, key, n)
+}
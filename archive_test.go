@@ -0,0 +1,181 @@
+package merkletree_test
+
+import (
+	"bytes"
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/iden3/go-merkletree-sql/v2"
+	"github.com/iden3/go-merkletree-sql/v2/db/memory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// addTestRoots adds 30 leafs to the MerkleTree and deletes one of them, and
+// returns its roots after each group of modifications.
+func addTestRoots(t *testing.T, mt *merkletree.MerkleTree) []*merkletree.Hash {
+	var roots []*merkletree.Hash
+	for i := 0; i < 30; i += 10 {
+		addTestLeafs(t, mt, i, i+10)
+		roots = append(roots, mt.Root())
+	}
+	require.NoError(t, mt.Delete(context.Background(), big.NewInt(5)))
+	return append(roots, mt.Root())
+}
+
+func TestArchiveRoots(t *testing.T) {
+	ctx := context.Background()
+	mt := newTestTree(t, memory.NewMemoryStorage(), 40, 0)
+	roots := addTestRoots(t, mt)
+
+	var buf bytes.Buffer
+	require.NoError(t, mt.ExportArchive(ctx, &buf, roots))
+
+	storage := memory.NewMemoryStorage()
+	imported, err := merkletree.ImportArchive(ctx, &buf, storage)
+	require.NoError(t, err)
+	assert.Equal(t, roots, imported)
+
+	mt2, err := merkletree.OpenReadOnly(ctx, storage, 40)
+	require.NoError(t, err)
+	assert.Equal(t, mt.Root(), mt2.Root())
+	report, err := mt2.Check(ctx, nil)
+	require.NoError(t, err)
+	assert.True(t, report.OK())
+
+	// the old roots can be used with Snapshot
+	snapshot, err := mt2.Snapshot(ctx, roots[0])
+	require.NoError(t, err)
+	_, v, _, err := snapshot.Get(ctx, big.NewInt(5))
+	require.NoError(t, err)
+	assert.Equal(t, "10", v.String())
+	proof, _, err := snapshot.GenerateProof(ctx, big.NewInt(5), nil)
+	require.NoError(t, err)
+	assert.True(t, merkletree.VerifyProof(roots[0], proof, big.NewInt(5),
+		big.NewInt(10)))
+	_, _, _, err = snapshot.Get(ctx, big.NewInt(15))
+	assert.ErrorIs(t, err, merkletree.ErrKeyNotFound)
+}
+
+func TestArchiveAllNodes(t *testing.T) {
+	ctx := context.Background()
+	src := memory.NewMemoryStorage()
+	mt := newTestTree(t, src, 40, 0)
+	roots := addTestRoots(t, mt)
+
+	var buf bytes.Buffer
+	require.NoError(t, mt.ExportArchive(ctx, &buf, nil))
+
+	dst := memory.NewMemoryStorage()
+	imported, err := merkletree.ImportArchive(ctx,
+		bytes.NewReader(buf.Bytes()), dst)
+	require.NoError(t, err)
+	// the root history of the storage is kept
+	history := listRoots(t, src)
+	assert.Equal(t, history, imported)
+	assert.Equal(t, history, listRoots(t, dst))
+	assert.Equal(t, mt.Root(), imported[len(imported)-1])
+
+	// all the nodes were copied
+	var srcKeys, dstKeys [][]byte
+	require.NoError(t, src.ListNodes(ctx,
+		func(key []byte, _ *merkletree.Node) error {
+			srcKeys = append(srcKeys, key)
+			return nil
+		}))
+	require.NoError(t, dst.ListNodes(ctx,
+		func(key []byte, _ *merkletree.Node) error {
+			dstKeys = append(dstKeys, key)
+			return nil
+		}))
+	assert.Equal(t, srcKeys, dstKeys)
+
+	mt2, err := merkletree.OpenReadOnly(ctx, dst, 40)
+	require.NoError(t, err)
+	for _, root := range roots {
+		_, err := mt2.Snapshot(ctx, root)
+		require.NoError(t, err)
+	}
+
+	// corrupted archive
+	b := buf.Bytes()
+	b[len(b)-40] ^= 1
+	_, err = merkletree.ImportArchive(ctx, bytes.NewReader(b),
+		memory.NewMemoryStorage())
+	assert.ErrorIs(t, err, merkletree.ErrInvalidArchive)
+}
+
+// listRoots returns the root history of a Storage
+func listRoots(t *testing.T, rl merkletree.RootLister) []*merkletree.Hash {
+	var roots []*merkletree.Hash
+	err := rl.ListRoots(context.Background(), func(root *merkletree.Hash) error {
+		roots = append(roots, root)
+		return nil
+	})
+	require.NoError(t, err)
+	return roots
+}
+
+func TestArchiveWithoutRootHistory(t *testing.T) {
+	ctx := context.Background()
+	storage := memory.NewMemoryStorage()
+	mt := newTestTree(t, nodeListerStorage{storage, storage}, 40, 0)
+	roots := addTestRoots(t, mt)
+
+	// without RootLister, only the current root is kept, unless the roots
+	// of the history are given
+	var buf bytes.Buffer
+	require.NoError(t, mt.ExportArchive(ctx, &buf, nil))
+	imported, err := merkletree.ImportArchive(ctx, &buf,
+		memory.NewMemoryStorage())
+	require.NoError(t, err)
+	assert.Equal(t, []*merkletree.Hash{mt.Root()}, imported)
+
+	buf.Reset()
+	require.NoError(t, mt.ExportArchive(ctx, &buf, roots))
+	imported, err = merkletree.ImportArchive(ctx, &buf,
+		memory.NewMemoryStorage())
+	require.NoError(t, err)
+	assert.Equal(t, roots, imported)
+}
+
+// nodeListerStorage hides the optional interfaces of a Storage but NodeLister
+type nodeListerStorage struct {
+	merkletree.Storage
+	merkletree.NodeLister
+}
+
+func TestArchiveNodeListingNotSupported(t *testing.T) {
+	ctx := context.Background()
+	mt := newTestTree(t, walkOnlyStorage{memory.NewMemoryStorage()}, 40, 30)
+	err := mt.ExportArchive(ctx, &bytes.Buffer{}, nil)
+	assert.ErrorIs(t, err, merkletree.ErrNodeListingNotSupported)
+}
+
+func TestArchiveHasher(t *testing.T) {
+	ctx := context.Background()
+	mt := newTestTree(t, memory.NewMemoryStorage(), 40, 10,
+		merkletree.WithHasher(merkletree.Keccak256Hasher{}))
+	var buf bytes.Buffer
+	require.NoError(t, mt.ExportArchive(ctx, &buf, nil))
+	archive := buf.Bytes()
+
+	// the hasher of the archive is stored, so the tree is reopened with it
+	storage := memory.NewMemoryStorage()
+	_, err := merkletree.ImportArchive(ctx, bytes.NewReader(archive), storage)
+	require.NoError(t, err)
+	mt2, err := merkletree.NewMerkleTree(ctx, storage, 40)
+	require.NoError(t, err)
+	assert.Equal(t, "keccak256", mt2.Hasher().Name())
+	require.NoError(t, mt2.Add(ctx, big.NewInt(10), big.NewInt(10)))
+	require.NoError(t, mt.Add(ctx, big.NewInt(10), big.NewInt(10)))
+	assert.Equal(t, mt.Root(), mt2.Root())
+
+	// a storage with another hasher is rejected
+	storage = memory.NewMemoryStorage()
+	_, err = merkletree.NewMerkleTree(ctx, storage, 40)
+	require.NoError(t, err)
+	_, err = merkletree.ImportArchive(ctx, bytes.NewReader(archive), storage)
+	assert.ErrorIs(t, err, merkletree.ErrHasherMismatch)
+}
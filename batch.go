@@ -0,0 +1,201 @@
+package merkletree
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// ErrBatchTooLarge is used when a batch has more operations than the fixed
+// batch size of the circuit.
+var ErrBatchTooLarge = errors.New("the batch has more operations than the batch size")
+
+// BatchOperation is a single operation of a batch processed by ProcessBatch.
+// Value is ignored for FncDelete and FncNOP operations.
+type BatchOperation struct {
+	Fnc   int
+	Key   *big.Int
+	Value *big.Int
+}
+
+// BatchWitness is the state transition witness of a batch of operations, as
+// needed by circuits that process a fixed number of SMTProcessor updates per
+// proof.
+type BatchWitness struct {
+	// Roots contains the sequence of roots of the batch, where Roots[0] is
+	// the root before the batch and Roots[i+1] the root after Proofs[i].
+	Roots []*Hash
+	// Proofs contains a CircomProcessorProof for each operation of the
+	// batch, padded with NOPs up to the batch size.
+	Proofs []*CircomProcessorProof
+}
+
+// ProcessBatch applies the operations to the MerkleTree in order, and returns
+// the BatchWitness of the state transition. If batchSize is greater than 0,
+// the witness is padded with NOPs up to batchSize operations.
+//
+// The operations are validated before modifying the MerkleTree, so an invalid
+// fnc, a key or value outside the finite field, an insert of an existing key,
+// or an update or delete of a missing key fail without applying any operation.
+// Operations are not reverted if one of them fails later on (for example with
+// ErrReachedMaxLevel or a storage error): the MerkleTree will contain the
+// operations applied before the failing one, and the BatchWitness of those
+// operations, without padding, is returned along with the error.
+//
+// With the HookErrorReturn policy, the errors of the hooks don't stop the
+// batch, as the operations are applied anyway: the whole batch is processed,
+// and the BatchWitness is returned along with the first *HookError.
+func (mt *MerkleTree) ProcessBatch(ctx context.Context, ops []BatchOperation,
+	batchSize int) (*BatchWitness, error) {
+	if !mt.writable {
+		return nil, ErrNotWritable
+	}
+	if batchSize > 0 && len(ops) > batchSize {
+		return nil, ErrBatchTooLarge
+	}
+
+	if err := mt.validateBatch(ctx, ops); err != nil {
+		return nil, err
+	}
+
+	w := &BatchWitness{Roots: []*Hash{mt.Root()}}
+	var hookErr error
+	for i, op := range ops {
+		var cp *CircomProcessorProof
+		var err error
+		switch op.Fnc {
+		case FncNOP:
+			cp = mt.nopCircomProof()
+		case FncUpdate:
+			cp, err = mt.Update(ctx, op.Key, op.Value)
+		case FncInsert:
+			cp, err = mt.AddAndGetCircomProof(ctx, op.Key, op.Value)
+		case FncDelete:
+			cp, err = mt.DeleteAndGetCircomProof(ctx, op.Key)
+		default:
+			err = fmt.Errorf("invalid fnc %d", op.Fnc)
+		}
+		var he *HookError
+		if errors.As(err, &he) && cp != nil {
+			if hookErr == nil {
+				hookErr = fmt.Errorf("batch operation %d: %w", i, err)
+			}
+		} else if err != nil {
+			return w, fmt.Errorf("batch operation %d: %w", i, err)
+		}
+		w.Proofs = append(w.Proofs, cp)
+		w.Roots = append(w.Roots, cp.NewRoot)
+	}
+	for i := len(ops); i < batchSize; i++ {
+		w.Proofs = append(w.Proofs, mt.nopCircomProof())
+		w.Roots = append(w.Roots, mt.Root())
+	}
+	return w, hookErr
+}
+
+// validateBatch checks that the operations can be applied in order to the
+// MerkleTree, tracking the keys inserted and deleted by the previous operations
+// of the batch.
+func (mt *MerkleTree) validateBatch(ctx context.Context,
+	ops []BatchOperation) error {
+	exists := make(map[Hash]bool)
+	for i, op := range ops {
+		if op.Fnc == FncNOP {
+			continue
+		}
+		if op.Fnc != FncUpdate && op.Fnc != FncInsert && op.Fnc != FncDelete {
+			return fmt.Errorf("batch operation %d: invalid fnc %d", i, op.Fnc)
+		}
+		kHash, err := NewHashFromBigInt(op.Key)
+		if err != nil {
+			return fmt.Errorf("batch operation %d: %w", i, err)
+		}
+		if op.Fnc != FncDelete {
+			if _, err = NewHashFromBigInt(op.Value); err != nil {
+				return fmt.Errorf("batch operation %d: %w", i, err)
+			}
+		}
+		found, ok := exists[*kHash]
+		if !ok {
+			_, _, _, err = mt.Get(ctx, op.Key)
+			if err != nil && err != ErrKeyNotFound {
+				return fmt.Errorf("batch operation %d: %w", i, err)
+			}
+			found = err == nil
+		}
+		if op.Fnc == FncInsert && found {
+			return fmt.Errorf("batch operation %d: %w", i,
+				ErrEntryIndexAlreadyExists)
+		}
+		if op.Fnc != FncInsert && !found {
+			return fmt.Errorf("batch operation %d: %w", i, ErrKeyNotFound)
+		}
+		exists[*kHash] = op.Fnc != FncDelete
+	}
+	return nil
+}
+
+// nopCircomProof returns a CircomProcessorProof that does not modify the
+// current root.
+func (mt *MerkleTree) nopCircomProof() *CircomProcessorProof {
+	return &CircomProcessorProof{
+		OldRoot:  mt.Root(),
+		NewRoot:  mt.Root(),
+		Siblings: CircomSiblingsFromSiblings(nil, mt.maxLevels),
+		OldKey:   &HashZero,
+		OldValue: &HashZero,
+		NewKey:   &HashZero,
+		NewValue: &HashZero,
+		Fnc:      FncNOP,
+	}
+}
+
+// CircuitInputs returns the inputs of the batch as expected by a circuit with
+// an array of SMTProcessor templates, with all the values as decimal strings.
+func (w *BatchWitness) CircuitInputs() map[string]interface{} {
+	n := len(w.Proofs)
+	fnc := make([][2]string, n)
+	oldRoot := make([]string, n)
+	newRoot := make([]string, n)
+	siblings := make([][]string, n)
+	oldKey := make([]string, n)
+	oldValue := make([]string, n)
+	isOld0 := make([]string, n)
+	newKey := make([]string, n)
+	newValue := make([]string, n)
+	for i, p := range w.Proofs {
+		ps := make([]string, len(p.Siblings))
+		for j, s := range p.Siblings {
+			ps[j] = hashString(s)
+		}
+		in := newProcessorInput(p, ps)
+		fnc[i] = in.fnc
+		oldRoot[i] = in.oldRoot
+		newRoot[i] = in.newRoot
+		siblings[i] = in.siblings
+		oldKey[i] = in.oldKey
+		oldValue[i] = in.oldValue
+		isOld0[i] = in.isOld0
+		newKey[i] = in.newKey
+		newValue[i] = in.newValue
+	}
+	return map[string]interface{}{
+		"fnc":      fnc,
+		"oldRoot":  oldRoot,
+		"newRoot":  newRoot,
+		"siblings": siblings,
+		"oldKey":   oldKey,
+		"oldValue": oldValue,
+		"isOld0":   isOld0,
+		"newKey":   newKey,
+		"newValue": newValue,
+	}
+}
+
+// MarshalJSON implements json.Marshaler interface, encoding the BatchWitness
+// as the input JSON of the circuit.
+func (w BatchWitness) MarshalJSON() ([]byte, error) {
+	return json.Marshal(w.CircuitInputs())
+}
@@ -0,0 +1,199 @@
+package merkletree_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"reflect"
+	"testing"
+
+	"github.com/iden3/go-merkletree-sql/v2"
+	"github.com/iden3/go-merkletree-sql/v2/db/memory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProcessBatch(t *testing.T) {
+	ctx := context.Background()
+	mt, err := merkletree.NewMerkleTree(ctx, memory.NewMemoryStorage(), 10)
+	require.NoError(t, err)
+
+	ops := []merkletree.BatchOperation{
+		{Fnc: merkletree.FncInsert, Key: big.NewInt(1), Value: big.NewInt(2)},
+		{Fnc: merkletree.FncInsert, Key: big.NewInt(33), Value: big.NewInt(44)},
+		{Fnc: merkletree.FncUpdate, Key: big.NewInt(33), Value: big.NewInt(45)},
+		{Fnc: merkletree.FncNOP},
+		{Fnc: merkletree.FncDelete, Key: big.NewInt(33)},
+	}
+	w, err := mt.ProcessBatch(ctx, ops, 8)
+	require.NoError(t, err)
+	require.Len(t, w.Proofs, 8)
+	require.Len(t, w.Roots, 9)
+
+	assert.Equal(t, "0", w.Roots[0].String())
+	// test vectors generated using https://github.com/iden3/circomlib smt.js
+	assert.Equal(t,
+		"13578938674299138072471463694055224830892726234048532520316387704878000008795",
+		w.Roots[1].BigInt().String())
+	assert.Equal(t,
+		"5412393676474193513566895793055462193090331607895808993925969873307089394741",
+		w.Roots[2].BigInt().String())
+	assert.Equal(t, w.Roots[3], w.Roots[4])
+	assert.Equal(t, w.Roots[1], w.Roots[5])
+	for i, p := range w.Proofs {
+		assert.Equal(t, w.Roots[i], p.OldRoot)
+		assert.Equal(t, w.Roots[i+1], p.NewRoot)
+		assert.Len(t, p.Siblings, mt.MaxLevels()+1)
+	}
+	for _, p := range w.Proofs[5:] {
+		assert.Equal(t, merkletree.FncNOP, p.Fnc)
+		assert.Equal(t, mt.Root(), p.NewRoot)
+	}
+
+	del := w.Proofs[4]
+	assert.Equal(t, merkletree.FncDelete, del.Fnc)
+	assert.Equal(t, "33", del.NewKey.String())
+	assert.Equal(t, "45", del.NewValue.String())
+	assert.Equal(t, "1", del.OldKey.String())
+	assert.Equal(t, "2", del.OldValue.String())
+	assert.False(t, del.IsOld0)
+	assert.Equal(t, "[0 0 0 0 0 0 0 0 0 0 0]", fmt.Sprintf("%v", del.Siblings))
+
+	b, err := json.Marshal(w)
+	require.NoError(t, err)
+	var inputs map[string]interface{}
+	require.NoError(t, json.Unmarshal(b, &inputs))
+	assert.Equal(t, []interface{}{"1", "0"},
+		inputs["fnc"].([]interface{})[0])
+	assert.Equal(t, []interface{}{"1", "1"},
+		inputs["fnc"].([]interface{})[4])
+	assert.Equal(t, "45", inputs["newValue"].([]interface{})[2])
+	assert.Equal(t, "1", inputs["isOld0"].([]interface{})[0])
+	assert.Len(t, inputs["siblings"], 8)
+
+	// each proof is encoded like the input of a single SMTProcessor
+	batchInputs := w.CircuitInputs()
+	for i, p := range w.Proofs {
+		single, err := merkletree.SMTProcessorInputs(p, mt.MaxLevels()+1)
+		require.NoError(t, err)
+		for name, v := range single {
+			assert.Equal(t, v,
+				reflect.ValueOf(batchInputs[name]).Index(i).Interface(),
+				"%v of proof %d", name, i)
+		}
+	}
+}
+
+func TestDeleteAndGetCircomProofMixed(t *testing.T) {
+	ctx := context.Background()
+	mt, err := merkletree.NewMerkleTree(ctx, memory.NewMemoryStorage(), 10)
+	require.NoError(t, err)
+	require.NoError(t, mt.Add(ctx, big.NewInt(1), big.NewInt(2)))
+	require.NoError(t, mt.Add(ctx, big.NewInt(33), big.NewInt(44)))
+	require.NoError(t, mt.Add(ctx, big.NewInt(55), big.NewInt(66)))
+
+	// test vectors generated using https://github.com/iden3/circomlib smt.js
+	// the sibling of the deleted leaf is a middle node
+	cp, err := mt.DeleteAndGetCircomProof(ctx, big.NewInt(55))
+	require.NoError(t, err)
+	assert.Equal(t, "50943640...", cp.OldRoot.String())
+	assert.Equal(t,
+		"5412393676474193513566895793055462193090331607895808993925969873307089394741",
+		cp.NewRoot.BigInt().String())
+	assert.Equal(t, "55", cp.OldKey.String())
+	assert.Equal(t, "0", cp.OldValue.String())
+	assert.Equal(t, "55", cp.NewKey.String())
+	assert.Equal(t, "66", cp.NewValue.String())
+	assert.True(t, cp.IsOld0)
+	assert.Equal(t, "[0 21312042... 0 0 0 0 0 0 0 0 0]",
+		fmt.Sprintf("%v", cp.Siblings))
+
+	// the deleted leaf is the only one in the tree
+	mt, err = merkletree.NewMerkleTree(ctx, memory.NewMemoryStorage(), 10)
+	require.NoError(t, err)
+	require.NoError(t, mt.Add(ctx, big.NewInt(1), big.NewInt(2)))
+	cp, err = mt.DeleteAndGetCircomProof(ctx, big.NewInt(1))
+	require.NoError(t, err)
+	assert.Equal(t, "13578938...", cp.OldRoot.String())
+	assert.Equal(t, "0", cp.NewRoot.String())
+	assert.Equal(t, "1", cp.OldKey.String())
+	assert.Equal(t, "0", cp.OldValue.String())
+	assert.Equal(t, "1", cp.NewKey.String())
+	assert.Equal(t, "2", cp.NewValue.String())
+	assert.True(t, cp.IsOld0)
+	assert.Equal(t, "[0 0 0 0 0 0 0 0 0 0 0]", fmt.Sprintf("%v", cp.Siblings))
+}
+
+func TestProcessBatchErrors(t *testing.T) {
+	ctx := context.Background()
+	mt, err := merkletree.NewMerkleTree(ctx, memory.NewMemoryStorage(), 10)
+	require.NoError(t, err)
+
+	ops := []merkletree.BatchOperation{
+		{Fnc: merkletree.FncInsert, Key: big.NewInt(1), Value: big.NewInt(2)},
+		{Fnc: merkletree.FncInsert, Key: big.NewInt(2), Value: big.NewInt(3)},
+	}
+	_, err = mt.ProcessBatch(ctx, ops, 1)
+	assert.ErrorIs(t, err, merkletree.ErrBatchTooLarge)
+	assert.Equal(t, "0", mt.Root().String())
+
+	ops = []merkletree.BatchOperation{
+		{Fnc: merkletree.FncInsert, Key: big.NewInt(1), Value: big.NewInt(2)},
+		{Fnc: merkletree.FncDelete, Key: big.NewInt(5)},
+	}
+	_, err = mt.ProcessBatch(ctx, ops, 0)
+	assert.ErrorIs(t, err, merkletree.ErrKeyNotFound)
+	assert.Equal(t, "0", mt.Root().String())
+
+	// the batch is validated with the keys of the previous operations
+	ops = []merkletree.BatchOperation{
+		{Fnc: merkletree.FncInsert, Key: big.NewInt(1), Value: big.NewInt(2)},
+		{Fnc: merkletree.FncDelete, Key: big.NewInt(1)},
+		{Fnc: merkletree.FncUpdate, Key: big.NewInt(1), Value: big.NewInt(3)},
+	}
+	_, err = mt.ProcessBatch(ctx, ops, 0)
+	assert.ErrorIs(t, err, merkletree.ErrKeyNotFound)
+	assert.Equal(t, "0", mt.Root().String())
+
+	ops = []merkletree.BatchOperation{
+		{Fnc: merkletree.FncInsert, Key: big.NewInt(1), Value: big.NewInt(2)},
+		{Fnc: merkletree.FncInsert, Key: big.NewInt(1), Value: big.NewInt(3)},
+	}
+	_, err = mt.ProcessBatch(ctx, ops, 0)
+	assert.ErrorIs(t, err, merkletree.ErrEntryIndexAlreadyExists)
+	assert.Equal(t, "0", mt.Root().String())
+
+	ops = []merkletree.BatchOperation{
+		{Fnc: merkletree.FncInsert, Key: big.NewInt(1), Value: big.NewInt(2)},
+		{Fnc: 4},
+	}
+	_, err = mt.ProcessBatch(ctx, ops, 0)
+	assert.EqualError(t, err, "batch operation 1: invalid fnc 4")
+	assert.Equal(t, "0", mt.Root().String())
+}
+
+func TestProcessBatchPartial(t *testing.T) {
+	ctx := context.Background()
+	mt, err := merkletree.NewMerkleTree(ctx, memory.NewMemoryStorage(), 2)
+	require.NoError(t, err)
+
+	// keys 1 and 5 share the path of the first 2 levels, which can't be
+	// detected before applying the operations
+	ops := []merkletree.BatchOperation{
+		{Fnc: merkletree.FncInsert, Key: big.NewInt(2), Value: big.NewInt(3)},
+		{Fnc: merkletree.FncInsert, Key: big.NewInt(1), Value: big.NewInt(2)},
+		{Fnc: merkletree.FncInsert, Key: big.NewInt(5), Value: big.NewInt(6)},
+	}
+	w, err := mt.ProcessBatch(ctx, ops, 4)
+	require.ErrorIs(t, err, merkletree.ErrReachedMaxLevel)
+	assert.EqualError(t, err,
+		"batch operation 2: reached maximum level of the merkle tree")
+	require.NotNil(t, w)
+	require.Len(t, w.Proofs, 2)
+	require.Len(t, w.Roots, 3)
+	assert.Equal(t, mt.Root(), w.Roots[2])
+	n, err := mt.Count(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(2), n)
+}
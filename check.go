@@ -0,0 +1,174 @@
+package merkletree
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// CheckIssueKind is the kind of an integrity issue found by Check.
+type CheckIssueKind int
+
+const (
+	// CheckMissingRoot is a stored root that doesn't exist in the Storage.
+	CheckMissingRoot CheckIssueKind = iota + 1
+	// CheckMissingNode is a child of a middle node that doesn't exist in the
+	// Storage.
+	CheckMissingNode
+	// CheckKeyMismatch is a node whose key doesn't match the key under which
+	// it's stored.
+	CheckKeyMismatch
+	// CheckMisplacedLeaf is a leaf whose position contradicts the path of its
+	// key.
+	CheckMisplacedLeaf
+	// CheckEmptyMiddle is a middle node with two empty children.
+	CheckEmptyMiddle
+	// CheckTooDeep is a middle node at the maximum level of the tree.
+	CheckTooDeep
+	// CheckInvalidNode is a node of an invalid type.
+	CheckInvalidNode
+)
+
+// String returns the name of the CheckIssueKind
+func (k CheckIssueKind) String() string {
+	switch k {
+	case CheckMissingRoot:
+		return "missing root"
+	case CheckMissingNode:
+		return "missing node"
+	case CheckKeyMismatch:
+		return "key mismatch"
+	case CheckMisplacedLeaf:
+		return "misplaced leaf"
+	case CheckEmptyMiddle:
+		return "empty middle node"
+	case CheckTooDeep:
+		return "node too deep"
+	case CheckInvalidNode:
+		return "invalid node"
+	default:
+		return fmt.Sprintf("CheckIssueKind(%d)", int(k))
+	}
+}
+
+// CheckIssue is an integrity issue found by Check. Key is the storage key of
+// the node, and Path the bits of its path from the root.
+type CheckIssue struct {
+	Kind CheckIssueKind
+	Key  *Hash
+	Path []bool
+}
+
+// String returns a description of the CheckIssue
+func (i CheckIssue) String() string {
+	return fmt.Sprintf("%v at depth %d: %v", i.Kind, len(i.Path), i.Key.Hex())
+}
+
+// CheckReport is the result of Check.
+type CheckReport struct {
+	// Root is the checked root.
+	Root *Hash
+	// Nodes is the number of nodes checked.
+	Nodes int
+	// Issues contains all the issues found, in path order.
+	Issues []CheckIssue
+}
+
+// OK returns whether no issues were found.
+func (r *CheckReport) OK() bool {
+	return len(r.Issues) == 0
+}
+
+// Check verifies the integrity of the nodes of the MerkleTree under the given
+// rootKey. If rootKey is nil, the root stored in the Storage is checked. It
+// reads each node from the Storage, bypassing the node cache of the tree,
+// recomputes its key, and checks that the tree is consistent
+// with the paths of the keys of the leafs. All the issues found are returned
+// in the CheckReport; an error is only returned when the check can't go on,
+// for example if the Storage fails or the context is cancelled.
+func (mt *MerkleTree) Check(ctx context.Context,
+	rootKey *Hash) (*CheckReport, error) {
+	if rootKey == nil {
+		root, err := mt.db.GetRoot(ctx)
+		if errors.Is(err, ErrNotFound) {
+			root = &HashZero
+		} else if err != nil {
+			return nil, err
+		}
+		rootKey = root
+	}
+	report := &CheckReport{Root: rootKey}
+	addIssue := func(kind CheckIssueKind, key *Hash, path []bool) {
+		report.Issues = append(report.Issues,
+			CheckIssue{Kind: kind, Key: key, Path: path})
+	}
+
+	type checkItem struct {
+		key  *Hash
+		path []bool
+	}
+	stack := []checkItem{{key: rootKey, path: []bool{}}}
+	for len(stack) > 0 {
+		item := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if item.key.Equals(&HashZero) {
+			continue
+		}
+
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		// read the Storage directly, as the cached nodes may not match the
+		// stored ones
+		n, err := mt.db.Get(ctx, item.key[:])
+		if errors.Is(err, ErrNotFound) {
+			if len(item.path) == 0 {
+				addIssue(CheckMissingRoot, item.key, item.path)
+			} else {
+				addIssue(CheckMissingNode, item.key, item.path)
+			}
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		report.Nodes++
+
+		if n.Type != NodeTypeLeaf && n.Type != NodeTypeMiddle {
+			addIssue(CheckInvalidNode, item.key, item.path)
+			continue
+		}
+		// copy the node to recompute its key instead of using the cached one
+		fresh := Node{Type: n.Type, ChildL: n.ChildL, ChildR: n.ChildR,
+			Entry: n.Entry}
+		k, err := fresh.KeyWithHasher(mt.hasher)
+		if err != nil {
+			return nil, err
+		}
+		if !k.Equals(item.key) {
+			addIssue(CheckKeyMismatch, item.key, item.path)
+		}
+
+		if n.Type == NodeTypeLeaf {
+			for i, bit := range item.path {
+				if TestBit(n.Entry[0][:], uint(i)) != bit {
+					addIssue(CheckMisplacedLeaf, item.key, item.path)
+					break
+				}
+			}
+			continue
+		}
+		if n.ChildL.Equals(&HashZero) && n.ChildR.Equals(&HashZero) {
+			addIssue(CheckEmptyMiddle, item.key, item.path)
+			continue
+		}
+		if len(item.path) >= mt.maxLevels {
+			addIssue(CheckTooDeep, item.key, item.path)
+			continue
+		}
+		pathL := append(item.path[:len(item.path):len(item.path)], false)
+		pathR := append(item.path[:len(item.path):len(item.path)], true)
+		stack = append(stack, checkItem{key: n.ChildR, path: pathR},
+			checkItem{key: n.ChildL, path: pathL})
+	}
+	return report, nil
+}
@@ -0,0 +1,155 @@
+package merkletree_test
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/iden3/go-merkletree-sql/v2"
+	"github.com/iden3/go-merkletree-sql/v2/db/memory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func issueKinds(r *merkletree.CheckReport) []merkletree.CheckIssueKind {
+	var kinds []merkletree.CheckIssueKind
+	for _, i := range r.Issues {
+		kinds = append(kinds, i.Kind)
+	}
+	return kinds
+}
+
+func putNode(t *testing.T, s merkletree.Storage,
+	n *merkletree.Node) *merkletree.Hash {
+	k, err := n.Key()
+	require.NoError(t, err)
+	require.NoError(t, s.Put(context.Background(), k[:], n))
+	return k
+}
+
+func TestCheck(t *testing.T) {
+	ctx := context.Background()
+	storage := memory.NewMemoryStorage()
+	mt, err := merkletree.NewMerkleTree(ctx, storage, 40)
+	require.NoError(t, err)
+	for i := 0; i < 16; i++ {
+		err = mt.Add(ctx, big.NewInt(int64(i)), big.NewInt(int64(i)))
+		require.NoError(t, err)
+	}
+	report, err := mt.Check(ctx, nil)
+	require.NoError(t, err)
+	assert.True(t, report.OK())
+	assert.Equal(t, mt.Root(), report.Root)
+	assert.Equal(t, 31, report.Nodes)
+
+	// copy the tree without two leafs
+	_, _, siblings3, err := mt.Get(ctx, big.NewInt(3))
+	require.NoError(t, err)
+	dst := memory.NewMemoryStorage()
+	skipped := 0
+	err = mt.WalkNodes(ctx, nil, func(n *merkletree.Node, _ int,
+		_ []bool) (merkletree.WalkAction, error) {
+		if n.Type == merkletree.NodeTypeLeaf {
+			k := n.Entry[0].BigInt().Int64()
+			if k == 3 || k == 12 {
+				skipped++
+				return merkletree.WalkContinue, nil
+			}
+		}
+		putNode(t, dst, n)
+		return merkletree.WalkContinue, nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, 2, skipped)
+	require.NoError(t, dst.SetRoot(ctx, mt.Root()))
+
+	mtDst, err := merkletree.OpenReadOnly(ctx, dst, 40)
+	require.NoError(t, err)
+	report, err = mtDst.Check(ctx, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []merkletree.CheckIssueKind{
+		merkletree.CheckMissingNode, merkletree.CheckMissingNode},
+		issueKinds(report))
+	assert.Len(t, report.Issues[0].Path, len(siblings3))
+	assert.Equal(t, 29, report.Nodes)
+}
+
+func TestCheckInvalidNodes(t *testing.T) {
+	ctx := context.Background()
+	storage := memory.NewMemoryStorage()
+
+	// the leaf of key 1 is in the left subtree, but its path starts with 1
+	leaf1 := putNode(t, storage, merkletree.NewNodeLeaf(
+		&merkletree.Hash{1}, &merkletree.Hash{1}))
+	// a leaf stored under a key that doesn't match its content
+	leaf2 := merkletree.NewNodeLeaf(&merkletree.Hash{2}, &merkletree.Hash{2})
+	wrongKey := merkletree.Hash{0xff}
+	require.NoError(t, storage.Put(ctx, wrongKey[:], leaf2))
+	// a middle node with two empty children
+	empty := putNode(t, storage, merkletree.NewNodeMiddle(
+		&merkletree.HashZero, &merkletree.HashZero))
+	mid := putNode(t, storage, merkletree.NewNodeMiddle(leaf1, &wrongKey))
+	root := putNode(t, storage, merkletree.NewNodeMiddle(mid, empty))
+	require.NoError(t, storage.SetRoot(ctx, root))
+
+	mt, err := merkletree.OpenReadOnly(ctx, storage, 40)
+	require.NoError(t, err)
+	report, err := mt.Check(ctx, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []merkletree.CheckIssueKind{
+		merkletree.CheckMisplacedLeaf,
+		merkletree.CheckKeyMismatch,
+		merkletree.CheckEmptyMiddle}, issueKinds(report))
+	assert.Equal(t, []bool{false, false}, report.Issues[0].Path)
+
+	// a stored root that doesn't exist
+	require.NoError(t, storage.SetRoot(ctx, &merkletree.Hash{0xaa}))
+	report, err = mt.Check(ctx, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []merkletree.CheckIssueKind{merkletree.CheckMissingRoot},
+		issueKinds(report))
+	assert.Equal(t, "missing root at depth 0: "+
+		merkletree.Hash{0xaa}.Hex(), report.Issues[0].String())
+}
+
+func TestCheckCachedNodes(t *testing.T) {
+	ctx := context.Background()
+	storage := memory.NewMemoryStorage()
+	mt, err := merkletree.NewMerkleTree(ctx, storage, 40,
+		merkletree.WithNodeCache(merkletree.NewLRUNodeCache(64)))
+	require.NoError(t, err)
+	for i := 0; i < 16; i++ {
+		err = mt.Add(ctx, big.NewInt(int64(i)), big.NewInt(int64(i)))
+		require.NoError(t, err)
+	}
+
+	// walking the tree fills the cache, and computes the keys of the nodes
+	var leaf3 *merkletree.Node
+	err = mt.WalkNodes(ctx, nil, func(n *merkletree.Node, _ int,
+		_ []bool) (merkletree.WalkAction, error) {
+		_, err := n.Key()
+		if n.Type == merkletree.NodeTypeLeaf &&
+			n.Entry[0].BigInt().Int64() == 3 {
+			leaf3 = n
+		}
+		return merkletree.WalkContinue, err
+	})
+	require.NoError(t, err)
+	require.NotNil(t, leaf3)
+
+	// corrupt the stored leaf, keeping the key computed before
+	k, err := leaf3.Key()
+	require.NoError(t, err)
+	corrupted := *leaf3
+	corrupted.Entry[1] = &merkletree.Hash{9}
+	require.NoError(t, storage.Put(ctx, k[:], &corrupted))
+	_, v, _, err := mt.Get(ctx, big.NewInt(3))
+	require.NoError(t, err)
+	assert.Equal(t, big.NewInt(3), v)
+
+	report, err := mt.Check(ctx, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []merkletree.CheckIssueKind{merkletree.CheckKeyMismatch},
+		issueKinds(report))
+	assert.Equal(t, k, report.Issues[0].Key)
+}
@@ -0,0 +1,130 @@
+package merkletree
+
+import (
+	"errors"
+	"strconv"
+)
+
+// ErrTooManySiblings is used when the siblings of a proof don't fit in the
+// number of levels of a circuit.
+var ErrTooManySiblings = errors.New("the proof has more siblings than the circuit levels allow")
+
+// SMTVerifierInputs returns the input of circomlib's SMTVerifier template with
+// nLevels levels for the given CircomVerifierProof, with all the values as
+// decimal strings. The siblings are padded with zeros up to nLevels. As the
+// circuit requires the last sibling to be zero, the proof can't have
+// non-empty siblings at level nLevels-1 or deeper.
+func SMTVerifierInputs(p *CircomVerifierProof, nLevels int,
+	enabled bool) (map[string]interface{}, error) {
+	siblings, err := circuitSiblings(p.Siblings, nLevels)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{
+		"enabled":  boolString(enabled),
+		"root":     hashString(p.Root),
+		"siblings": siblings,
+		"oldKey":   hashString(p.OldKey),
+		"oldValue": hashString(p.OldValue),
+		"isOld0":   boolString(p.IsOld0),
+		"key":      hashString(p.Key),
+		"value":    hashString(p.Value),
+		"fnc":      strconv.Itoa(p.Fnc),
+	}, nil
+}
+
+// SMTProcessorInputs returns the input of circomlib's SMTProcessor template
+// with nLevels levels for the given CircomProcessorProof, with all the values
+// as decimal strings and fnc as a pair of bits. The siblings are padded with
+// zeros up to nLevels, with the same restrictions as in SMTVerifierInputs.
+// newRoot is not part of the input, as it's an output of the template.
+func SMTProcessorInputs(p *CircomProcessorProof,
+	nLevels int) (map[string]interface{}, error) {
+	siblings, err := circuitSiblings(p.Siblings, nLevels)
+	if err != nil {
+		return nil, err
+	}
+	in := newProcessorInput(p, siblings)
+	return map[string]interface{}{
+		"fnc":      in.fnc,
+		"oldRoot":  in.oldRoot,
+		"siblings": in.siblings,
+		"oldKey":   in.oldKey,
+		"oldValue": in.oldValue,
+		"isOld0":   in.isOld0,
+		"newKey":   in.newKey,
+		"newValue": in.newValue,
+	}, nil
+}
+
+// processorInput is a CircomProcessorProof encoded as the input of
+// SMTProcessor. It's shared by SMTProcessorInputs and
+// BatchWitness.CircuitInputs, so both encode the proofs in the same way.
+type processorInput struct {
+	fnc              [2]string
+	oldRoot, newRoot string
+	siblings         []string
+	oldKey, oldValue string
+	isOld0           string
+	newKey, newValue string
+}
+
+// newProcessorInput encodes the CircomProcessorProof with the given siblings,
+// already encoded.
+func newProcessorInput(p *CircomProcessorProof,
+	siblings []string) processorInput {
+	return processorInput{
+		fnc:      fncBits(p.Fnc),
+		oldRoot:  hashString(p.OldRoot),
+		newRoot:  hashString(p.NewRoot),
+		siblings: siblings,
+		oldKey:   hashString(p.OldKey),
+		oldValue: hashString(p.OldValue),
+		isOld0:   boolString(p.IsOld0),
+		newKey:   hashString(p.NewKey),
+		newValue: hashString(p.NewValue),
+	}
+}
+
+// circuitSiblings returns the siblings padded (or trimmed, if the extra ones
+// are empty) to nLevels, as decimal strings.
+func circuitSiblings(siblings []*Hash, nLevels int) ([]string, error) {
+	n := len(siblings)
+	for n > 0 && (siblings[n-1] == nil || siblings[n-1].Equals(&HashZero)) {
+		n--
+	}
+	if n > nLevels-1 {
+		return nil, ErrTooManySiblings
+	}
+	s := make([]string, nLevels)
+	for i := range s {
+		if i < n {
+			s[i] = hashString(siblings[i])
+		} else {
+			s[i] = "0"
+		}
+	}
+	return s, nil
+}
+
+// fncBits returns the function of a CircomProcessorProof as the pair of bits
+// expected by SMTProcessor: NOP=00, UPDATE=01, INSERT=10, DELETE=11
+func fncBits(fnc int) [2]string {
+	return [2]string{strconv.Itoa(fnc >> 1 & 1), strconv.Itoa(fnc & 1)}
+}
+
+// hashString returns the Hash as a decimal string, and "0" for nil.
+func hashString(h *Hash) string {
+	if h == nil {
+		return "0"
+	}
+	return h.BigInt().String()
+}
+
+// boolString returns the bool as the "1" or "0" expected by the circuits.
+func boolString(b bool) string {
+	if b {
+		return "1"
+	}
+	return "0"
+}
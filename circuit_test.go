@@ -0,0 +1,75 @@
+package merkletree_test
+
+import (
+	"context"
+	"encoding/json"
+	"math/big"
+	"testing"
+
+	"github.com/iden3/go-merkletree-sql/v2"
+	"github.com/iden3/go-merkletree-sql/v2/db/memory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSMTVerifierInputs(t *testing.T) {
+	ctx := context.Background()
+	mt, err := merkletree.NewMerkleTree(ctx, memory.NewMemoryStorage(), 4)
+	require.NoError(t, err)
+	for i := int64(1); i <= 4; i++ {
+		require.NoError(t, mt.Add(ctx, big.NewInt(i), big.NewInt(i*11)))
+	}
+	cvp, err := mt.GenerateCircomVerifierProof(ctx, big.NewInt(2), nil)
+	require.NoError(t, err)
+
+	inputs, err := merkletree.SMTVerifierInputs(cvp, 4, true)
+	require.NoError(t, err)
+	b, err := json.Marshal(inputs)
+	require.NoError(t, err)
+	//nolint:lll
+	expected := `{"enabled":"1","fnc":"0","isOld0":"0","key":"2","oldKey":"0","oldValue":"0","root":"13558168455220559042747853958949063046226645447188878859760119761585093422436","siblings":["11620130507635441932056895853942898236773847390796721536119314875877874016518","5158240518874928563648144881543092238925265313977134167935552944620041388700","0","0"],"value":"22"}`
+	assert.JSONEq(t, expected, string(b))
+
+	inputs, err = merkletree.SMTVerifierInputs(cvp, 3, false)
+	require.NoError(t, err)
+	assert.Len(t, inputs["siblings"], 3)
+	assert.Equal(t, "0", inputs["enabled"])
+
+	// the last sibling of the circuit must be 0
+	_, err = merkletree.SMTVerifierInputs(cvp, 2, true)
+	assert.Equal(t, merkletree.ErrTooManySiblings, err)
+}
+
+func TestSMTProcessorInputs(t *testing.T) {
+	ctx := context.Background()
+	mt, err := merkletree.NewMerkleTree(ctx, memory.NewMemoryStorage(), 10)
+	require.NoError(t, err)
+	for i := int64(0); i < 16; i++ {
+		require.NoError(t, mt.Add(ctx, big.NewInt(i), big.NewInt(i*2)))
+	}
+	cpp, err := mt.Update(ctx, big.NewInt(10), big.NewInt(1024))
+	require.NoError(t, err)
+	require.Len(t, cpp.Siblings, 11)
+
+	inputs, err := merkletree.SMTProcessorInputs(cpp, 10)
+	require.NoError(t, err)
+	assert.Equal(t, [2]string{"0", "1"}, inputs["fnc"])
+	assert.Equal(t, cpp.OldRoot.BigInt().String(), inputs["oldRoot"])
+	assert.Equal(t, "1024", inputs["newValue"])
+	assert.Equal(t, "0", inputs["isOld0"])
+	assert.NotContains(t, inputs, "newRoot")
+	siblings := inputs["siblings"].([]string)
+	require.Len(t, siblings, 10)
+	for i, s := range cpp.Siblings[:10] {
+		assert.Equal(t, s.BigInt().String(), siblings[i])
+	}
+
+	cpp, err = mt.AddAndGetCircomProof(ctx, big.NewInt(100), big.NewInt(1))
+	require.NoError(t, err)
+	inputs, err = merkletree.SMTProcessorInputs(cpp, 10)
+	require.NoError(t, err)
+	assert.Equal(t, [2]string{"1", "0"}, inputs["fnc"])
+
+	_, err = merkletree.SMTProcessorInputs(cpp, 3)
+	assert.Equal(t, merkletree.ErrTooManySiblings, err)
+}
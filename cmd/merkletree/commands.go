@@ -0,0 +1,446 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"strings"
+
+	"github.com/iden3/go-merkletree-sql/v2"
+)
+
+// newFlagSet returns the FlagSet of a command, which reports its errors as
+// usage errors.
+func newFlagSet(e *env, name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(e.stderr)
+	return fs
+}
+
+// parseArgs parses the flags of a command, and checks that n positional
+// arguments are left.
+func parseArgs(fs *flag.FlagSet, args []string, n int) error {
+	if err := fs.Parse(args); err != nil {
+		return usageError(err.Error())
+	}
+	if fs.NArg() != n {
+		return usageError(fmt.Sprintf("expected %d arguments, got %d", n,
+			fs.NArg()))
+	}
+	return nil
+}
+
+// rootFlag adds the -root flag to a command.
+func rootFlag(fs *flag.FlagSet) *string {
+	return fs.String("root", "", "root of the tree, the current one if empty")
+}
+
+// parseRoot parses the value of the -root flag. An empty value returns nil,
+// which selects the current root of the tree.
+func parseRoot(s string) (*merkletree.Hash, error) {
+	if s == "" {
+		return nil, nil
+	}
+	root, err := merkletree.NewHashFromString(s)
+	if err != nil {
+		return nil, usageError(fmt.Sprintf("invalid root %q: %v", s, err))
+	}
+	return root, nil
+}
+
+// parseInt parses a key or a value, in decimal or with a 0x, 0o or 0b prefix.
+func parseInt(s string) (*big.Int, error) {
+	i, ok := new(big.Int).SetString(s, 0)
+	if !ok || i.Sign() < 0 {
+		return nil, usageError(fmt.Sprintf("invalid number %q", s))
+	}
+	return i, nil
+}
+
+// parseKeyValue parses the key and the value positional arguments of a
+// command, once its flags are parsed.
+func parseKeyValue(fs *flag.FlagSet) (*big.Int, *big.Int, error) {
+	k, err := parseInt(fs.Arg(0))
+	if err != nil {
+		return nil, nil, err
+	}
+	v, err := parseInt(fs.Arg(1))
+	if err != nil {
+		return nil, nil, err
+	}
+	return k, v, nil
+}
+
+func cmdInit(ctx context.Context, e *env, args []string) error {
+	if err := parseArgs(newFlagSet(e, "init"), args, 0); err != nil {
+		return err
+	}
+	return mutate(ctx, e, func(*merkletree.MerkleTree) error { return nil })
+}
+
+func cmdAdd(ctx context.Context, e *env, args []string) error {
+	fs := newFlagSet(e, "add")
+	if err := parseArgs(fs, args, 2); err != nil {
+		return err
+	}
+	k, v, err := parseKeyValue(fs)
+	if err != nil {
+		return err
+	}
+	return mutate(ctx, e, func(mt *merkletree.MerkleTree) error {
+		return mt.Add(ctx, k, v)
+	})
+}
+
+func cmdUpdate(ctx context.Context, e *env, args []string) error {
+	fs := newFlagSet(e, "update")
+	if err := parseArgs(fs, args, 2); err != nil {
+		return err
+	}
+	k, v, err := parseKeyValue(fs)
+	if err != nil {
+		return err
+	}
+	return mutate(ctx, e, func(mt *merkletree.MerkleTree) error {
+		_, err := mt.Update(ctx, k, v)
+		return err
+	})
+}
+
+func cmdDelete(ctx context.Context, e *env, args []string) error {
+	fs := newFlagSet(e, "delete")
+	if err := parseArgs(fs, args, 1); err != nil {
+		return err
+	}
+	k, err := parseInt(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	return mutate(ctx, e, func(mt *merkletree.MerkleTree) error {
+		return mt.Delete(ctx, k)
+	})
+}
+
+// mutate opens the tree for writing, calls f with it, and prints the new
+// root in decimal.
+func mutate(ctx context.Context, e *env,
+	f func(mt *merkletree.MerkleTree) error) error {
+	mt, closeTree, err := e.openTree(ctx, true)
+	if err != nil {
+		return err
+	}
+	defer closeTree()
+	if err := f(mt); err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(e.stdout, mt.Root().BigInt())
+	return err
+}
+
+func cmdGet(ctx context.Context, e *env, args []string) error {
+	fs := newFlagSet(e, "get")
+	rootS := rootFlag(fs)
+	if err := parseArgs(fs, args, 1); err != nil {
+		return err
+	}
+	root, err := parseRoot(*rootS)
+	if err != nil {
+		return err
+	}
+	k, err := parseInt(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	mt, closeTree, err := e.openTree(ctx, false)
+	if err != nil {
+		return err
+	}
+	defer closeTree()
+	if root != nil {
+		if mt, err = mt.Snapshot(ctx, root); err != nil {
+			return err
+		}
+	}
+	_, v, _, err := mt.Get(ctx, k)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(e.stdout, v)
+	return err
+}
+
+func cmdProof(ctx context.Context, e *env, args []string) error {
+	fs := newFlagSet(e, "proof")
+	rootS := rootFlag(fs)
+	format := fs.String("format", "text",
+		"output format: text, json, bytes or circom")
+	if err := parseArgs(fs, args, 1); err != nil {
+		return err
+	}
+	root, err := parseRoot(*rootS)
+	if err != nil {
+		return err
+	}
+	k, err := parseInt(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	mt, closeTree, err := e.openTree(ctx, false)
+	if err != nil {
+		return err
+	}
+	defer closeTree()
+
+	if *format == "circom" {
+		cp, err := mt.GenerateCircomVerifierProof(ctx, k, root)
+		if err != nil {
+			return err
+		}
+		return printJSON(e.stdout, cp)
+	}
+	p, v, err := mt.GenerateProof(ctx, k, root)
+	if err != nil {
+		return err
+	}
+	switch *format {
+	case "text":
+		return printProof(e.stdout, p, v)
+	case "json":
+		return printJSON(e.stdout, p)
+	case "bytes":
+		_, err = fmt.Fprintln(e.stdout, hex.EncodeToString(p.Bytes()))
+		return err
+	default:
+		return usageError(fmt.Sprintf("invalid format %q", *format))
+	}
+}
+
+// printProof prints a Proof in a human readable form.
+func printProof(w io.Writer, p *merkletree.Proof, v *big.Int) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "existence: %v\n", p.Existence)
+	if p.Existence {
+		fmt.Fprintf(&b, "value: %v\n", v)
+	}
+	fmt.Fprintf(&b, "siblings:\n")
+	for i, s := range p.AllSiblings() {
+		fmt.Fprintf(&b, "  %d: %v\n", i, s.BigInt())
+	}
+	if p.NodeAux != nil {
+		fmt.Fprintf(&b, "node aux:\n  key: %v\n  value: %v\n",
+			p.NodeAux.Key.BigInt(), p.NodeAux.Value.BigInt())
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func printJSON(w io.Writer, v interface{}) error {
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(w, string(b))
+	return err
+}
+
+func cmdVerify(ctx context.Context, e *env, args []string) error {
+	fs := newFlagSet(e, "verify")
+	rootS := rootFlag(fs)
+	if err := parseArgs(fs, args, 3); err != nil {
+		return err
+	}
+	root, err := parseRoot(*rootS)
+	if err != nil {
+		return err
+	}
+	k, v, err := parseKeyValue(fs)
+	if err != nil {
+		return err
+	}
+	proofS := fs.Arg(2)
+	if proofS == "-" {
+		b, err := io.ReadAll(e.stdin)
+		if err != nil {
+			return err
+		}
+		proofS = string(b)
+	}
+	p, err := parseProof(proofS)
+	if err != nil {
+		return err
+	}
+	hasher := e.hasher
+	if root == nil {
+		mt, closeTree, err := e.openTree(ctx, false)
+		if err != nil {
+			return err
+		}
+		root = mt.Root()
+		hasher = mt.Hasher()
+		closeTree()
+	}
+	// without a known hasher, the proof is verified with its own
+	if hasher == nil {
+		hasher = p.Hasher()
+	}
+
+	if !merkletree.VerifyProofWithHasher(hasher, root, p, k, v) {
+		fmt.Fprintln(e.stdout, "invalid")
+		return errFailed
+	}
+	_, err = fmt.Fprintln(e.stdout, "valid")
+	return err
+}
+
+// parseProof parses a Proof in JSON or as the hex of its bytes.
+func parseProof(s string) (*merkletree.Proof, error) {
+	s = strings.TrimSpace(s)
+	if strings.HasPrefix(s, "{") {
+		var p merkletree.Proof
+		if err := json.Unmarshal([]byte(s), &p); err != nil {
+			return nil, fmt.Errorf("invalid proof: %w", err)
+		}
+		return &p, nil
+	}
+	b, err := hex.DecodeString(strings.TrimPrefix(s, "0x"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid proof: %w", err)
+	}
+	return merkletree.NewProofFromBytes(b)
+}
+
+func cmdDump(ctx context.Context, e *env, args []string) error {
+	fs := newFlagSet(e, "dump")
+	rootS := rootFlag(fs)
+	out := fs.String("o", "-", "output file, - for the standard output")
+	if err := parseArgs(fs, args, 0); err != nil {
+		return err
+	}
+	root, err := parseRoot(*rootS)
+	if err != nil {
+		return err
+	}
+	mt, closeTree, err := e.openTree(ctx, false)
+	if err != nil {
+		return err
+	}
+	defer closeTree()
+	if *out == "-" {
+		return mt.DumpLeafsTo(ctx, e.stdout, root)
+	}
+	f, err := os.Create(*out)
+	if err != nil {
+		return err
+	}
+	if err := mt.DumpLeafsTo(ctx, f, root); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func cmdImport(ctx context.Context, e *env, args []string) error {
+	fs := newFlagSet(e, "import")
+	in := fs.String("i", "-", "input file, - for the standard input")
+	if err := parseArgs(fs, args, 0); err != nil {
+		return err
+	}
+	r := e.stdin
+	if *in != "-" {
+		f, err := os.Open(*in)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+	return mutate(ctx, e, func(mt *merkletree.MerkleTree) error {
+		return mt.ImportLeafsFrom(ctx, r)
+	})
+}
+
+func cmdStats(ctx context.Context, e *env, args []string) error {
+	fs := newFlagSet(e, "stats")
+	rootS := rootFlag(fs)
+	if err := parseArgs(fs, args, 0); err != nil {
+		return err
+	}
+	root, err := parseRoot(*rootS)
+	if err != nil {
+		return err
+	}
+	mt, closeTree, err := e.openTree(ctx, false)
+	if err != nil {
+		return err
+	}
+	defer closeTree()
+	stats, err := mt.Stats(ctx, root)
+	if err != nil {
+		return err
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "leafs: %d\n", stats.Leafs)
+	fmt.Fprintf(&b, "middle nodes: %d\n", stats.Middles)
+	fmt.Fprintf(&b, "empty children: %d\n", stats.EmptyChildren)
+	fmt.Fprintf(&b, "max depth: %d/%d\n", stats.MaxDepth, mt.MaxLevels())
+	for depth, n := range stats.LeafDepths {
+		if n > 0 {
+			fmt.Fprintf(&b, "  depth %d: %d leafs\n", depth, n)
+		}
+	}
+	_, err = io.WriteString(e.stdout, b.String())
+	return err
+}
+
+func cmdGraphViz(ctx context.Context, e *env, args []string) error {
+	fs := newFlagSet(e, "graphviz")
+	rootS := rootFlag(fs)
+	if err := parseArgs(fs, args, 0); err != nil {
+		return err
+	}
+	root, err := parseRoot(*rootS)
+	if err != nil {
+		return err
+	}
+	mt, closeTree, err := e.openTree(ctx, false)
+	if err != nil {
+		return err
+	}
+	defer closeTree()
+	return mt.GraphViz(ctx, e.stdout, root)
+}
+
+func cmdFsck(ctx context.Context, e *env, args []string) error {
+	fs := newFlagSet(e, "fsck")
+	rootS := rootFlag(fs)
+	if err := parseArgs(fs, args, 0); err != nil {
+		return err
+	}
+	root, err := parseRoot(*rootS)
+	if err != nil {
+		return err
+	}
+	mt, closeTree, err := e.openTree(ctx, false)
+	if err != nil {
+		return err
+	}
+	defer closeTree()
+	report, err := mt.Check(ctx, root)
+	if err != nil {
+		return err
+	}
+	for _, issue := range report.Issues {
+		fmt.Fprintln(e.stdout, issue)
+	}
+	fmt.Fprintf(e.stdout, "%d nodes checked, %d issues\n", report.Nodes,
+		len(report.Issues))
+	if !report.OK() {
+		return errFailed
+	}
+	return nil
+}
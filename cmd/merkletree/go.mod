@@ -0,0 +1,29 @@
+module github.com/iden3/go-merkletree-sql/cmd/merkletree
+
+go 1.19
+
+require (
+	github.com/iden3/go-merkletree-sql/db/pgx/v5 v5.0.0
+	github.com/iden3/go-merkletree-sql/v2 v2.0.4
+	github.com/jackc/pgx/v5 v5.3.1
+	github.com/stretchr/testify v1.8.2
+)
+
+require (
+	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/iden3/go-iden3-crypto v0.0.15 // indirect
+	github.com/jackc/pgpassfile v1.0.0 // indirect
+	github.com/jackc/pgservicefile v0.0.0-20221227161230-091c0ba34f0a // indirect
+	github.com/jackc/puddle/v2 v2.2.0 // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
+	golang.org/x/crypto v0.7.0 // indirect
+	golang.org/x/sync v0.1.0 // indirect
+	golang.org/x/sys v0.6.0 // indirect
+	golang.org/x/text v0.8.0 // indirect
+	gopkg.in/yaml.v3 v3.0.1 // indirect
+)
+
+replace (
+	github.com/iden3/go-merkletree-sql/db/pgx/v5 => ../../db/pgx/v5
+	github.com/iden3/go-merkletree-sql/v2 => ../..
+)
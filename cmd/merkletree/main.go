@@ -0,0 +1,216 @@
+// Command merkletree inspects and operates trees stored in any of the
+// storages of go-merkletree-sql.
+//
+// Usage:
+//
+//	merkletree [flags] <command> [command flags] [args]
+//
+// The storage is selected with the -db flag, which is required, since every
+// invocation opens the tree again:
+//
+//	memory                   an empty in-memory tree, lost when the command
+//	                         exits, to try the commands or check a dump
+//	file:<path>              a tree in a local file, see db/file
+//	postgres://... (or postgresql://...)
+//	                         a tree in Postgres, see db/pgx/v5
+//
+// The hasher of a stored tree is read from the storage, so the -hasher flag
+// is only needed to create a tree with another hasher than poseidon.
+//
+// Run "merkletree -h" for the list of commands.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	pgxstorage "github.com/iden3/go-merkletree-sql/db/pgx/v5"
+	"github.com/iden3/go-merkletree-sql/v2"
+	"github.com/iden3/go-merkletree-sql/v2/db/file"
+	"github.com/iden3/go-merkletree-sql/v2/db/memory"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// exit codes
+const (
+	exitOK    = 0
+	exitFail  = 1
+	exitUsage = 2
+)
+
+// errFailed is returned by the commands that fail without an error to print,
+// like a proof that doesn't verify.
+var errFailed = errors.New("failed")
+
+// env is the environment of a command.
+type env struct {
+	stdin  io.Reader
+	stdout io.Writer
+	stderr io.Writer
+
+	dsn       string
+	mtId      uint64
+	maxLevels int
+	// hasher is nil if the -hasher flag is not set
+	hasher merkletree.Hasher
+}
+
+type command struct {
+	name  string
+	usage string
+	run   func(ctx context.Context, e *env, args []string) error
+}
+
+var commands = []command{
+	{"init", "init", cmdInit},
+	{"add", "add <key> <value>", cmdAdd},
+	{"update", "update <key> <value>", cmdUpdate},
+	{"delete", "delete <key>", cmdDelete},
+	{"get", "get [-root root] <key>", cmdGet},
+	{"proof", "proof [-root root] [-format text|json|bytes|circom] <key>",
+		cmdProof},
+	{"verify", "verify [-root root] <key> <value> <proof|->", cmdVerify},
+	{"dump", "dump [-root root] [-o file]", cmdDump},
+	{"import", "import [-i file]", cmdImport},
+	{"stats", "stats [-root root]", cmdStats},
+	{"graphviz", "graphviz [-root root]", cmdGraphViz},
+	{"fsck", "fsck [-root root]", cmdFsck},
+}
+
+func main() {
+	os.Exit(run(context.Background(), os.Args[1:], os.Stdin, os.Stdout,
+		os.Stderr))
+}
+
+// run runs the command line with the given arguments, and returns the exit
+// code.
+func run(ctx context.Context, args []string, stdin io.Reader, stdout,
+	stderr io.Writer) int {
+	e := &env{stdin: stdin, stdout: stdout, stderr: stderr}
+	fs := flag.NewFlagSet("merkletree", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.StringVar(&e.dsn, "db", "",
+		"storage: memory, file:<path> or a postgres:// DSN (required)")
+	fs.Uint64Var(&e.mtId, "mt-id", 1, "id of the tree in the storage")
+	fs.IntVar(&e.maxLevels, "levels", 40, "maximum levels of the tree")
+	hasherName := fs.String("hasher", "",
+		"hasher of a new tree: poseidon (default), keccak256 or sha256")
+	fs.Usage = func() {
+		fmt.Fprintf(stderr, "Usage: merkletree [flags] <command> [args]\n\n")
+		fmt.Fprintf(stderr, "Commands:\n")
+		for _, c := range commands {
+			fmt.Fprintf(stderr, "  %v\n", c.usage)
+		}
+		fmt.Fprintf(stderr, "\nFlags:\n")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return exitUsage
+	}
+	if *hasherName != "" {
+		var err error
+		e.hasher, err = merkletree.HasherByName(*hasherName)
+		if err != nil {
+			fmt.Fprintf(stderr, "merkletree: %v\n", err)
+			return exitUsage
+		}
+	}
+
+	for _, c := range commands {
+		if c.name != fs.Arg(0) {
+			continue
+		}
+		err := c.run(ctx, e, fs.Args()[1:])
+		var usageErr usageError
+		switch {
+		case err == nil:
+			return exitOK
+		case errors.Is(err, errFailed):
+			return exitFail
+		case errors.As(err, &usageErr):
+			fmt.Fprintf(stderr, "merkletree %v: %v\nUsage: merkletree %v\n",
+				c.name, err, c.usage)
+			return exitUsage
+		default:
+			fmt.Fprintf(stderr, "merkletree %v: %v\n", c.name, err)
+			return exitFail
+		}
+	}
+	fmt.Fprintf(stderr, "merkletree: unknown command %q\n", fs.Arg(0))
+	fs.Usage()
+	return exitUsage
+}
+
+// usageError is an error in the arguments of a command.
+type usageError string
+
+func (e usageError) Error() string {
+	return string(e)
+}
+
+// openStorage opens the storage selected with the -db flag. The returned
+// function closes it.
+func (e *env) openStorage(ctx context.Context) (merkletree.Storage,
+	func(), error) {
+	switch {
+	case e.dsn == "":
+		return nil, nil, usageError("the -db flag is required")
+	case e.dsn == "memory":
+		return memory.NewMemoryStorage(), func() {}, nil
+	case strings.HasPrefix(e.dsn, "file:"):
+		s, err := file.NewFileStorage(strings.TrimPrefix(e.dsn, "file:"),
+			e.mtId)
+		if err != nil {
+			return nil, nil, err
+		}
+		return s, func() {
+			if err := s.Close(); err != nil {
+				fmt.Fprintf(e.stderr, "merkletree: %v\n", err)
+			}
+		}, nil
+	case strings.HasPrefix(e.dsn, "postgres://"),
+		strings.HasPrefix(e.dsn, "postgresql://"):
+		pool, err := pgxpool.New(ctx, e.dsn)
+		if err != nil {
+			return nil, nil, err
+		}
+		return pgxstorage.NewSqlStorage(pool, e.mtId), pool.Close, nil
+	default:
+		return nil, nil, usageError(fmt.Sprintf("invalid -db %q", e.dsn))
+	}
+}
+
+// openTree opens the tree selected with the flags. If writable is false, the
+// tree is opened with merkletree.OpenReadOnly, so the storage is not written.
+func (e *env) openTree(ctx context.Context,
+	writable bool) (*merkletree.MerkleTree, func(), error) {
+	storage, closeStorage, err := e.openStorage(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	// without the -hasher flag, the hasher stored with the tree is used
+	var opts []merkletree.Option
+	if e.hasher != nil {
+		opts = append(opts, merkletree.WithHasher(e.hasher))
+	}
+	var mt *merkletree.MerkleTree
+	if writable {
+		mt, err = merkletree.NewMerkleTree(ctx, storage, e.maxLevels, opts...)
+	} else {
+		mt, err = merkletree.OpenReadOnly(ctx, storage, e.maxLevels, opts...)
+	}
+	if err != nil {
+		closeStorage()
+		return nil, nil, err
+	}
+	return mt, closeStorage, nil
+}
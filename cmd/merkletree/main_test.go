@@ -0,0 +1,205 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type cli struct {
+	t   *testing.T
+	dsn string
+}
+
+func newCLI(t *testing.T) *cli {
+	return &cli{t: t, dsn: "file:" + filepath.Join(t.TempDir(), "tree.mt")}
+}
+
+// run runs the command line with the given stdin, and returns its exit code
+// and trimmed stdout.
+func (c *cli) runInput(stdin string, args ...string) (int, string) {
+	var stdout, stderr bytes.Buffer
+	args = append([]string{"-db", c.dsn, "-levels", "10"}, args...)
+	code := run(context.Background(), args, strings.NewReader(stdin), &stdout,
+		&stderr)
+	if code != exitOK {
+		c.t.Logf("%v: exit %d: %v", args, code, stderr.String())
+	}
+	return code, strings.TrimSpace(stdout.String())
+}
+
+func (c *cli) run(args ...string) (int, string) {
+	return c.runInput("", args...)
+}
+
+// mustRun runs the command line, and requires it to succeed.
+func (c *cli) mustRun(args ...string) string {
+	code, out := c.run(args...)
+	require.Equal(c.t, exitOK, code)
+	return out
+}
+
+func TestMutations(t *testing.T) {
+	c := newCLI(t)
+	empty := c.mustRun("init")
+	assert.Equal(t, "0", empty)
+
+	c.mustRun("add", "1", "10")
+	c.mustRun("add", "2", "20")
+	root := c.mustRun("add", "0x3", "30")
+	assert.Equal(t, "30", c.mustRun("get", "3"))
+
+	// every command reopens the file
+	updated := c.mustRun("update", "3", "31")
+	assert.NotEqual(t, root, updated)
+	assert.Equal(t, "31", c.mustRun("get", "3"))
+	assert.Equal(t, "30", c.mustRun("get", "-root", root, "3"))
+
+	// the positional arguments are read after the flags
+	c.mustRun("add", "--", "4", "40")
+	assert.Equal(t, "40", c.mustRun("get", "--", "4"))
+	c.mustRun("update", "--", "4", "41")
+	c.mustRun("delete", "--", "4")
+
+	deleted := c.mustRun("delete", "2")
+	assert.NotEqual(t, updated, deleted)
+	code, _ := c.run("get", "2")
+	assert.Equal(t, exitFail, code)
+
+	// trees with other mt_id are independent
+	code, _ = c.run("-mt-id", "2", "get", "1")
+	assert.Equal(t, exitFail, code)
+	assert.Equal(t, "10", c.mustRun("get", "1"))
+}
+
+func TestProofAndVerify(t *testing.T) {
+	c := newCLI(t)
+	c.mustRun("add", "1", "10")
+	root := c.mustRun("add", "2", "20")
+
+	for _, format := range []string{"json", "bytes"} {
+		proof := c.mustRun("proof", "-format", format, "1")
+		assert.Equal(t, "valid", c.mustRun("verify", "1", "10", proof), format)
+		assert.Equal(t, "valid", c.mustRun("verify", "-root", root, "1", "10",
+			proof), format)
+
+		code, out := c.run("verify", "1", "11", proof)
+		assert.Equal(t, exitFail, code, format)
+		assert.Equal(t, "invalid", out, format)
+
+		code, out = c.runInput(proof, "verify", "1", "10", "-")
+		assert.Equal(t, exitOK, code, format)
+		assert.Equal(t, "valid", out, format)
+	}
+
+	// non existence
+	proof := c.mustRun("proof", "-format", "bytes", "3")
+	assert.Equal(t, "valid", c.mustRun("verify", "3", "0", proof))
+
+	text := c.mustRun("proof", "1")
+	assert.Contains(t, text, "existence: true")
+	assert.Contains(t, text, "value: 10")
+
+	circom := c.mustRun("proof", "-format", "circom", "1")
+	assert.Contains(t, circom, `"fnc": 0`)
+	assert.Contains(t, circom, root)
+
+	code, _ := c.run("proof", "-format", "xml", "1")
+	assert.Equal(t, exitUsage, code)
+}
+
+func TestDumpImport(t *testing.T) {
+	c := newCLI(t)
+	c.mustRun("add", "1", "10")
+	c.mustRun("add", "2", "20")
+	root := c.mustRun("add", "3", "30")
+
+	dump := filepath.Join(t.TempDir(), "leafs.dump")
+	c.mustRun("dump", "-o", dump)
+
+	c2 := newCLI(t)
+	assert.Equal(t, root, c2.mustRun("import", "-i", dump))
+	assert.Equal(t, "20", c2.mustRun("get", "2"))
+
+	// importing into a non empty tree fails
+	code, _ := c2.run("import", "-i", dump)
+	assert.Equal(t, exitFail, code)
+}
+
+func TestInspect(t *testing.T) {
+	c := newCLI(t)
+	c.mustRun("add", "1", "10")
+	c.mustRun("add", "2", "20")
+	c.mustRun("add", "3", "30")
+
+	stats := c.mustRun("stats")
+	assert.Contains(t, stats, "leafs: 3")
+	assert.Contains(t, stats, "max depth: 2/10")
+
+	assert.Contains(t, c.mustRun("graphviz"), "digraph hierarchy")
+	assert.Equal(t, "5 nodes checked, 0 issues", c.mustRun("fsck"))
+}
+
+func TestHasher(t *testing.T) {
+	c := newCLI(t)
+	c.mustRun("-hasher", "keccak256", "init")
+	c.mustRun("add", "1", "10")
+	root := c.mustRun("add", "2", "20")
+	assert.Equal(t, "10", c.mustRun("get", "1"))
+
+	// the commands use the stored hasher without the -hasher flag
+	proof := c.mustRun("proof", "-format", "json", "1")
+	assert.Contains(t, proof, `"hasher": "keccak256"`)
+	assert.Equal(t, "valid", c.mustRun("verify", "1", "10", proof))
+	assert.Equal(t, "valid", c.mustRun("verify", "-root", root, "1", "10",
+		proof))
+	assert.Equal(t, "3 nodes checked, 0 issues", c.mustRun("fsck"))
+
+	// and the tree can't be opened with another hasher
+	code, _ := c.run("-hasher", "poseidon", "get", "1")
+	assert.Equal(t, exitFail, code)
+}
+
+func TestMemory(t *testing.T) {
+	c := &cli{t: t, dsn: "memory"}
+	assert.Equal(t, "0", c.mustRun("init"))
+	// the tree is lost when the command exits
+	c.mustRun("add", "1", "10")
+	code, _ := c.run("get", "1")
+	assert.Equal(t, exitFail, code)
+
+	other := newCLI(t)
+	other.mustRun("add", "1", "10")
+	root := other.mustRun("add", "2", "20")
+	dump := filepath.Join(t.TempDir(), "leafs.dump")
+	other.mustRun("dump", "-o", dump)
+	assert.Equal(t, root, c.mustRun("import", "-i", dump))
+}
+
+func TestUsage(t *testing.T) {
+	c := newCLI(t)
+	for _, args := range [][]string{
+		{},
+		{"unknown"},
+		{"add", "1"},
+		{"add", "a", "1"},
+		{"get", "-root", "x", "1"},
+		{"-hasher", "md5", "init"},
+		{"-db", "mysql://localhost", "init"},
+	} {
+		code, _ := c.run(args...)
+		assert.Equal(t, exitUsage, code, args)
+	}
+
+	// there is no default storage
+	var stdout, stderr bytes.Buffer
+	code := run(context.Background(), []string{"init"}, strings.NewReader(""),
+		&stdout, &stderr)
+	assert.Equal(t, exitUsage, code)
+	assert.Contains(t, stderr.String(), "-db")
+}
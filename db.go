@@ -21,6 +21,54 @@ type Storage interface {
 	SetRoot(context.Context, *Hash) error
 }
 
+// LeafCountStorage is an optional interface of a Storage that keeps the number
+// of leafs under each root, so MerkleTree.Count doesn't need to walk the tree.
+// GetLeafCount returns ErrNotFound if the count of the root is not stored.
+// All the storages in the db directory implement it; the SQL ones keep the
+// counts in the mt_leaf_counts table.
+type LeafCountStorage interface {
+	GetLeafCount(ctx context.Context, root *Hash) (uint64, error)
+	SetLeafCount(ctx context.Context, root *Hash, count uint64) error
+}
+
+// HasherStorage is an optional interface of a Storage that keeps the name of
+// the Hasher of the tree, so NewMerkleTree can detect a tree reopened with a
+// different Hasher. GetHasherName returns ErrNotFound if no name is stored.
+// All the storages in the db directory implement it; the SQL ones keep the
+// names in the mt_hashers table.
+type HasherStorage interface {
+	GetHasherName(ctx context.Context) (string, error)
+	SetHasherName(ctx context.Context, name string) error
+}
+
+// NodeLister is an optional interface of a Storage that can list all its
+// nodes, including the ones not reachable from the current root. ListNodes
+// calls f for each stored node, and stops at the first error returned by f.
+type NodeLister interface {
+	ListNodes(ctx context.Context, f func(key []byte, n *Node) error) error
+}
+
+// RootLister is an optional interface of a Storage that keeps the history of
+// the roots set with SetRoot. ListRoots calls f for each root, oldest first,
+// and stops at the first error returned by f. A root set several times in a
+// row is only listed once.
+type RootLister interface {
+	ListRoots(ctx context.Context, f func(root *Hash) error) error
+}
+
+// EntryStorage is an optional interface of a Storage that stores the entries
+// added with MerkleTree.AddEntry and MerkleTree.AddGenericEntry, which are
+// otherwise only kept as their hIndex and hValue. Each entry is stored as the
+// text form of its GenericEntry, so the Storage doesn't depend on the number
+// of elements of the entries. The entries are stored under the key of their
+// leaf node, so like the nodes they are never modified, and they remain valid
+// for all the roots that contain the leaf. GetEntry returns ErrNotFound if no
+// entry is stored for the key.
+type EntryStorage interface {
+	GetEntry(ctx context.Context, key []byte) ([]byte, error)
+	PutEntry(ctx context.Context, key []byte, entry []byte) error
+}
+
 // KV contains a key (K) and a value (V)
 type KV struct {
 	K []byte
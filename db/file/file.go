@@ -0,0 +1,448 @@
+// Package file implements a merkletree.Storage persisted in a local file.
+//
+// The file is an append-only log of records. All the records of the tree are
+// loaded in memory when the Storage is opened, and each modification is
+// appended to the file. A file can contain several trees, identified by their
+// mtId, like the tables of the SQL storages.
+package file
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+
+	"github.com/iden3/go-merkletree-sql/v2"
+)
+
+const (
+	recordNode      = 'N'
+	recordRoot      = 'R'
+	recordEntry     = 'E'
+	recordLeafCount = 'C'
+	recordHasher    = 'H'
+)
+
+var fileMagic = []byte("\x89MTFILE\n")
+
+// maxFieldLen is the maximum length of a variable length field of a record,
+// far above the length of the keys, nodes, entries and names that are
+// stored, so a longer field can only be found in a corrupted file.
+const maxFieldLen = 1 << 24
+
+// ErrInvalidFile is used when the file is not a merkletree file.
+var ErrInvalidFile = errors.New("invalid merkletree file")
+
+// Storage implements the db.Storage interface
+type Storage struct {
+	mu          sync.Mutex
+	f           *os.File
+	w           *bufio.Writer
+	mtId        uint64
+	kv          merkletree.KvMap
+	currentRoot *merkletree.Hash
+	entries     map[string][]byte
+	leafCounts  map[merkletree.Hash]uint64
+	roots       []merkletree.Hash
+	hasherName  string
+}
+
+// NewFileStorage opens the file at path, creating it if it doesn't exist, and
+// returns the Storage of the tree with the given mtId. The Storage must be
+// closed with Close. A file can't be opened by more than one Storage at the
+// same time.
+func NewFileStorage(path string, mtId uint64) (*Storage, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	s := &Storage{f: f, mtId: mtId, kv: make(merkletree.KvMap),
+		entries:    make(map[string][]byte),
+		leafCounts: make(map[merkletree.Hash]uint64)}
+	if err := s.load(); err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	s.w = bufio.NewWriter(f)
+	return s, nil
+}
+
+// load reads the records of the tree from the file. A truncated record at the
+// end of the file, left by an interrupted write, is discarded.
+func (s *Storage) load() error {
+	r := bufio.NewReader(s.f)
+	magic := make([]byte, len(fileMagic))
+	n, err := io.ReadFull(r, magic)
+	if n == 0 && err == io.EOF {
+		if _, err := s.f.Write(fileMagic); err != nil {
+			return err
+		}
+		return nil
+	} else if err != nil || !bytes.Equal(magic, fileMagic) {
+		return ErrInvalidFile
+	}
+
+	info, err := s.f.Stat()
+	if err != nil {
+		return err
+	}
+	offset := int64(len(fileMagic))
+	for {
+		size, err := s.readRecord(r, info.Size()-offset)
+		if err == io.EOF {
+			break
+		} else if err == io.ErrUnexpectedEOF {
+			if err := s.f.Truncate(offset); err != nil {
+				return err
+			}
+			break
+		} else if err != nil {
+			return err
+		}
+		offset += size
+	}
+	_, err = s.f.Seek(offset, io.SeekStart)
+	return err
+}
+
+// readRecord reads a record and applies it if it belongs to the tree. It
+// returns the size of the record. remaining is the number of bytes of the
+// file from the start of the record.
+func (s *Storage) readRecord(r *bufio.Reader, remaining int64) (int64,
+	error) {
+	cr := &countingReader{r: r, remaining: remaining}
+	kind, err := cr.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	mtId, err := binary.ReadUvarint(cr)
+	if err != nil {
+		return 0, unexpectedEOF(err)
+	}
+	switch kind {
+	case recordNode:
+		key, err := readBytes(cr)
+		if err != nil {
+			return 0, err
+		}
+		value, err := readBytes(cr)
+		if err != nil {
+			return 0, err
+		}
+		if mtId == s.mtId {
+			n, err := merkletree.NewNodeFromBytes(value)
+			if err != nil {
+				return 0, err
+			}
+			s.kv.Put(key, *n)
+		}
+	case recordRoot:
+		var root merkletree.Hash
+		if _, err := io.ReadFull(cr, root[:]); err != nil {
+			return 0, unexpectedEOF(err)
+		}
+		if mtId == s.mtId {
+			s.setRoot(root)
+		}
+	case recordEntry:
+		key, err := readBytes(cr)
+		if err != nil {
+			return 0, err
+		}
+		entry, err := readBytes(cr)
+		if err != nil {
+			return 0, err
+		}
+		if mtId == s.mtId {
+			s.entries[string(key)] = entry
+		}
+	case recordLeafCount:
+		var root merkletree.Hash
+		if _, err := io.ReadFull(cr, root[:]); err != nil {
+			return 0, unexpectedEOF(err)
+		}
+		count, err := binary.ReadUvarint(cr)
+		if err != nil {
+			return 0, unexpectedEOF(err)
+		}
+		if mtId == s.mtId {
+			s.leafCounts[root] = count
+		}
+	case recordHasher:
+		name, err := readBytes(cr)
+		if err != nil {
+			return 0, err
+		}
+		if mtId == s.mtId {
+			s.hasherName = string(name)
+		}
+	default:
+		return 0, fmt.Errorf("%w: unknown record %#x", ErrInvalidFile, kind)
+	}
+	return cr.n, nil
+}
+
+// Get retrieves a value from a key in the db.Storage
+func (s *Storage) Get(_ context.Context, key []byte) (*merkletree.Node, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if v, ok := s.kv.Get(key); ok {
+		return &v, nil
+	}
+	return nil, merkletree.ErrNotFound
+}
+
+// Put inserts new node into merkletree
+func (s *Storage) Put(_ context.Context, key []byte,
+	node *merkletree.Node) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	record := s.newRecord(recordNode)
+	record = appendBytes(record, key)
+	record = appendBytes(record, node.Value())
+	if _, err := s.w.Write(record); err != nil {
+		return err
+	}
+	s.kv.Put(merkletree.Clone(key), *node)
+	return nil
+}
+
+// GetRoot returns current merkletree root
+func (s *Storage) GetRoot(_ context.Context) (*merkletree.Hash, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.currentRoot != nil {
+		root := *s.currentRoot
+		return &root, nil
+	}
+	return nil, merkletree.ErrNotFound
+}
+
+// SetRoot updates current merkletree root. The nodes written before are
+// flushed and synced to the file together with the root, so the tree in the
+// file is always consistent.
+func (s *Storage) SetRoot(_ context.Context, hash *merkletree.Hash) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	record := append(s.newRecord(recordRoot), hash[:]...)
+	if _, err := s.w.Write(record); err != nil {
+		return err
+	}
+	if err := s.w.Flush(); err != nil {
+		return err
+	}
+	if err := s.f.Sync(); err != nil {
+		return err
+	}
+	s.setRoot(*hash)
+	return nil
+}
+
+// setRoot sets the current root, and adds it to the root history.
+func (s *Storage) setRoot(root merkletree.Hash) {
+	s.currentRoot = &root
+	if len(s.roots) == 0 || s.roots[len(s.roots)-1] != root {
+		s.roots = append(s.roots, root)
+	}
+}
+
+// ListRoots calls f for each root of the tree set in the db.Storage, oldest
+// first
+func (s *Storage) ListRoots(ctx context.Context,
+	f func(root *merkletree.Hash) error) error {
+	s.mu.Lock()
+	roots := append([]merkletree.Hash{}, s.roots...)
+	s.mu.Unlock()
+	for i := range roots {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := f(&roots[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetEntry returns the entry stored under the key of its leaf
+func (s *Storage) GetEntry(_ context.Context, key []byte) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e, ok := s.entries[string(key)]; ok {
+		return merkletree.Clone(e), nil
+	}
+	return nil, merkletree.ErrNotFound
+}
+
+// PutEntry stores an entry under the key of its leaf. Like the nodes, it's
+// synced to the file with the next root, or when the Storage is closed.
+func (s *Storage) PutEntry(_ context.Context, key []byte, entry []byte) error {
+	if len(entry) > maxFieldLen {
+		return fmt.Errorf("entry of %d bytes is too long", len(entry))
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	record := s.newRecord(recordEntry)
+	record = appendBytes(record, key)
+	record = appendBytes(record, entry)
+	if _, err := s.w.Write(record); err != nil {
+		return err
+	}
+	s.entries[string(key)] = merkletree.Clone(entry)
+	return nil
+}
+
+// GetHasherName returns the name of the Hasher of the tree
+func (s *Storage) GetHasherName(_ context.Context) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.hasherName == "" {
+		return "", merkletree.ErrNotFound
+	}
+	return s.hasherName, nil
+}
+
+// SetHasherName stores the name of the Hasher of the tree. Like the nodes,
+// it's synced to the file with the next root, or when the Storage is closed.
+func (s *Storage) SetHasherName(_ context.Context, name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	record := appendBytes(s.newRecord(recordHasher), []byte(name))
+	if _, err := s.w.Write(record); err != nil {
+		return err
+	}
+	s.hasherName = name
+	return nil
+}
+
+// GetLeafCount returns the number of leafs under the given root
+func (s *Storage) GetLeafCount(_ context.Context,
+	root *merkletree.Hash) (uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if count, ok := s.leafCounts[*root]; ok {
+		return count, nil
+	}
+	return 0, merkletree.ErrNotFound
+}
+
+// SetLeafCount stores the number of leafs under the given root. Like the
+// nodes, it's synced to the file with the next root, or when the Storage is
+// closed.
+func (s *Storage) SetLeafCount(_ context.Context, root *merkletree.Hash,
+	count uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	record := append(s.newRecord(recordLeafCount), root[:]...)
+	record = appendUvarint(record, count)
+	if _, err := s.w.Write(record); err != nil {
+		return err
+	}
+	s.leafCounts[*root] = count
+	return nil
+}
+
+// ListNodes calls f for each node of the tree in the db.Storage, sorted by key
+func (s *Storage) ListNodes(ctx context.Context,
+	f func(key []byte, n *merkletree.Node) error) error {
+	s.mu.Lock()
+	kvs := make([]merkletree.KV, 0, len(s.kv))
+	for _, kv := range s.kv {
+		kvs = append(kvs, kv)
+	}
+	s.mu.Unlock()
+	sort.Slice(kvs, func(i, j int) bool {
+		return bytes.Compare(kvs[i].K, kvs[j].K) < 0
+	})
+	for i := range kvs {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := f(kvs[i].K, &kvs[i].V); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close flushes the pending writes and closes the file
+func (s *Storage) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.w.Flush(); err != nil {
+		_ = s.f.Close()
+		return err
+	}
+	return s.f.Close()
+}
+
+func (s *Storage) newRecord(kind byte) []byte {
+	return appendUvarint([]byte{kind}, s.mtId)
+}
+
+func appendBytes(b, v []byte) []byte {
+	b = appendUvarint(b, uint64(len(v)))
+	return append(b, v...)
+}
+
+func appendUvarint(b []byte, v uint64) []byte {
+	var buf [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(buf[:], v)
+	return append(b, buf[:n]...)
+}
+
+func readBytes(r *countingReader) ([]byte, error) {
+	l, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	if l > maxFieldLen {
+		return nil, fmt.Errorf("%w: field of %d bytes", ErrInvalidFile, l)
+	}
+	// a field longer than the rest of the file is a truncated record
+	if int64(l) > r.remaining-r.n {
+		return nil, io.ErrUnexpectedEOF
+	}
+	b := make([]byte, l)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	return b, nil
+}
+
+// unexpectedEOF converts io.EOF in the middle of a record to
+// io.ErrUnexpectedEOF
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// countingReader counts the bytes read
+type countingReader struct {
+	r *bufio.Reader
+	n int64
+	// remaining is the number of bytes that can be read
+	remaining int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.n += int64(n)
+	return n, err
+}
+
+func (r *countingReader) ReadByte() (byte, error) {
+	b, err := r.r.ReadByte()
+	if err == nil {
+		r.n++
+	}
+	return b, err
+}
@@ -0,0 +1,270 @@
+package file
+
+import (
+	"context"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/iden3/go-merkletree-sql/v2"
+	"github.com/iden3/go-merkletree-sql/v2/db/memory"
+	"github.com/iden3/go-merkletree-sql/v2/db/test"
+	"github.com/stretchr/testify/require"
+)
+
+type FileStorageBuilder struct{}
+
+func (builder *FileStorageBuilder) NewStorage(t *testing.T) merkletree.Storage {
+	s, err := NewFileStorage(filepath.Join(t.TempDir(), "mt.db"), 1)
+	require.NoError(t, err)
+	t.Cleanup(func() { require.NoError(t, s.Close()) })
+	return s
+}
+
+func TestAll(t *testing.T) {
+	builder := &FileStorageBuilder{}
+	test.TestAll(t, builder)
+}
+
+func TestReopen(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "mt.db")
+	s1, err := NewFileStorage(path, 1)
+	require.NoError(t, err)
+	mt1, err := merkletree.NewMerkleTree(ctx, s1, 40)
+	require.NoError(t, err)
+	for i := 0; i < 10; i++ {
+		err = mt1.Add(ctx, big.NewInt(int64(i)), big.NewInt(int64(i)))
+		require.NoError(t, err)
+	}
+	require.NoError(t, s1.Close())
+
+	// another tree in the same file
+	s2, err := NewFileStorage(path, 2)
+	require.NoError(t, err)
+	mt2, err := merkletree.NewMerkleTree(ctx, s2, 40)
+	require.NoError(t, err)
+	require.NoError(t, mt2.Add(ctx, big.NewInt(1), big.NewInt(2)))
+	require.NoError(t, s2.Close())
+
+	s1, err = NewFileStorage(path, 1)
+	require.NoError(t, err)
+	mt1Reopened, err := merkletree.NewMerkleTree(ctx, s1, 40)
+	require.NoError(t, err)
+	require.Equal(t, mt1.Root(), mt1Reopened.Root())
+	_, v, _, err := mt1Reopened.Get(ctx, big.NewInt(7))
+	require.NoError(t, err)
+	require.Equal(t, "7", v.String())
+	require.NoError(t, s1.Close())
+
+	s2, err = NewFileStorage(path, 2)
+	require.NoError(t, err)
+	root2, err := s2.GetRoot(ctx)
+	require.NoError(t, err)
+	require.Equal(t, mt2.Root(), root2)
+	require.NoError(t, s2.Close())
+}
+
+func TestTruncatedRecord(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "mt.db")
+	s, err := NewFileStorage(path, 1)
+	require.NoError(t, err)
+	mt, err := merkletree.NewMerkleTree(ctx, s, 40)
+	require.NoError(t, err)
+	require.NoError(t, mt.Add(ctx, big.NewInt(1), big.NewInt(2)))
+	require.NoError(t, s.Close())
+
+	// an interrupted write leaves a partial record at the end of the file
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+	require.NoError(t, err)
+	_, err = f.Write([]byte{recordNode, 1, 32, 0xff})
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	s, err = NewFileStorage(path, 1)
+	require.NoError(t, err)
+	root, err := s.GetRoot(ctx)
+	require.NoError(t, err)
+	require.Equal(t, mt.Root(), root)
+	require.NoError(t, s.SetRoot(ctx, root))
+	require.NoError(t, s.Close())
+
+	s, err = NewFileStorage(path, 1)
+	require.NoError(t, err)
+	require.NoError(t, s.Close())
+
+	require.NoError(t, os.WriteFile(path, []byte("not a tree"), 0o600))
+	_, err = NewFileStorage(path, 1)
+	require.ErrorIs(t, err, ErrInvalidFile)
+
+	// a corrupted length is rejected without allocating it
+	for _, l := range [][]byte{
+		{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x01},
+		{0x80, 0x80, 0x80, 0x10},
+	} {
+		record := append([]byte{recordNode, 1}, l...)
+		require.NoError(t, os.WriteFile(path, append(fileMagic, record...),
+			0o600))
+		_, err = NewFileStorage(path, 1)
+		require.ErrorIs(t, err, ErrInvalidFile)
+	}
+}
+
+func TestJournal(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "mt.journal")
+	j, err := NewFileJournal(path)
+	require.NoError(t, err)
+	mt, err := merkletree.NewMerkleTree(ctx, memory.NewMemoryStorage(), 10,
+		merkletree.WithJournal(j))
+	require.NoError(t, err)
+	for i := int64(1); i <= 3; i++ {
+		require.NoError(t, mt.Add(ctx, big.NewInt(i), big.NewInt(i*10)))
+	}
+	require.NoError(t, mt.Delete(ctx, big.NewInt(2)))
+	require.NoError(t, j.Close())
+
+	// a truncated record is discarded when the journal is opened
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	require.NoError(t, err)
+	_, err = f.Write([]byte{merkletree.FncUpdate, 1, 2, 3})
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	j, err = NewFileJournal(path)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, j.Close()) }()
+	replayed, err := merkletree.Replay(ctx, j, memory.NewMemoryStorage(), 10,
+		merkletree.WithJournal(j))
+	require.NoError(t, err)
+	require.Equal(t, mt.Root(), replayed.Root())
+
+	// the journal can be appended after reopening it
+	_, err = replayed.Update(ctx, big.NewInt(3), big.NewInt(31))
+	require.NoError(t, err)
+	replayed2, err := merkletree.Replay(ctx, j, memory.NewMemoryStorage(), 10)
+	require.NoError(t, err)
+	require.Equal(t, replayed.Root(), replayed2.Root())
+}
+
+func TestEntries(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "mt.db")
+	s, err := NewFileStorage(path, 1)
+	require.NoError(t, err)
+	mt, err := merkletree.NewMerkleTree(ctx, s, 40)
+	require.NoError(t, err)
+	e := &merkletree.Entry{}
+	e.Data[0] = merkletree.NewElemBytesFromBigInt(big.NewInt(1))
+	e.Data[4] = merkletree.NewElemBytesFromBigInt(big.NewInt(2))
+	require.NoError(t, mt.AddEntry(ctx, e))
+	ge := &merkletree.GenericEntry{
+		Index: []merkletree.ElemBytes{{1}, {2}, {3}},
+		Value: []merkletree.ElemBytes{{4}}}
+	require.NoError(t, mt.AddGenericEntry(ctx, ge))
+	require.NoError(t, s.Close())
+
+	s, err = NewFileStorage(path, 1)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, s.Close()) }()
+	mt, err = merkletree.NewMerkleTree(ctx, s, 40)
+	require.NoError(t, err)
+	hIndex, err := e.HIndex()
+	require.NoError(t, err)
+	got, err := mt.GetEntry(ctx, hIndex)
+	require.NoError(t, err)
+	require.True(t, e.Equal(got))
+	hIndex, err = ge.HIndex()
+	require.NoError(t, err)
+	gotGeneric, err := mt.GetGenericEntry(ctx, hIndex)
+	require.NoError(t, err)
+	require.True(t, ge.Equal(gotGeneric))
+}
+
+func TestLeafCount(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "mt.db")
+	s, err := NewFileStorage(path, 1)
+	require.NoError(t, err)
+	mt, err := merkletree.NewMerkleTree(ctx, s, 40)
+	require.NoError(t, err)
+	for i := int64(0); i < 5; i++ {
+		require.NoError(t, mt.Add(ctx, big.NewInt(i), big.NewInt(i)))
+	}
+	require.NoError(t, mt.Delete(ctx, big.NewInt(3)))
+	require.NoError(t, s.Close())
+
+	// the counts are stored, so they're read after reopening the file
+	s, err = NewFileStorage(path, 1)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, s.Close()) }()
+	count, err := s.GetLeafCount(ctx, mt.Root())
+	require.NoError(t, err)
+	require.Equal(t, uint64(4), count)
+	mt, err = merkletree.NewMerkleTree(ctx, s, 40)
+	require.NoError(t, err)
+	count, err = mt.Count(ctx)
+	require.NoError(t, err)
+	require.Equal(t, uint64(4), count)
+}
+
+func TestListRoots(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "mt.db")
+	s, err := NewFileStorage(path, 1)
+	require.NoError(t, err)
+	mt, err := merkletree.NewMerkleTree(ctx, s, 40)
+	require.NoError(t, err)
+	expected := []merkletree.Hash{*mt.Root()}
+	for i := int64(0); i < 3; i++ {
+		require.NoError(t, mt.Add(ctx, big.NewInt(i), big.NewInt(i)))
+		expected = append(expected, *mt.Root())
+	}
+	// setting the same root again doesn't add it to the history
+	require.NoError(t, s.SetRoot(ctx, mt.Root()))
+	require.NoError(t, s.Close())
+
+	s, err = NewFileStorage(path, 1)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, s.Close()) }()
+	var roots []merkletree.Hash
+	require.NoError(t, s.ListRoots(ctx, func(root *merkletree.Hash) error {
+		roots = append(roots, *root)
+		return nil
+	}))
+	require.Equal(t, expected, roots)
+}
+
+func TestHasherName(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "mt.db")
+	s, err := NewFileStorage(path, 1)
+	require.NoError(t, err)
+	mt, err := merkletree.NewMerkleTree(ctx, s, 40,
+		merkletree.WithHasher(merkletree.Keccak256Hasher{}))
+	require.NoError(t, err)
+	require.NoError(t, mt.Add(ctx, big.NewInt(1), big.NewInt(2)))
+	require.NoError(t, s.Close())
+
+	// the hasher is stored, so it's used after reopening the file
+	s, err = NewFileStorage(path, 1)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, s.Close()) }()
+	name, err := s.GetHasherName(ctx)
+	require.NoError(t, err)
+	require.Equal(t, "keccak256", name)
+	mt2, err := merkletree.NewMerkleTree(ctx, s, 40)
+	require.NoError(t, err)
+	require.Equal(t, "keccak256", mt2.Hasher().Name())
+	report, err := mt2.Check(ctx, nil)
+	require.NoError(t, err)
+	require.True(t, report.OK())
+
+	other, err := NewFileStorage(filepath.Join(t.TempDir(), "other.db"), 2)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, other.Close()) }()
+	_, err = other.GetHasherName(ctx)
+	require.ErrorIs(t, err, merkletree.ErrNotFound)
+}
@@ -0,0 +1,169 @@
+package file
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/iden3/go-merkletree-sql/v2"
+)
+
+var journalMagic = []byte("\x89MTJRNL\n")
+
+// Journal implements the merkletree.Journal interface in a local file. Each
+// record is written as: op (1 byte) | key (32 bytes) | root (32 bytes) |
+// value (32 bytes, omitted for merkletree.FncDelete).
+type Journal struct {
+	mu   sync.Mutex
+	f    *os.File
+	size int64
+}
+
+// NewFileJournal opens the journal file at path, creating it if it doesn't
+// exist. Each record is synced to the file when it's appended. The Journal
+// must be closed with Close.
+func NewFileJournal(path string) (*Journal, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	j := &Journal{f: f}
+	if err := j.load(); err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	return j, nil
+}
+
+// load checks the records of the file, to find its end. A truncated record at
+// the end of the file, left by an interrupted write, is discarded.
+func (j *Journal) load() error {
+	r := bufio.NewReader(j.f)
+	magic := make([]byte, len(journalMagic))
+	n, err := io.ReadFull(r, magic)
+	if n == 0 && err == io.EOF {
+		if _, err := j.f.Write(journalMagic); err != nil {
+			return err
+		}
+		j.size = int64(len(journalMagic))
+		return j.f.Sync()
+	} else if err != nil || !bytes.Equal(magic, journalMagic) {
+		return ErrInvalidFile
+	}
+
+	j.size = int64(len(journalMagic))
+	for {
+		record, err := readJournalRecord(r)
+		if err == io.EOF {
+			break
+		} else if err == io.ErrUnexpectedEOF {
+			if err := j.f.Truncate(j.size); err != nil {
+				return err
+			}
+			break
+		} else if err != nil {
+			return err
+		}
+		j.size += journalRecordLen(record.Op)
+	}
+	_, err = j.f.Seek(j.size, io.SeekStart)
+	return err
+}
+
+// Append appends a record to the Journal
+func (j *Journal) Append(_ context.Context, op int, key, value,
+	root *merkletree.Hash) error {
+	record := make([]byte, 0, journalRecordLen(op))
+	record = append(record, byte(op))
+	record = append(record, key[:]...)
+	record = append(record, root[:]...)
+	if op != merkletree.FncDelete {
+		record = append(record, value[:]...)
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if _, err := j.f.Write(record); err != nil {
+		// discard a partial record
+		_ = j.f.Truncate(j.size)
+		_, _ = j.f.Seek(j.size, io.SeekStart)
+		return err
+	}
+	if err := j.f.Sync(); err != nil {
+		return err
+	}
+	j.size += int64(len(record))
+	return nil
+}
+
+// Records calls f with each record of the Journal, in the order they were
+// appended. The records appended while Records runs are not included.
+func (j *Journal) Records(ctx context.Context,
+	f func(op int, key, value, root *merkletree.Hash) error) error {
+	j.mu.Lock()
+	size := j.size
+	j.mu.Unlock()
+	r := bufio.NewReader(io.NewSectionReader(j.f, int64(len(journalMagic)),
+		size-int64(len(journalMagic))))
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		record, err := readJournalRecord(r)
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if err := f(record.Op, record.Key, record.Value,
+			record.Root); err != nil {
+			return err
+		}
+	}
+}
+
+// Close closes the file of the Journal
+func (j *Journal) Close() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.f.Close()
+}
+
+// journalRecordLen returns the length of the records of the given op.
+func journalRecordLen(op int) int64 {
+	l := int64(1 + 2*len(merkletree.Hash{}))
+	if op != merkletree.FncDelete {
+		l += int64(len(merkletree.Hash{}))
+	}
+	return l
+}
+
+// readJournalRecord reads a record of a journal file.
+func readJournalRecord(r *bufio.Reader) (*merkletree.JournalRecord, error) {
+	op, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	record := &merkletree.JournalRecord{Op: int(op)}
+	switch record.Op {
+	case merkletree.FncInsert, merkletree.FncUpdate, merkletree.FncDelete:
+	default:
+		return nil, fmt.Errorf("%w: unknown journal record %#x",
+			ErrInvalidFile, op)
+	}
+	hashes := []**merkletree.Hash{&record.Key, &record.Root}
+	if record.Op != merkletree.FncDelete {
+		hashes = append(hashes, &record.Value)
+	}
+	for _, h := range hashes {
+		*h = &merkletree.Hash{}
+		if _, err := io.ReadFull(r, (*h)[:]); err != nil {
+			return nil, unexpectedEOF(err)
+		}
+	}
+	return record, nil
+}
@@ -0,0 +1,56 @@
+package memory
+
+import (
+	"context"
+	"sync"
+
+	"github.com/iden3/go-merkletree-sql/v2"
+)
+
+// Journal implements the merkletree.Journal interface in memory
+type Journal struct {
+	mu      sync.Mutex
+	records []merkletree.JournalRecord
+}
+
+// NewMemoryJournal returns a new Journal
+func NewMemoryJournal() *Journal {
+	return &Journal{}
+}
+
+// Append appends a record to the Journal
+func (j *Journal) Append(_ context.Context, op int, key, value,
+	root *merkletree.Hash) error {
+	record := merkletree.JournalRecord{Op: op, Key: cloneHash(key),
+		Value: cloneHash(value), Root: cloneHash(root)}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.records = append(j.records, record)
+	return nil
+}
+
+// Records calls f with each record of the Journal, in the order they were
+// appended. The records appended while Records runs are not included.
+func (j *Journal) Records(ctx context.Context,
+	f func(op int, key, value, root *merkletree.Hash) error) error {
+	j.mu.Lock()
+	records := j.records[:len(j.records):len(j.records)]
+	j.mu.Unlock()
+	for _, r := range records {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := f(r.Op, r.Key, r.Value, r.Root); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func cloneHash(h *merkletree.Hash) *merkletree.Hash {
+	if h == nil {
+		return nil
+	}
+	c := *h
+	return &c
+}
@@ -1,7 +1,9 @@
 package memory
 
 import (
+	"bytes"
 	"context"
+	"sort"
 
 	"github.com/iden3/go-merkletree-sql/v2"
 )
@@ -11,12 +13,17 @@ type Storage struct {
 	prefix      []byte
 	kv          merkletree.KvMap
 	currentRoot *merkletree.Hash
+	leafCounts  map[merkletree.Hash]uint64
+	entries     map[string][]byte
+	roots       []merkletree.Hash
+	hasherName  string
 }
 
 // NewMemoryStorage returns a new Storage
 func NewMemoryStorage() *Storage {
 	kvmap := make(merkletree.KvMap)
-	return &Storage{[]byte{}, kvmap, nil}
+	return &Storage{[]byte{}, kvmap, nil, make(map[merkletree.Hash]uint64),
+		make(map[string][]byte), nil, ""}
 }
 
 // Get retrieves a value from a key in the db.Storage
@@ -49,5 +56,90 @@ func (m *Storage) SetRoot(_ context.Context, hash *merkletree.Hash) error {
 	root := &merkletree.Hash{}
 	copy(root[:], hash[:])
 	m.currentRoot = root
+	if len(m.roots) == 0 || m.roots[len(m.roots)-1] != *root {
+		m.roots = append(m.roots, *root)
+	}
+	return nil
+}
+
+// ListRoots calls f for each root set in the db.Storage, oldest first
+func (m *Storage) ListRoots(ctx context.Context,
+	f func(root *merkletree.Hash) error) error {
+	for i := range m.roots {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		root := m.roots[i]
+		if err := f(&root); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetHasherName returns the name of the Hasher of the merkletree
+func (m *Storage) GetHasherName(_ context.Context) (string, error) {
+	if m.hasherName == "" {
+		return "", merkletree.ErrNotFound
+	}
+	return m.hasherName, nil
+}
+
+// SetHasherName stores the name of the Hasher of the merkletree
+func (m *Storage) SetHasherName(_ context.Context, name string) error {
+	m.hasherName = name
+	return nil
+}
+
+// GetLeafCount returns the number of leafs under the given root
+func (m *Storage) GetLeafCount(_ context.Context,
+	root *merkletree.Hash) (uint64, error) {
+	if count, ok := m.leafCounts[*root]; ok {
+		return count, nil
+	}
+	return 0, merkletree.ErrNotFound
+}
+
+// SetLeafCount stores the number of leafs under the given root
+func (m *Storage) SetLeafCount(_ context.Context, root *merkletree.Hash,
+	count uint64) error {
+	m.leafCounts[*root] = count
+	return nil
+}
+
+// GetEntry returns the entry stored under the key of its leaf
+func (m *Storage) GetEntry(_ context.Context, key []byte) ([]byte, error) {
+	if e, ok := m.entries[string(merkletree.Concat(m.prefix, key))]; ok {
+		return merkletree.Clone(e), nil
+	}
+	return nil, merkletree.ErrNotFound
+}
+
+// PutEntry stores an entry under the key of its leaf
+func (m *Storage) PutEntry(_ context.Context, key []byte, entry []byte) error {
+	m.entries[string(merkletree.Concat(m.prefix, key))] = merkletree.Clone(entry)
+	return nil
+}
+
+// ListNodes calls f for each node in the db.Storage, sorted by key
+func (m *Storage) ListNodes(ctx context.Context,
+	f func(key []byte, n *merkletree.Node) error) error {
+	kvs := make([]merkletree.KV, 0, len(m.kv))
+	for _, kv := range m.kv {
+		if bytes.HasPrefix(kv.K, m.prefix) {
+			kvs = append(kvs, kv)
+		}
+	}
+	sort.Slice(kvs, func(i, j int) bool {
+		return bytes.Compare(kvs[i].K, kvs[j].K) < 0
+	})
+	for i := range kvs {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := f(kvs[i].K[len(m.prefix):], &kvs[i].V); err != nil {
+			return err
+		}
+	}
 	return nil
 }
@@ -0,0 +1,40 @@
+package sql
+
+import (
+	"context"
+	"errors"
+
+	"github.com/iden3/go-merkletree-sql/v2"
+	pgx "github.com/jackc/pgx/v4"
+)
+
+// Entries are never modified once stored, as their key depends on them
+const putEntryStmt = `INSERT INTO mt_entries (mt_id, key, data) VALUES ($1, $2, $3) ` +
+	`ON CONFLICT (mt_id, key) DO NOTHING`
+
+type EntryItem struct {
+	MTId      uint64  `db:"mt_id"`
+	Key       []byte  `db:"key"`
+	Data      []byte  `db:"data"`
+	CreatedAt *uint64 `db:"created_at"`
+}
+
+// GetEntry returns the entry stored under the key of its leaf
+func (s *Storage) GetEntry(ctx context.Context, key []byte) ([]byte, error) {
+	item := EntryItem{}
+	row := s.db.QueryRow(ctx, `SELECT mt_id, key, data, created_at
+		FROM mt_entries WHERE mt_id = $1 AND key = $2`, s.mtId, key)
+	err := row.Scan(&item.MTId, &item.Key, &item.Data, &item.CreatedAt)
+	if err != nil && errors.Is(err, pgx.ErrNoRows) {
+		return nil, merkletree.ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	return item.Data, nil
+}
+
+// PutEntry stores an entry under the key of its leaf
+func (s *Storage) PutEntry(ctx context.Context, key []byte, entry []byte) error {
+	_, err := s.db.Exec(ctx, putEntryStmt, s.mtId, key, entry)
+	return err
+}
@@ -0,0 +1,30 @@
+package sql
+
+import (
+	"context"
+	"errors"
+
+	"github.com/iden3/go-merkletree-sql/v2"
+	pgx "github.com/jackc/pgx/v4"
+)
+
+const setHasherNameStmt = `INSERT INTO mt_hashers (mt_id, name) VALUES ($1, $2) ` +
+	`ON CONFLICT (mt_id) DO UPDATE SET name = $2`
+
+// GetHasherName returns the name of the Hasher of the merkletree
+func (s *Storage) GetHasherName(ctx context.Context) (string, error) {
+	var name string
+	err := s.db.QueryRow(ctx,
+		"SELECT name FROM mt_hashers WHERE mt_id = $1",
+		s.mtId).Scan(&name)
+	if err != nil && errors.Is(err, pgx.ErrNoRows) {
+		return "", merkletree.ErrNotFound
+	}
+	return name, err
+}
+
+// SetHasherName stores the name of the Hasher of the merkletree
+func (s *Storage) SetHasherName(ctx context.Context, name string) error {
+	_, err := s.db.Exec(ctx, setHasherNameStmt, s.mtId, name)
+	return err
+}
@@ -0,0 +1,110 @@
+package sql
+
+import (
+	"context"
+
+	"github.com/iden3/go-merkletree-sql/v2"
+)
+
+// The seq of the records is assigned by the database, so concurrent appends
+// never get the same one. It's increasing but not contiguous for each mt_id.
+const appendJournalStmt = `
+INSERT INTO mt_journal (mt_id, op, key, value, root)
+VALUES ($1, $2, $3, $4, $5)`
+
+// journalPageSize is the number of records read per query by Records
+const journalPageSize = 1000
+
+// Journal implements the merkletree.Journal interface in the mt_journal
+// table
+type Journal struct {
+	db   DB
+	mtId uint64
+}
+
+type JournalItem struct {
+	MTId      uint64  `db:"mt_id"`
+	Seq       uint64  `db:"seq"`
+	Op        int     `db:"op"`
+	Key       []byte  `db:"key"`
+	Value     []byte  `db:"value"`
+	Root      []byte  `db:"root"`
+	CreatedAt *uint64 `db:"created_at"`
+}
+
+// NewSqlJournal returns a new Journal of the tree with the given mtId
+func NewSqlJournal(db DB, mtId uint64) *Journal {
+	return &Journal{db: db, mtId: mtId}
+}
+
+// Append appends a record to the Journal
+func (j *Journal) Append(ctx context.Context, op int, key, value,
+	root *merkletree.Hash) error {
+	var valueB []byte
+	if value != nil {
+		valueB = value[:]
+	}
+	_, err := j.db.Exec(ctx, appendJournalStmt, j.mtId, op, key[:], valueB,
+		root[:])
+	return err
+}
+
+// Records calls f with each record of the Journal, in the order they were
+// appended. The records are read in pages, so f can use the same DB.
+func (j *Journal) Records(ctx context.Context,
+	f func(op int, key, value, root *merkletree.Hash) error) error {
+	var after uint64
+	for {
+		items, err := j.recordsPage(ctx, after)
+		if err != nil {
+			return err
+		}
+		for i := range items {
+			if err := items[i].call(f); err != nil {
+				return err
+			}
+		}
+		if len(items) < journalPageSize {
+			return nil
+		}
+		after = items[len(items)-1].Seq
+	}
+}
+
+// recordsPage returns the page of records with a seq greater than after
+func (j *Journal) recordsPage(ctx context.Context,
+	after uint64) ([]JournalItem, error) {
+	rows, err := j.db.Query(ctx, `
+SELECT mt_id, seq, op, key, value, root, created_at
+FROM mt_journal WHERE mt_id = $1 AND seq > $2 ORDER BY seq LIMIT $3`,
+		j.mtId, after, journalPageSize)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []JournalItem
+	for rows.Next() {
+		var item JournalItem
+		err = rows.Scan(&item.MTId, &item.Seq, &item.Op, &item.Key,
+			&item.Value, &item.Root, &item.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+// call calls f with the record of the JournalItem
+func (item *JournalItem) call(
+	f func(op int, key, value, root *merkletree.Hash) error) error {
+	var key, root merkletree.Hash
+	copy(key[:], item.Key)
+	copy(root[:], item.Root)
+	var value *merkletree.Hash
+	if item.Value != nil {
+		value = &merkletree.Hash{}
+		copy(value[:], item.Value)
+	}
+	return f(item.Op, &key, value, &root)
+}
@@ -0,0 +1,33 @@
+package sql
+
+import (
+	"context"
+	"errors"
+
+	"github.com/iden3/go-merkletree-sql/v2"
+	"github.com/jackc/pgx/v5"
+)
+
+const setLeafCountStmt = `
+INSERT INTO mt_leaf_counts (mt_id, root, count) VALUES ($1, $2, $3)
+ON CONFLICT (mt_id, root) DO UPDATE SET count = $3`
+
+// GetLeafCount returns the number of leafs under the given root
+func (s *Storage) GetLeafCount(ctx context.Context,
+	root *merkletree.Hash) (uint64, error) {
+	var count uint64
+	err := s.db.QueryRow(ctx,
+		`SELECT count FROM mt_leaf_counts WHERE mt_id = $1 AND root = $2`,
+		s.mtId, root[:]).Scan(&count)
+	if err != nil && errors.Is(err, pgx.ErrNoRows) {
+		return 0, merkletree.ErrNotFound
+	}
+	return count, err
+}
+
+// SetLeafCount stores the number of leafs under the given root
+func (s *Storage) SetLeafCount(ctx context.Context, root *merkletree.Hash,
+	count uint64) error {
+	_, err := s.db.Exec(ctx, setLeafCountStmt, s.mtId, root[:], count)
+	return err
+}
@@ -109,6 +109,59 @@ func (s *Storage) Put(ctx context.Context, key []byte,
 	return err
 }
 
+// listNodesPageSize is the number of nodes read per query by ListNodes
+const listNodesPageSize = 1000
+
+// ListNodes calls f for each node of the tree in the db.Storage, sorted by
+// key. The nodes are read in pages, so f can use the same DB.
+func (s *Storage) ListNodes(ctx context.Context,
+	f func(key []byte, n *merkletree.Node) error) error {
+	after := []byte{}
+	for {
+		items, err := s.listNodesPage(ctx, after)
+		if err != nil {
+			return err
+		}
+		for i := range items {
+			node, err := items[i].Node()
+			if err != nil {
+				return err
+			}
+			if err := f(items[i].Key, node); err != nil {
+				return err
+			}
+		}
+		if len(items) < listNodesPageSize {
+			return nil
+		}
+		after = items[len(items)-1].Key
+	}
+}
+
+// listNodesPage returns the page of nodes with a key greater than after
+func (s *Storage) listNodesPage(ctx context.Context,
+	after []byte) ([]NodeItem, error) {
+	rows, err := s.db.Query(ctx, `
+SELECT mt_id, key, type, child_l, child_r, entry, created_at, deleted_at
+FROM mt_nodes WHERE mt_id = $1 AND key > $2 ORDER BY key LIMIT $3`,
+		s.mtId, after, listNodesPageSize)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []NodeItem
+	for rows.Next() {
+		var item NodeItem
+		err = rows.Scan(&item.MTId, &item.Key, &item.Type, &item.ChildL,
+			&item.ChildR, &item.Entry, &item.CreatedAt, &item.DeletedAt)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
 // GetRoot retrieves a merkle tree root hash in the interface db.Tx
 func (s *Storage) GetRoot(ctx context.Context) (*merkletree.Hash, error) {
 	var root merkletree.Hash
@@ -1,8 +1,10 @@
 package sql
 
 import (
+	"context"
 	"errors"
 	"io"
+	"sync"
 	"sync/atomic"
 	"testing"
 
@@ -44,3 +46,137 @@ func TestErrors(t *testing.T) {
 	require.EqualError(t, err, "storage error: EOF")
 	require.Equal(t, io.EOF, errors.Unwrap(err))
 }
+
+func TestJournal(t *testing.T) {
+	ctx := context.Background()
+	db := dbPool.WithEmpty(t)
+	mtId := atomic.AddUint64(&maxMTId, 1)
+	j := NewSqlJournal(db, mtId)
+	other := NewSqlJournal(db, mtId+1000)
+
+	type record struct {
+		op               int
+		key, value, root *merkletree.Hash
+	}
+	// the ops are insert (2) and delete (3)
+	var expected []record
+	for i := 0; i < 3; i++ {
+		r := record{op: 2, key: &merkletree.Hash{byte(i)},
+			value: &merkletree.Hash{byte(i), 1},
+			root:  &merkletree.Hash{byte(i), 2}}
+		if i == 2 {
+			r.op = 3
+			r.value = nil
+		}
+		require.NoError(t, j.Append(ctx, r.op, r.key, r.value, r.root))
+		expected = append(expected, r)
+	}
+	require.NoError(t, other.Append(ctx, 2,
+		&merkletree.Hash{9}, &merkletree.Hash{9}, &merkletree.Hash{9}))
+
+	var got []record
+	err := j.Records(ctx, func(op int, key, value, root *merkletree.Hash) error {
+		got = append(got, record{op, key, value, root})
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, expected, got)
+}
+
+func TestEntries(t *testing.T) {
+	ctx := context.Background()
+	db := dbPool.WithEmpty(t)
+	mtId := atomic.AddUint64(&maxMTId, 1)
+	s := NewSqlStorage(db, mtId)
+	other := NewSqlStorage(db, mtId+1000)
+
+	// the entries are opaque to the storage, and can have any length
+	entry := []byte("0102:03")
+	key := []byte{1, 2, 3}
+	require.NoError(t, s.PutEntry(ctx, key, entry))
+	// storing the same entry again is a no-op
+	require.NoError(t, s.PutEntry(ctx, key, entry))
+
+	got, err := s.GetEntry(ctx, key)
+	require.NoError(t, err)
+	require.Equal(t, entry, got)
+
+	_, err = s.GetEntry(ctx, []byte{4})
+	require.ErrorIs(t, err, merkletree.ErrNotFound)
+	_, err = other.GetEntry(ctx, key)
+	require.ErrorIs(t, err, merkletree.ErrNotFound)
+}
+
+func TestJournalConcurrentAppend(t *testing.T) {
+	ctx := context.Background()
+	db := dbPool.WithEmpty(t)
+	j := NewSqlJournal(db, atomic.AddUint64(&maxMTId, 1))
+
+	const n = 20
+	var wg sync.WaitGroup
+	errs := make(chan error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			h := &merkletree.Hash{byte(i)}
+			errs <- j.Append(ctx, 2, h, h, h)
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		require.NoError(t, err)
+	}
+
+	seen := make(map[byte]bool)
+	err := j.Records(ctx, func(_ int, key, _, _ *merkletree.Hash) error {
+		seen[key[0]] = true
+		return nil
+	})
+	require.NoError(t, err)
+	require.Len(t, seen, n)
+}
+
+func TestLeafCount(t *testing.T) {
+	ctx := context.Background()
+	db := dbPool.WithEmpty(t)
+	mtId := atomic.AddUint64(&maxMTId, 1)
+	s := NewSqlStorage(db, mtId)
+	other := NewSqlStorage(db, mtId+1000)
+
+	root := &merkletree.Hash{1, 2, 3}
+	_, err := s.GetLeafCount(ctx, root)
+	require.ErrorIs(t, err, merkletree.ErrNotFound)
+
+	require.NoError(t, s.SetLeafCount(ctx, root, 7))
+	count, err := s.GetLeafCount(ctx, root)
+	require.NoError(t, err)
+	require.Equal(t, uint64(7), count)
+	require.NoError(t, s.SetLeafCount(ctx, root, 8))
+	count, err = s.GetLeafCount(ctx, root)
+	require.NoError(t, err)
+	require.Equal(t, uint64(8), count)
+
+	_, err = other.GetLeafCount(ctx, root)
+	require.ErrorIs(t, err, merkletree.ErrNotFound)
+}
+
+func TestHasherName(t *testing.T) {
+	ctx := context.Background()
+	db := dbPool.WithEmpty(t)
+	mtId := atomic.AddUint64(&maxMTId, 1)
+	s := NewSqlStorage(db, mtId)
+	other := NewSqlStorage(db, mtId+1000)
+
+	_, err := s.GetHasherName(ctx)
+	require.ErrorIs(t, err, merkletree.ErrNotFound)
+
+	require.NoError(t, s.SetHasherName(ctx, "keccak256"))
+	name, err := s.GetHasherName(ctx)
+	require.NoError(t, err)
+	require.Equal(t, "keccak256", name)
+
+	_, err = other.GetHasherName(ctx)
+	require.ErrorIs(t, err, merkletree.ErrNotFound)
+}
@@ -0,0 +1,31 @@
+package sql
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/iden3/go-merkletree-sql/v2"
+)
+
+const setLeafCountStmt = `INSERT INTO mt_leaf_counts (mt_id, root, count) VALUES ($1, $2, $3) ` +
+	`ON CONFLICT (mt_id, root) DO UPDATE SET count = $3`
+
+// GetLeafCount returns the number of leafs under the given root
+func (s *Storage) GetLeafCount(ctx context.Context,
+	root *merkletree.Hash) (uint64, error) {
+	var count uint64
+	err := s.db.GetContext(ctx, &count,
+		"SELECT count FROM mt_leaf_counts WHERE mt_id = $1 AND root = $2",
+		s.mtId, root[:])
+	if err == sql.ErrNoRows {
+		return 0, merkletree.ErrNotFound
+	}
+	return count, err
+}
+
+// SetLeafCount stores the number of leafs under the given root
+func (s *Storage) SetLeafCount(ctx context.Context, root *merkletree.Hash,
+	count uint64) error {
+	_, err := s.db.ExecContext(ctx, setLeafCountStmt, s.mtId, root[:], count)
+	return err
+}
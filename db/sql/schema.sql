@@ -16,3 +16,34 @@ CREATE TABLE mt_roots (
     created_at BIGINT,
     deleted_at BIGINT
 );
+
+CREATE TABLE mt_journal (
+    mt_id BIGINT,
+    seq BIGSERIAL,
+    op SMALLINT NOT NULL,
+    key BYTEA NOT NULL,
+    value BYTEA,
+    root BYTEA NOT NULL,
+    created_at BIGINT,
+    PRIMARY KEY(mt_id, seq)
+);
+
+CREATE TABLE mt_entries (
+    mt_id BIGINT,
+    key BYTEA,
+    data BYTEA NOT NULL,
+    created_at BIGINT,
+    PRIMARY KEY(mt_id, key)
+);
+
+CREATE TABLE mt_leaf_counts (
+    mt_id BIGINT,
+    root BYTEA,
+    count BIGINT NOT NULL,
+    PRIMARY KEY(mt_id, root)
+);
+
+CREATE TABLE mt_hashers (
+    mt_id BIGINT PRIMARY KEY,
+    name TEXT NOT NULL
+);
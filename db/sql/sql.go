@@ -96,6 +96,38 @@ func (s *Storage) Put(ctx context.Context, key []byte,
 	return err
 }
 
+// listNodesPageSize is the number of nodes read per query by ListNodes
+const listNodesPageSize = 1000
+
+// ListNodes calls f for each node of the tree in the db.Storage, sorted by
+// key. The nodes are read in pages, so f can use the same DB.
+func (s *Storage) ListNodes(ctx context.Context,
+	f func(key []byte, n *merkletree.Node) error) error {
+	after := []byte{}
+	for {
+		var items []NodeItem
+		err := s.db.SelectContext(ctx, &items,
+			"SELECT * FROM mt_nodes WHERE mt_id = $1 AND key > $2 ORDER BY key LIMIT $3",
+			s.mtId, after, listNodesPageSize)
+		if err != nil {
+			return err
+		}
+		for i := range items {
+			node, err := items[i].Node()
+			if err != nil {
+				return err
+			}
+			if err := f(items[i].Key, node); err != nil {
+				return err
+			}
+		}
+		if len(items) < listNodesPageSize {
+			return nil
+		}
+		after = items[len(items)-1].Key
+	}
+}
+
 // GetRoot retrieves a merkle tree root hash in the interface db.Tx
 func (s *Storage) GetRoot(ctx context.Context) (*merkletree.Hash, error) {
 	var root merkletree.Hash
@@ -0,0 +1,218 @@
+package merkletree
+
+import (
+	"context"
+)
+
+// DiffKind is the kind of change of a leaf between two roots.
+type DiffKind int
+
+const (
+	// DiffAdded is a leaf that only exists under the new root.
+	DiffAdded DiffKind = iota + 1
+	// DiffRemoved is a leaf that only exists under the old root.
+	DiffRemoved
+	// DiffModified is a leaf that exists under both roots with different
+	// values.
+	DiffModified
+)
+
+// DiffEntry is a change of a leaf between two roots. OldValue is nil for
+// DiffAdded, and NewValue is nil for DiffRemoved.
+type DiffEntry struct {
+	Kind     DiffKind
+	Key      *Hash
+	OldValue *Hash
+	NewValue *Hash
+}
+
+// DiffIterator iterates over the changes of the leafs between two roots of a
+// MerkleTree, in path order. It's used in the same way as a LeafIterator.
+type DiffIterator struct {
+	ctx   context.Context
+	mt    *MerkleTree
+	stack []diffItem
+	// pending contains the entries found and not returned yet, in reverse
+	// order
+	pending []*DiffEntry
+	entry   *DiffEntry
+	err     error
+}
+
+// diffItem is a pair of subtrees, under the old and the new root, pending to
+// be compared.
+type diffItem struct {
+	old, new diffRef
+	depth    int
+}
+
+// diffRef references a subtree by its key. n is set when the node is already
+// known, for example when a leaf is pushed down a level to be compared with a
+// middle node.
+type diffRef struct {
+	key *Hash
+	n   *Node
+}
+
+// Diff returns a DiffIterator over the leafs that were added, removed or
+// modified from rootA to rootB. Subtrees with the same key under both roots
+// are skipped, so only the nodes that changed are read. If a root is nil, the
+// current Root of the MerkleTree is used.
+func (mt *MerkleTree) Diff(ctx context.Context, rootA, rootB *Hash) *DiffIterator {
+	if rootA == nil {
+		rootA = mt.Root()
+	}
+	if rootB == nil {
+		rootB = mt.Root()
+	}
+	return &DiffIterator{
+		ctx:   ctx,
+		mt:    mt,
+		stack: []diffItem{{old: diffRef{key: rootA}, new: diffRef{key: rootB}}},
+	}
+}
+
+// Next advances the iterator to the next change, and returns whether there is
+// one. It returns false at the end of the changes or if an error is found,
+// which is returned by Err.
+func (it *DiffIterator) Next() bool {
+	it.entry = nil
+	if it.err != nil {
+		return false
+	}
+	for len(it.pending) == 0 && len(it.stack) > 0 {
+		item := it.stack[len(it.stack)-1]
+		it.stack = it.stack[:len(it.stack)-1]
+		if it.err = it.step(item); it.err != nil {
+			return false
+		}
+	}
+	if len(it.pending) == 0 {
+		return false
+	}
+	it.entry = it.pending[len(it.pending)-1]
+	it.pending = it.pending[:len(it.pending)-1]
+	return true
+}
+
+// step compares a pair of subtrees, adding the changes found to pending, or
+// pushing the pairs of children to the stack.
+func (it *DiffIterator) step(item diffItem) error {
+	if item.old.key.Equals(item.new.key) {
+		return nil
+	}
+	if err := it.ctx.Err(); err != nil {
+		return err
+	}
+	nOld, err := it.node(item.old)
+	if err != nil {
+		return err
+	}
+	nNew, err := it.node(item.new)
+	if err != nil {
+		return err
+	}
+	if nOld.Type != NodeTypeMiddle && nNew.Type != NodeTypeMiddle {
+		it.diffLeafs(nOld, nNew)
+		return nil
+	}
+	if item.depth >= it.mt.maxLevels {
+		return ErrReachedMaxLevel
+	}
+	oldL, oldR, err := diffChildren(item.old, nOld, item.depth)
+	if err != nil {
+		return err
+	}
+	newL, newR, err := diffChildren(item.new, nNew, item.depth)
+	if err != nil {
+		return err
+	}
+	it.stack = append(it.stack,
+		diffItem{old: oldR, new: newR, depth: item.depth + 1},
+		diffItem{old: oldL, new: newL, depth: item.depth + 1})
+	return nil
+}
+
+// diffLeafs adds to pending the changes between two nodes that are leafs or
+// empty.
+func (it *DiffIterator) diffLeafs(nOld, nNew *Node) {
+	var entries []*DiffEntry
+	switch {
+	case nOld.Type == NodeTypeLeaf && nNew.Type == NodeTypeLeaf &&
+		nOld.Entry[0].Equals(nNew.Entry[0]):
+		if !nOld.Entry[1].Equals(nNew.Entry[1]) {
+			entries = append(entries, &DiffEntry{Kind: DiffModified,
+				Key: nOld.Entry[0], OldValue: nOld.Entry[1],
+				NewValue: nNew.Entry[1]})
+		}
+	default:
+		if nOld.Type == NodeTypeLeaf {
+			entries = append(entries, &DiffEntry{Kind: DiffRemoved,
+				Key: nOld.Entry[0], OldValue: nOld.Entry[1]})
+		}
+		if nNew.Type == NodeTypeLeaf {
+			entries = append(entries, &DiffEntry{Kind: DiffAdded,
+				Key: nNew.Entry[0], NewValue: nNew.Entry[1]})
+		}
+		if len(entries) == 2 && pathAfter(entries[0].Key, entries[1].Key,
+			it.mt.maxLevels) {
+			entries[0], entries[1] = entries[1], entries[0]
+		}
+	}
+	// pending is in reverse order
+	for i := len(entries) - 1; i >= 0; i-- {
+		it.pending = append(it.pending, entries[i])
+	}
+}
+
+// node returns the node referenced by ref.
+func (it *DiffIterator) node(ref diffRef) (*Node, error) {
+	if ref.n != nil {
+		return ref.n, nil
+	}
+	return it.mt.GetNode(it.ctx, ref.key)
+}
+
+// diffChildren returns the references to the children of a node at the given
+// depth. A leaf is pushed down to the child in its path, and the other child
+// is empty.
+func diffChildren(ref diffRef, n *Node, depth int) (diffRef, diffRef, error) {
+	empty := diffRef{key: &HashZero}
+	switch n.Type {
+	case NodeTypeEmpty:
+		return empty, empty, nil
+	case NodeTypeLeaf:
+		leaf := diffRef{key: ref.key, n: n}
+		if TestBit(n.Entry[0][:], uint(depth)) {
+			return empty, leaf, nil
+		}
+		return leaf, empty, nil
+	case NodeTypeMiddle:
+		return diffRef{key: n.ChildL}, diffRef{key: n.ChildR}, nil
+	default:
+		return empty, empty, ErrInvalidNodeFound
+	}
+}
+
+// Entry returns the current change of the iterator.
+func (it *DiffIterator) Entry() *DiffEntry {
+	return it.entry
+}
+
+// Err returns the error found during the iteration, if any.
+func (it *DiffIterator) Err() error {
+	return it.err
+}
+
+// All returns a function that yields the remaining changes, compatible with
+// iter.Seq[*DiffEntry], so it can be used in a range loop. The iteration stops
+// on the first error, which is returned by Err.
+func (it *DiffIterator) All() func(yield func(*DiffEntry) bool) {
+	return func(yield func(*DiffEntry) bool) {
+		for it.Next() {
+			if !yield(it.entry) {
+				return
+			}
+		}
+	}
+}
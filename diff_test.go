@@ -0,0 +1,94 @@
+package merkletree_test
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/iden3/go-merkletree-sql/v2"
+	"github.com/iden3/go-merkletree-sql/v2/db/memory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func collectDiff(t *testing.T, it *merkletree.DiffIterator) []merkletree.DiffEntry {
+	var entries []merkletree.DiffEntry
+	it.All()(func(e *merkletree.DiffEntry) bool {
+		entries = append(entries, *e)
+		return true
+	})
+	require.NoError(t, it.Err())
+	return entries
+}
+
+func TestDiff(t *testing.T) {
+	ctx := context.Background()
+	mt, err := merkletree.NewMerkleTree(ctx, memory.NewMemoryStorage(), 40)
+	require.NoError(t, err)
+	for i := 0; i < 32; i++ {
+		err = mt.Add(ctx, big.NewInt(int64(i)), big.NewInt(int64(i*2)))
+		require.NoError(t, err)
+	}
+	rootA := mt.Root()
+
+	require.NoError(t, mt.Delete(ctx, big.NewInt(3)))
+	_, err = mt.Update(ctx, big.NewInt(5), big.NewInt(55))
+	require.NoError(t, err)
+	require.NoError(t, mt.Add(ctx, big.NewInt(100), big.NewInt(1)))
+	rootB := mt.Root()
+
+	entries := collectDiff(t, mt.Diff(ctx, rootA, rootB))
+	require.Len(t, entries, 3)
+	byKey := make(map[string]merkletree.DiffEntry)
+	for _, e := range entries {
+		byKey[e.Key.String()] = e
+	}
+	assert.Equal(t, merkletree.DiffRemoved, byKey["3"].Kind)
+	assert.Equal(t, "6", byKey["3"].OldValue.String())
+	assert.Nil(t, byKey["3"].NewValue)
+	assert.Equal(t, merkletree.DiffModified, byKey["5"].Kind)
+	assert.Equal(t, "10", byKey["5"].OldValue.String())
+	assert.Equal(t, "55", byKey["5"].NewValue.String())
+	assert.Equal(t, merkletree.DiffAdded, byKey["100"].Kind)
+	assert.Nil(t, byKey["100"].OldValue)
+	assert.Equal(t, "1", byKey["100"].NewValue.String())
+
+	// the reverse diff has the opposite changes
+	reverse := collectDiff(t, mt.Diff(ctx, rootB, rootA))
+	require.Len(t, reverse, 3)
+	assert.Empty(t, collectDiff(t, mt.Diff(ctx, rootA, rootA)))
+}
+
+func TestDiffPushedDownLeaf(t *testing.T) {
+	ctx := context.Background()
+	mt, err := merkletree.NewMerkleTree(ctx, memory.NewMemoryStorage(), 40)
+	require.NoError(t, err)
+	require.NoError(t, mt.Add(ctx, big.NewInt(1), big.NewInt(10)))
+	require.NoError(t, mt.Add(ctx, big.NewInt(2), big.NewInt(20)))
+	rootA := mt.Root()
+
+	// 1 and 1+2^20 share the first 20 bits of the path, so the leaf of 1 is
+	// pushed down 20 levels
+	k := new(big.Int).Add(big.NewInt(1), new(big.Int).Lsh(big.NewInt(1), 20))
+	require.NoError(t, mt.Add(ctx, k, big.NewInt(30)))
+	rootB := mt.Root()
+
+	entries := collectDiff(t, mt.Diff(ctx, rootA, rootB))
+	require.Len(t, entries, 1)
+	assert.Equal(t, merkletree.DiffAdded, entries[0].Kind)
+	assert.Equal(t, 0, k.Cmp(entries[0].Key.BigInt()))
+
+	// the value of the pushed down leaf is modified
+	_, err = mt.Update(ctx, big.NewInt(1), big.NewInt(11))
+	require.NoError(t, err)
+	entries = collectDiff(t, mt.Diff(ctx, rootA, mt.Root()))
+	require.Len(t, entries, 2)
+	assert.Equal(t, merkletree.DiffModified, entries[0].Kind)
+	assert.Equal(t, "1", entries[0].Key.String())
+	assert.Equal(t, merkletree.DiffAdded, entries[1].Kind)
+
+	entries = collectDiff(t, mt.Diff(ctx, mt.Root(), rootA))
+	require.Len(t, entries, 2)
+	assert.Equal(t, merkletree.DiffModified, entries[0].Kind)
+	assert.Equal(t, merkletree.DiffRemoved, entries[1].Kind)
+}
@@ -0,0 +1,312 @@
+package merkletree
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+)
+
+// The leaf dump format written by DumpLeafsTo is:
+//
+//	header: magic (8 bytes) | version (1 byte) | maxLevels (2 bytes) |
+//	        hasher name length (1 byte) | hasher name | root (32 bytes)
+//	leafs:  dumpFrameLeaf (1 byte) | hIndex (32 bytes) | hValue (32 bytes)
+//	end:    dumpFrameEnd (1 byte) | number of leafs (8 bytes) |
+//	        sha256 of all the previous bytes (32 bytes)
+//
+// All the integers are big endian.
+const (
+	dumpVersion1  = 1
+	dumpFrameEnd  = 0x00
+	dumpFrameLeaf = 0x01
+)
+
+// dumpMagic identifies the leaf dump format. The legacy format of DumpLeafs
+// has no header.
+var dumpMagic = []byte("\x89MTLEAF\n")
+
+var (
+	// ErrInvalidDump is used when a leaf dump can't be decoded.
+	ErrInvalidDump = errors.New("invalid leaf dump")
+	// ErrDumpRootMismatch is used when the root of the tree rebuilt from a
+	// leaf dump doesn't match the root of the dump.
+	ErrDumpRootMismatch = errors.New("the imported tree root doesn't match the dump")
+	// ErrTreeNotEmpty is used when a leaf dump is imported into a tree that
+	// already contains leafs.
+	ErrTreeNotEmpty = errors.New("the tree is not empty")
+)
+
+// DumpLeafsTo writes to w all the leafs under the given Root in a versioned
+// format that includes the maxLevels, the Hasher and the root of the tree, and
+// a checksum. The leafs are streamed, so the dump is never held in memory. If
+// no Root is given (nil), it uses the current Root of the MerkleTree. The dump
+// can be imported with ImportLeafsFrom.
+func (mt *MerkleTree) DumpLeafsTo(ctx context.Context, w io.Writer,
+	rootKey *Hash) error {
+	if rootKey == nil {
+		rootKey = mt.Root()
+	}
+	name := mt.hasher.Name()
+	if len(name) > 0xff {
+		return fmt.Errorf("hasher name too long: %v", name)
+	}
+
+	bw := bufio.NewWriter(w)
+	sum := sha256.New()
+	dw := io.MultiWriter(bw, sum)
+	header := append([]byte{}, dumpMagic...)
+	header = append(header, dumpVersion1)
+	header = append(header, 0, 0)
+	binary.BigEndian.PutUint16(header[len(header)-2:], uint16(mt.maxLevels))
+	header = append(header, byte(len(name)))
+	header = append(header, name...)
+	header = append(header, rootKey[:]...)
+	if _, err := dw.Write(header); err != nil {
+		return err
+	}
+
+	it, err := mt.NewLeafIterator(ctx, rootKey, "")
+	if err != nil {
+		return err
+	}
+	var count uint64
+	frame := make([]byte, 1+2*len(Hash{}))
+	frame[0] = dumpFrameLeaf
+	for it.Next() {
+		copy(frame[1:], it.Leaf().HIndex[:])
+		copy(frame[1+len(Hash{}):], it.Leaf().HValue[:])
+		if _, err := dw.Write(frame); err != nil {
+			return err
+		}
+		count++
+	}
+	if err := it.Err(); err != nil {
+		return err
+	}
+
+	end := make([]byte, 1+8)
+	end[0] = dumpFrameEnd
+	binary.BigEndian.PutUint64(end[1:], count)
+	if _, err := dw.Write(end); err != nil {
+		return err
+	}
+	if _, err := bw.Write(sum.Sum(nil)); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// ImportLeafsFrom reads a leaf dump written by DumpLeafsTo and adds its leafs
+// to the MerkleTree, which must be empty. Once all the leafs are added, the
+// checksum and the leaf count of the dump are verified, and the root of the
+// MerkleTree is verified against the root of the dump. The root is only set
+// if the dump is valid, so a failed import leaves the MerkleTree empty. The
+// legacy format of DumpLeafs is also accepted, but as it contains no root, it
+// can't be verified.
+func (mt *MerkleTree) ImportLeafsFrom(ctx context.Context, r io.Reader) error {
+	// verify that the MerkleTree is writable
+	if !mt.writable {
+		return ErrNotWritable
+	}
+	br := bufio.NewReader(r)
+	magic, err := br.Peek(len(dumpMagic))
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return err
+	}
+	if !bytes.Equal(magic, dumpMagic) {
+		return mt.importLegacyLeafs(ctx, br)
+	}
+
+	d := &dumpReader{r: br, sum: sha256.New(), invalid: ErrInvalidDump}
+	d.read(len(dumpMagic))
+	if v := d.read(1); d.err == nil && v[0] != dumpVersion1 {
+		return fmt.Errorf("%w: unsupported version %d", ErrInvalidDump, v[0])
+	}
+	maxLevels := d.read(2)
+	nameLen := d.read(1)
+	if d.err != nil {
+		return d.err
+	}
+	name := d.read(int(nameLen[0]))
+	var root Hash
+	copy(root[:], d.read(len(Hash{})))
+	if d.err != nil {
+		return d.err
+	}
+	if int(binary.BigEndian.Uint16(maxLevels)) != mt.maxLevels {
+		return fmt.Errorf("%w: the dump has %d levels", ErrInvalidDump,
+			binary.BigEndian.Uint16(maxLevels))
+	}
+	if string(name) != mt.hasher.Name() {
+		return fmt.Errorf("%w: the dump uses hasher %v", ErrHasherMismatch,
+			string(name))
+	}
+
+	var count uint64
+	next := func() (*Hash, *Hash, error) {
+		tag := d.read(1)
+		if d.err != nil {
+			return nil, nil, d.err
+		}
+		if tag[0] == dumpFrameEnd {
+			return nil, nil, nil
+		} else if tag[0] != dumpFrameLeaf {
+			return nil, nil, fmt.Errorf("%w: unknown frame %#x",
+				ErrInvalidDump, tag[0])
+		}
+		var hIndex, hValue Hash
+		copy(hIndex[:], d.read(len(Hash{})))
+		copy(hValue[:], d.read(len(Hash{})))
+		if d.err != nil {
+			return nil, nil, d.err
+		}
+		count++
+		return &hIndex, &hValue, nil
+	}
+	verify := func(newRoot *Hash) error {
+		countB := d.read(8)
+		if d.err != nil {
+			return d.err
+		}
+		expectedSum := d.sum.Sum(nil)
+		sum := d.read(sha256.Size)
+		if d.err != nil {
+			return d.err
+		}
+		if !bytes.Equal(sum, expectedSum) {
+			return fmt.Errorf("%w: checksum mismatch", ErrInvalidDump)
+		}
+		if binary.BigEndian.Uint64(countB) != count {
+			return fmt.Errorf("%w: leaf count mismatch", ErrInvalidDump)
+		}
+		if !newRoot.Equals(&root) {
+			return ErrDumpRootMismatch
+		}
+		return nil
+	}
+	return mt.importLeafs(ctx, true, next, verify)
+}
+
+// importLegacyLeafs adds the leafs of a dump in the legacy format of
+// DumpLeafs, read in chunks. Like ImportLeafsFrom, the MerkleTree is not
+// modified if the dump is invalid.
+func (mt *MerkleTree) importLegacyLeafs(ctx context.Context,
+	r io.Reader) error {
+	leaf := make([]byte, 2*len(Hash{}))
+	next := func() (*Hash, *Hash, error) {
+		_, err := io.ReadFull(r, leaf)
+		if err == io.EOF {
+			return nil, nil, nil
+		} else if err == io.ErrUnexpectedEOF {
+			return nil, nil, errors.New("invalid input length")
+		} else if err != nil {
+			return nil, nil, err
+		}
+		var hIndex, hValue Hash
+		copy(hIndex[:], leaf[:len(Hash{})])
+		copy(hValue[:], leaf[len(Hash{}):])
+		return &hIndex, &hValue, nil
+	}
+	return mt.importLeafs(ctx, false, next, func(*Hash) error { return nil })
+}
+
+// importLeafs adds the leafs returned by next, until it returns a nil
+// hIndex, and then calls verify with the new root. The nodes are stored as
+// they are added, but the root is only set once verify succeeds, so a failed
+// import leaves the MerkleTree as it was. The insertion of each leaf is then
+// journaled and emitted as with Add. If requireEmpty is set, the MerkleTree
+// must be empty.
+func (mt *MerkleTree) importLeafs(ctx context.Context, requireEmpty bool,
+	next func() (*Hash, *Hash, error), verify func(root *Hash) error) error {
+	mt.Lock()
+	oldRoot := mt.rootKey
+	var events []Event
+	err := func() error {
+		if requireEmpty && !oldRoot.Equals(&HashZero) {
+			return ErrTreeNotEmpty
+		}
+		root := oldRoot
+		for {
+			hIndex, hValue, err := next()
+			if err != nil {
+				return err
+			}
+			if hIndex == nil {
+				break
+			}
+			// verify that the hashes fit inside the Finite Field
+			if _, err := NewHashFromBigInt(hIndex.BigInt()); err != nil {
+				return fmt.Errorf("can't create hash from Key: %w", err)
+			}
+			if _, err := NewHashFromBigInt(hValue.BigInt()); err != nil {
+				return fmt.Errorf("can't create hash from Value: %w", err)
+			}
+			path := getPath(mt.maxLevels, hIndex[:])
+			newRoot, err := mt.addLeaf(ctx, NewNodeLeaf(hIndex, hValue), root,
+				0, path)
+			if err != nil {
+				return err
+			}
+			events = append(events, Event{Op: FncInsert, Key: hIndex,
+				NewValue: hValue, OldRoot: root, NewRoot: newRoot})
+			root = newRoot
+		}
+		if err := verify(root); err != nil {
+			return err
+		}
+		mt.rootKey = root
+		return mt.db.SetRoot(ctx, root)
+	}()
+	if err != nil {
+		mt.rootKey = oldRoot
+		mt.Unlock()
+		return err
+	}
+	for i := range events {
+		if err = mt.appendJournal(ctx, events[i]); err != nil {
+			events = events[:i]
+			break
+		}
+	}
+	mt.Unlock()
+
+	for _, e := range events {
+		if modErr := mt.modified(ctx, e); err == nil {
+			err = modErr
+		}
+	}
+	return err
+}
+
+// dumpReader reads a leaf dump or an archive, computing the checksum of the
+// read bytes. The first error found is kept, so the fields can be read without
+// checking the error of each one. A premature end of the input is reported as
+// the invalid error.
+type dumpReader struct {
+	r       io.Reader
+	sum     hash.Hash
+	invalid error
+	err     error
+}
+
+func (d *dumpReader) read(n int) []byte {
+	b := make([]byte, n)
+	if d.err != nil {
+		return b
+	}
+	if _, err := io.ReadFull(d.r, b); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			err = fmt.Errorf("%w: unexpected end of input", d.invalid)
+		}
+		d.err = err
+		return b
+	}
+	d.sum.Write(b)
+	return b
+}
@@ -0,0 +1,142 @@
+package merkletree_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"math/big"
+	"testing"
+
+	"github.com/iden3/go-merkletree-sql/v2"
+	"github.com/iden3/go-merkletree-sql/v2/db/memory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDumpLeafsTo(t *testing.T) {
+	ctx := context.Background()
+	mt := newTestTree(t, memory.NewMemoryStorage(), 40, 20)
+
+	var buf bytes.Buffer
+	require.NoError(t, mt.DumpLeafsTo(ctx, &buf, nil))
+	// header + leafs + end
+	assert.Equal(t, 8+1+2+1+len("poseidon")+32+20*65+1+8+32, buf.Len())
+
+	mt2, err := merkletree.NewMerkleTree(ctx, memory.NewMemoryStorage(), 40)
+	require.NoError(t, err)
+	require.NoError(t, mt2.ImportLeafsFrom(ctx, bytes.NewReader(buf.Bytes())))
+	assert.Equal(t, mt.Root(), mt2.Root())
+
+	err = mt2.ImportLeafsFrom(ctx, bytes.NewReader(buf.Bytes()))
+	assert.ErrorIs(t, err, merkletree.ErrTreeNotEmpty)
+
+	// the dump of an old root
+	oldRoot := mt.Root()
+	require.NoError(t, mt.Delete(ctx, big.NewInt(4)))
+	var bufOld bytes.Buffer
+	require.NoError(t, mt.DumpLeafsTo(ctx, &bufOld, oldRoot))
+	assert.Equal(t, buf.Bytes(), bufOld.Bytes())
+}
+
+func TestImportLeafsFromInvalid(t *testing.T) {
+	ctx := context.Background()
+	mt := newTestTree(t, memory.NewMemoryStorage(), 40, 20)
+	var buf bytes.Buffer
+	require.NoError(t, mt.DumpLeafsTo(ctx, &buf, nil))
+	dump := buf.Bytes()
+
+	importDump := func(b []byte, maxLevels int) error {
+		mt2, err := merkletree.NewMerkleTree(ctx, memory.NewMemoryStorage(),
+			maxLevels)
+		require.NoError(t, err)
+		return mt2.ImportLeafsFrom(ctx, bytes.NewReader(b))
+	}
+
+	// corrupted value
+	corrupted := append([]byte{}, dump...)
+	corrupted[len(dump)-100] ^= 1
+	assert.ErrorIs(t, importDump(corrupted, 40), merkletree.ErrInvalidDump)
+	// truncated
+	assert.ErrorIs(t, importDump(dump[:len(dump)-10], 40),
+		merkletree.ErrInvalidDump)
+	// different levels
+	assert.ErrorIs(t, importDump(dump, 30), merkletree.ErrInvalidDump)
+
+	// a valid dump with a wrong root
+	headerLen := 8 + 1 + 2 + 1 + len("poseidon")
+	wrongRoot := append([]byte{}, dump[:len(dump)-sha256.Size]...)
+	wrongRoot[headerLen] ^= 1
+	sum := sha256.Sum256(wrongRoot)
+	wrongRoot = append(wrongRoot, sum[:]...)
+	assert.ErrorIs(t, importDump(wrongRoot, 40),
+		merkletree.ErrDumpRootMismatch)
+}
+
+func TestImportLeafsFromLegacy(t *testing.T) {
+	ctx := context.Background()
+	mt := newTestTree(t, memory.NewMemoryStorage(), 40, 20)
+	dump, err := mt.DumpLeafs(ctx, nil)
+	require.NoError(t, err)
+
+	mt2, err := merkletree.NewMerkleTree(ctx, memory.NewMemoryStorage(), 40)
+	require.NoError(t, err)
+	require.NoError(t, mt2.ImportLeafsFrom(ctx, bytes.NewReader(dump)))
+	assert.Equal(t, mt.Root(), mt2.Root())
+}
+
+func TestImportLeafsFromFailedLeavesTreeEmpty(t *testing.T) {
+	ctx := context.Background()
+	mt := newTestTree(t, memory.NewMemoryStorage(), 40, 20)
+	var buf bytes.Buffer
+	require.NoError(t, mt.DumpLeafsTo(ctx, &buf, nil))
+	dump := buf.Bytes()
+
+	headerLen := 8 + 1 + 2 + 1 + len("poseidon")
+	wrongRoot := append([]byte{}, dump[:len(dump)-sha256.Size]...)
+	wrongRoot[headerLen] ^= 1
+	sum := sha256.Sum256(wrongRoot)
+	wrongRoot = append(wrongRoot, sum[:]...)
+	badSum := append([]byte{}, dump...)
+	badSum[len(badSum)-1] ^= 1
+
+	sto := memory.NewMemoryStorage()
+	var events int
+	mt2, err := merkletree.NewMerkleTree(ctx, sto, 40,
+		merkletree.WithEventHook(func(context.Context, merkletree.Event) error {
+			events++
+			return nil
+		}))
+	require.NoError(t, err)
+
+	err = mt2.ImportLeafsFrom(ctx, bytes.NewReader(badSum))
+	assert.ErrorIs(t, err, merkletree.ErrInvalidDump)
+	err = mt2.ImportLeafsFrom(ctx, bytes.NewReader(wrongRoot))
+	assert.ErrorIs(t, err, merkletree.ErrDumpRootMismatch)
+	assert.Equal(t, &merkletree.HashZero, mt2.Root())
+	assert.Zero(t, events)
+
+	reopened, err := merkletree.NewMerkleTree(ctx, sto, 40)
+	require.NoError(t, err)
+	assert.Equal(t, &merkletree.HashZero, reopened.Root())
+
+	// a retry with the valid dump succeeds
+	require.NoError(t, mt2.ImportLeafsFrom(ctx, bytes.NewReader(dump)))
+	assert.Equal(t, mt.Root(), mt2.Root())
+	assert.Equal(t, 20, events)
+}
+
+func TestImportLeafsFromLegacyInvalid(t *testing.T) {
+	ctx := context.Background()
+	mt := newTestTree(t, memory.NewMemoryStorage(), 40, 20)
+	dump, err := mt.DumpLeafs(ctx, nil)
+	require.NoError(t, err)
+
+	mt2, err := merkletree.NewMerkleTree(ctx, memory.NewMemoryStorage(), 40)
+	require.NoError(t, err)
+	err = mt2.ImportLeafsFrom(ctx, bytes.NewReader(dump[:len(dump)-10]))
+	assert.Error(t, err)
+	assert.Equal(t, &merkletree.HashZero, mt2.Root())
+
+	require.NoError(t, mt2.ImportLeafsFrom(ctx, bytes.NewReader(dump)))
+	assert.Equal(t, mt.Root(), mt2.Root())
+}
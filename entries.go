@@ -0,0 +1,265 @@
+package merkletree
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+)
+
+var (
+	// ErrEntryNotFound is used when the entry of a leaf is not stored,
+	// because the leaf wasn't added with AddEntry or AddGenericEntry, or the
+	// Storage doesn't implement EntryStorage.
+	ErrEntryNotFound = errors.New("the entry of the leaf is not stored")
+	// ErrEntryMismatch is used when a stored Entry doesn't hash to its leaf.
+	ErrEntryMismatch = errors.New("the stored entry doesn't match the leaf")
+	// ErrEntryNotInField is used when the elements of an Entry don't fit
+	// inside the finite field.
+	ErrEntryNotInField = errors.New("Elements not inside the Finite Field over R")
+	// ErrEntryValueMismatch is used when the leaf of the index of an Entry
+	// has a different value than the Entry.
+	ErrEntryValueMismatch = errors.New("the leaf of the entry index has a different value")
+	// ErrEntryLayout is used when the stored entry of a leaf is a
+	// GenericEntry that doesn't have the layout of an Entry.
+	ErrEntryLayout = errors.New("the stored entry doesn't have the layout of an Entry")
+)
+
+// entryHiHv returns the HIndex and HValue of the Entry of e, once checked
+// that its elements fit inside the finite field.
+func entryHiHv(e Entrier) (*Hash, *Hash, error) {
+	entry := e.Entry()
+	if !CheckEntryInField(*entry) {
+		return nil, nil, ErrEntryNotInField
+	}
+	return entry.HiHv()
+}
+
+// putEntry stores the entry of the leaf of hIndex and hValue if the Storage
+// implements EntryStorage.
+func (mt *MerkleTree) putEntry(ctx context.Context, hIndex, hValue *Hash,
+	e *GenericEntry) error {
+	es, ok := mt.db.(EntryStorage)
+	if !ok {
+		return nil
+	}
+	key, err := LeafKeyWithHasher(mt.hasher, hIndex, hValue)
+	if err != nil {
+		return err
+	}
+	text, err := e.MarshalText()
+	if err != nil {
+		return err
+	}
+	return es.PutEntry(ctx, key[:], text)
+}
+
+// entryModified stores the entry of a modification once it's applied, and
+// then emits its Event, so the hooks can read the entry.
+func (mt *MerkleTree) entryModified(ctx context.Context, ev Event,
+	e *GenericEntry) error {
+	err := mt.putEntry(ctx, ev.Key, ev.NewValue, e)
+	if modErr := mt.modified(ctx, ev); err == nil {
+		err = modErr
+	}
+	return err
+}
+
+// leafEntry returns the stored entry of the leaf of hIndex and hValue.
+func (mt *MerkleTree) leafEntry(ctx context.Context, hIndex,
+	hValue *Hash) (*GenericEntry, error) {
+	es, ok := mt.db.(EntryStorage)
+	if !ok {
+		return nil, ErrEntryNotFound
+	}
+	key, err := LeafKeyWithHasher(mt.hasher, hIndex, hValue)
+	if err != nil {
+		return nil, err
+	}
+	text, err := es.GetEntry(ctx, key[:])
+	if errors.Is(err, ErrNotFound) {
+		return nil, ErrEntryNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	var e GenericEntry
+	if err := e.UnmarshalText(text); err != nil {
+		return nil, err
+	}
+	hi, hv, err := e.HiHv()
+	if err != nil {
+		return nil, err
+	}
+	if !hi.Equals(hIndex) || !hv.Equals(hValue) {
+		return nil, fmt.Errorf("%w: %v", ErrEntryMismatch, hIndex.BigInt())
+	}
+	return &e, nil
+}
+
+// leafGenericEntry returns the stored entry of the leaf with the given hIndex
+// under the current Root.
+func (mt *MerkleTree) leafGenericEntry(ctx context.Context,
+	hIndex *Hash) (*GenericEntry, error) {
+	_, v, _, err := mt.Get(ctx, hIndex.BigInt())
+	if err != nil {
+		return nil, err
+	}
+	hValue, err := NewHashFromBigInt(v)
+	if err != nil {
+		return nil, err
+	}
+	return mt.leafEntry(ctx, hIndex, hValue)
+}
+
+// GetEntry returns the Entry of the leaf with the given hIndex under the
+// current Root. It returns ErrKeyNotFound if there is no such leaf, and
+// ErrEntryNotFound if the leaf wasn't added with AddEntry, or its value was
+// modified with Update, since the Entry of the new value is unknown. If the
+// leaf was added with AddGenericEntry, it returns ErrEntryLayout unless the
+// GenericEntry has the layout of an Entry; see GetGenericEntry.
+func (mt *MerkleTree) GetEntry(ctx context.Context,
+	hIndex *Hash) (*Entry, error) {
+	e, err := mt.leafGenericEntry(ctx, hIndex)
+	if err != nil {
+		return nil, err
+	}
+	entry, ok := e.entry()
+	if !ok {
+		return nil, ErrEntryLayout
+	}
+	return entry, nil
+}
+
+// DumpEntries writes to w the entries of all the leafs under the given Root,
+// one per line, in path order. The entries with the layout of an Entry are
+// written in the text form of Entry, and the other ones in the text form of
+// GenericEntry, which contains a colon. The leafs without a stored entry are
+// skipped. If no Root is given (nil), it uses the current Root of the
+// MerkleTree. The entries can be added to a new tree with AddEntry and
+// AddGenericEntry.
+func (mt *MerkleTree) DumpEntries(ctx context.Context, w io.Writer,
+	rootKey *Hash) error {
+	it, err := mt.NewLeafIterator(ctx, rootKey, "")
+	if err != nil {
+		return err
+	}
+	bw := bufio.NewWriter(w)
+	for it.Next() {
+		leaf := it.Leaf()
+		e, err := mt.leafEntry(ctx, leaf.HIndex, leaf.HValue)
+		if errors.Is(err, ErrEntryNotFound) {
+			continue
+		} else if err != nil {
+			return err
+		}
+		var text []byte
+		if entry, ok := e.entry(); ok {
+			text, err = entry.MarshalText()
+		} else {
+			text, err = e.MarshalText()
+		}
+		if err != nil {
+			return err
+		}
+		if _, err := bw.Write(append(text, '\n')); err != nil {
+			return err
+		}
+	}
+	if err := it.Err(); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// GenerateEntryProof generates the proof of existence of the Entry for the
+// given root. If the rootKey is nil, the current Root of the MerkleTree is
+// used. It returns ErrKeyNotFound if the tree doesn't contain the index of the
+// Entry, and ErrEntryValueMismatch if it contains it with a different value.
+func (mt *MerkleTree) GenerateEntryProof(ctx context.Context, e Entrier,
+	rootKey *Hash) (*Proof, error) {
+	hIndex, hValue, err := entryHiHv(e)
+	if err != nil {
+		return nil, err
+	}
+	return mt.generateLeafProof(ctx, hIndex, hValue, rootKey)
+}
+
+// generateLeafProof generates the proof of existence of the leaf of hIndex
+// and hValue. It returns ErrKeyNotFound if there is no leaf of hIndex.
+func (mt *MerkleTree) generateLeafProof(ctx context.Context, hIndex,
+	hValue, rootKey *Hash) (*Proof, error) {
+	p, v, err := mt.GenerateProof(ctx, hIndex.BigInt(), rootKey)
+	if err != nil {
+		return nil, err
+	}
+	if !p.Existence {
+		return nil, ErrKeyNotFound
+	}
+	if v.Cmp(hValue.BigInt()) != 0 {
+		return nil, ErrEntryValueMismatch
+	}
+	return p, nil
+}
+
+// VerifyEntryProof verifies the Merkle Proof of existence of the Entry for
+// the given root, using the Hasher of the proof. Unlike VerifyProof, a proof
+// of non-existence is never valid.
+func VerifyEntryProof(rootKey *Hash, proof *Proof, e Entrier) bool {
+	hIndex, hValue, err := entryHiHv(e)
+	if err != nil {
+		return false
+	}
+	return verifyLeafProof(rootKey, proof, hIndex, hValue)
+}
+
+// verifyLeafProof verifies the proof of existence of the leaf of hIndex and
+// hValue.
+func verifyLeafProof(rootKey *Hash, proof *Proof, hIndex, hValue *Hash) bool {
+	return proof.Existence &&
+		VerifyProof(rootKey, proof, hIndex.BigInt(), hValue.BigInt())
+}
+
+// UpdateEntry sets the value of the leaf of the index of the Entry to the
+// value of the Entry, and stores the Entry if the Storage implements
+// EntryStorage. Returns the CircomProcessorProof.
+func (mt *MerkleTree) UpdateEntry(ctx context.Context,
+	e Entrier) (*CircomProcessorProof, error) {
+	if !mt.writable {
+		return nil, ErrNotWritable
+	}
+	hIndex, hValue, err := entryHiHv(e)
+	if err != nil {
+		return nil, err
+	}
+	ev, err := mt.replace(ctx, hIndex, hValue)
+	if err != nil {
+		return nil, err
+	}
+	return ev.Proof, mt.entryModified(ctx, ev,
+		NewGenericEntryFromEntry(e.Entry()))
+}
+
+// DeleteEntry removes the leaf of the Entry from the MerkleTree. It returns
+// ErrEntryValueMismatch, and the tree is not modified, if the leaf of the
+// index of the Entry has a different value.
+func (mt *MerkleTree) DeleteEntry(ctx context.Context, e Entrier) error {
+	if !mt.writable {
+		return ErrNotWritable
+	}
+	hIndex, hValue, err := entryHiHv(e)
+	if err != nil {
+		return err
+	}
+	return mt.deleteLeaf(ctx, hIndex, hValue)
+}
+
+// deleteLeaf removes the leaf of hIndex if its value is hValue.
+func (mt *MerkleTree) deleteLeaf(ctx context.Context,
+	hIndex, hValue *Hash) error {
+	ev, err := mt.remove(ctx, hIndex, hValue)
+	if err != nil {
+		return err
+	}
+	return mt.modified(ctx, ev)
+}
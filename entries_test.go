@@ -0,0 +1,228 @@
+package merkletree_test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/iden3/go-merkletree-sql/v2"
+	"github.com/iden3/go-merkletree-sql/v2/db/memory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testEntry returns an Entry with index elements i, i+1 and value elements
+// v, v+1
+func testEntry(i, v int64) *merkletree.Entry {
+	e := &merkletree.Entry{}
+	e.Data[0] = merkletree.NewElemBytesFromBigInt(big.NewInt(i))
+	e.Data[1] = merkletree.NewElemBytesFromBigInt(big.NewInt(i + 1))
+	e.Data[4] = merkletree.NewElemBytesFromBigInt(big.NewInt(v))
+	e.Data[5] = merkletree.NewElemBytesFromBigInt(big.NewInt(v + 1))
+	return e
+}
+
+func TestGetEntry(t *testing.T) {
+	ctx := context.Background()
+	mt, err := merkletree.NewMerkleTree(ctx, memory.NewMemoryStorage(), 10)
+	require.NoError(t, err)
+
+	e := testEntry(1, 10)
+	require.NoError(t, mt.AddEntry(ctx, e))
+	hIndex, err := e.HIndex()
+	require.NoError(t, err)
+	got, err := mt.GetEntry(ctx, hIndex)
+	require.NoError(t, err)
+	assert.True(t, e.Equal(got))
+	rootWithEntry := mt.Root()
+
+	// the Entry of a leaf added without AddEntry is unknown
+	require.NoError(t, mt.Add(ctx, big.NewInt(5), big.NewInt(6)))
+	k, err := merkletree.NewHashFromBigInt(big.NewInt(5))
+	require.NoError(t, err)
+	_, err = mt.GetEntry(ctx, k)
+	require.ErrorIs(t, err, merkletree.ErrEntryNotFound)
+
+	// the Entry of the new value of an updated leaf is unknown
+	_, err = mt.Update(ctx, hIndex.BigInt(), big.NewInt(7))
+	require.NoError(t, err)
+	_, err = mt.GetEntry(ctx, hIndex)
+	require.ErrorIs(t, err, merkletree.ErrEntryNotFound)
+
+	// the Entry is still available in the snapshots of the old roots
+	snapshot, err := mt.Snapshot(ctx, rootWithEntry)
+	require.NoError(t, err)
+	got, err = snapshot.GetEntry(ctx, hIndex)
+	require.NoError(t, err)
+	assert.True(t, e.Equal(got))
+
+	require.NoError(t, mt.Delete(ctx, hIndex.BigInt()))
+	_, err = mt.GetEntry(ctx, hIndex)
+	require.ErrorIs(t, err, merkletree.ErrKeyNotFound)
+}
+
+// nodeStorage hides the optional interfaces of a Storage
+type nodeStorage struct {
+	merkletree.Storage
+}
+
+func TestGetEntryNotSupported(t *testing.T) {
+	ctx := context.Background()
+	mt, err := merkletree.NewMerkleTree(ctx,
+		nodeStorage{memory.NewMemoryStorage()}, 10)
+	require.NoError(t, err)
+
+	e := testEntry(1, 10)
+	require.NoError(t, mt.AddEntry(ctx, e))
+	hIndex, err := e.HIndex()
+	require.NoError(t, err)
+	_, err = mt.GetEntry(ctx, hIndex)
+	require.ErrorIs(t, err, merkletree.ErrEntryNotFound)
+}
+
+func TestDumpEntries(t *testing.T) {
+	ctx := context.Background()
+	mt, err := merkletree.NewMerkleTree(ctx, memory.NewMemoryStorage(), 10)
+	require.NoError(t, err)
+	for i := int64(0); i < 5; i++ {
+		require.NoError(t, mt.AddEntry(ctx, testEntry(i*10, i)))
+	}
+	// the leafs without Entry are skipped
+	require.NoError(t, mt.Add(ctx, big.NewInt(1), big.NewInt(2)))
+
+	var buf bytes.Buffer
+	require.NoError(t, mt.DumpEntries(ctx, &buf, nil))
+
+	mt2, err := merkletree.NewMerkleTree(ctx, memory.NewMemoryStorage(), 10)
+	require.NoError(t, err)
+	scanner := bufio.NewScanner(&buf)
+	n := 0
+	for scanner.Scan() {
+		var e merkletree.Entry
+		require.NoError(t, e.UnmarshalText(scanner.Bytes()))
+		require.NoError(t, mt2.AddEntry(ctx, &e))
+		n++
+	}
+	require.NoError(t, scanner.Err())
+	assert.Equal(t, 5, n)
+	require.NoError(t, mt2.Add(ctx, big.NewInt(1), big.NewInt(2)))
+	assert.Equal(t, mt.Root(), mt2.Root())
+}
+
+func TestEntryProof(t *testing.T) {
+	ctx := context.Background()
+	mt, err := merkletree.NewMerkleTree(ctx, memory.NewMemoryStorage(), 10)
+	require.NoError(t, err)
+	for i := int64(0); i < 5; i++ {
+		require.NoError(t, mt.AddEntry(ctx, testEntry(i*10, i)))
+	}
+
+	e := testEntry(20, 2)
+	p, err := mt.GenerateEntryProof(ctx, e, nil)
+	require.NoError(t, err)
+	assert.True(t, p.Existence)
+	assert.True(t, merkletree.VerifyEntryProof(mt.Root(), p, e))
+	// the proof is not valid for an entry with the same index and another
+	// value, nor for the entry with the index and value swapped
+	assert.False(t, merkletree.VerifyEntryProof(mt.Root(), p, testEntry(20, 3)))
+	swapped := &merkletree.Entry{}
+	copy(swapped.Data[:4], e.Data[4:])
+	copy(swapped.Data[4:], e.Data[:4])
+	assert.False(t, merkletree.VerifyEntryProof(mt.Root(), p, swapped))
+
+	_, err = mt.GenerateEntryProof(ctx, testEntry(20, 3), nil)
+	require.ErrorIs(t, err, merkletree.ErrEntryValueMismatch)
+
+	// an absent entry has no proof, and a valid proof of non-existence of
+	// its index doesn't verify it
+	missing := testEntry(100, 1)
+	_, err = mt.GenerateEntryProof(ctx, missing, nil)
+	require.ErrorIs(t, err, merkletree.ErrKeyNotFound)
+	hIndex, err := missing.HIndex()
+	require.NoError(t, err)
+	p, _, err = mt.GenerateProof(ctx, hIndex.BigInt(), nil)
+	require.NoError(t, err)
+	require.False(t, p.Existence)
+	assert.False(t, merkletree.VerifyEntryProof(mt.Root(), p, missing))
+
+	notInField := testEntry(1, 1)
+	notInField.Data[0] = merkletree.ElemBytes{0xff, 0xff, 0xff, 0xff, 0xff,
+		0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff,
+		0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff,
+		0xff, 0xff, 0xff, 0xff, 0xff}
+	_, err = mt.GenerateEntryProof(ctx, notInField, nil)
+	require.ErrorIs(t, err, merkletree.ErrEntryNotInField)
+	assert.False(t, merkletree.VerifyEntryProof(mt.Root(), p, notInField))
+	require.ErrorIs(t, mt.AddEntry(ctx, notInField),
+		merkletree.ErrEntryNotInField)
+}
+
+func TestUpdateAndDeleteEntry(t *testing.T) {
+	ctx := context.Background()
+	mt, err := merkletree.NewMerkleTree(ctx, memory.NewMemoryStorage(), 10)
+	require.NoError(t, err)
+	require.NoError(t, mt.AddEntry(ctx, testEntry(1, 10)))
+	require.NoError(t, mt.AddEntry(ctx, testEntry(2, 20)))
+
+	updated := testEntry(1, 11)
+	cp, err := mt.UpdateEntry(ctx, updated)
+	require.NoError(t, err)
+	assert.Equal(t, mt.Root(), cp.NewRoot)
+	hIndex, err := updated.HIndex()
+	require.NoError(t, err)
+	got, err := mt.GetEntry(ctx, hIndex)
+	require.NoError(t, err)
+	assert.True(t, updated.Equal(got))
+	p, err := mt.GenerateEntryProof(ctx, updated, nil)
+	require.NoError(t, err)
+	assert.True(t, merkletree.VerifyEntryProof(mt.Root(), p, updated))
+
+	// the old Entry can't be deleted, as the leaf has a new value
+	root := mt.Root()
+	err = mt.DeleteEntry(ctx, testEntry(1, 10))
+	require.ErrorIs(t, err, merkletree.ErrEntryValueMismatch)
+	assert.Equal(t, root, mt.Root())
+
+	require.NoError(t, mt.DeleteEntry(ctx, updated))
+	_, err = mt.GetEntry(ctx, hIndex)
+	require.ErrorIs(t, err, merkletree.ErrKeyNotFound)
+	err = mt.DeleteEntry(ctx, updated)
+	require.ErrorIs(t, err, merkletree.ErrKeyNotFound)
+
+	ro, err := merkletree.OpenReadOnly(ctx, memory.NewMemoryStorage(), 10)
+	require.NoError(t, err)
+	_, err = ro.UpdateEntry(ctx, updated)
+	require.ErrorIs(t, err, merkletree.ErrNotWritable)
+	require.ErrorIs(t, ro.DeleteEntry(ctx, updated), merkletree.ErrNotWritable)
+}
+
+func TestFailedEntryNotStored(t *testing.T) {
+	ctx := context.Background()
+	s := memory.NewMemoryStorage()
+	mt, err := merkletree.NewMerkleTree(ctx, s, 10)
+	require.NoError(t, err)
+	require.NoError(t, mt.AddEntry(ctx, testEntry(1, 10)))
+
+	requireNotStored := func(e *merkletree.Entry) {
+		hIndex, hValue, err := e.HiHv()
+		require.NoError(t, err)
+		key, err := merkletree.LeafKey(hIndex, hValue)
+		require.NoError(t, err)
+		_, err = s.GetEntry(ctx, key[:])
+		require.ErrorIs(t, err, merkletree.ErrNotFound)
+	}
+
+	// the index already exists
+	duplicated := testEntry(1, 11)
+	err = mt.AddEntry(ctx, duplicated)
+	require.ErrorIs(t, err, merkletree.ErrEntryIndexAlreadyExists)
+	requireNotStored(duplicated)
+
+	// the index doesn't exist
+	missing := testEntry(2, 20)
+	_, err = mt.UpdateEntry(ctx, missing)
+	require.ErrorIs(t, err, merkletree.ErrKeyNotFound)
+	requireNotStored(missing)
+}
@@ -21,6 +21,11 @@ type Entrier interface {
 	Entry() *Entry
 }
 
+// Entry returns the Entry itself, so an *Entry is an Entrier
+func (e *Entry) Entry() *Entry {
+	return e
+}
+
 func (e *Entry) Index() []ElemBytes {
 	return e.Data[:IndexLen]
 }
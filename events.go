@@ -0,0 +1,144 @@
+package merkletree
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// Event describes a modification of a MerkleTree. Op is one of FncInsert,
+// FncUpdate and FncDelete.
+type Event struct {
+	Op       int
+	Key      *Hash
+	OldValue *Hash // nil for FncInsert
+	NewValue *Hash // nil for FncDelete
+	OldRoot  *Hash
+	NewRoot  *Hash
+	// Proof is the CircomProcessorProof of the modification, when it's
+	// computed by the modifying method: Update, AddAndGetCircomProof,
+	// DeleteAndGetCircomProof and ProcessBatch. Otherwise it's nil.
+	Proof *CircomProcessorProof
+}
+
+// EventHook is a function called after each modification of a MerkleTree,
+// once the new root is stored. It's called without holding the lock of the
+// tree, so it can read from it. The errors returned by the hooks are handled
+// according to the HookErrorPolicy of the tree, and never revert the
+// modification.
+type EventHook func(ctx context.Context, e Event) error
+
+// HookErrorPolicy defines how the errors returned by the EventHooks are
+// handled.
+type HookErrorPolicy int
+
+const (
+	// HookErrorLog logs the errors of the hooks with the Logger of the tree.
+	// It's the default policy.
+	HookErrorLog HookErrorPolicy = iota
+	// HookErrorIgnore ignores the errors of the hooks.
+	HookErrorIgnore
+	// HookErrorReturn returns the first error of the hooks, as a *HookError,
+	// from the method that modified the tree, once all the hooks are called.
+	// The modification is applied anyway, and the methods that return a
+	// CircomProcessorProof return it along with the error. ProcessBatch
+	// processes the whole batch, and returns the BatchWitness along with the
+	// error.
+	HookErrorReturn
+)
+
+// HookError is the error returned by the modifications of a MerkleTree with
+// the HookErrorReturn policy when an EventHook fails.
+type HookError struct {
+	Event Event
+	Err   error
+}
+
+// Error implements the error interface
+func (e *HookError) Error() string {
+	return fmt.Sprintf("event hook failed for root %v: %v", e.Event.NewRoot,
+		e.Err)
+}
+
+// Unwrap returns the error of the EventHook
+func (e *HookError) Unwrap() error {
+	return e.Err
+}
+
+// hookSet is the set of EventHooks of a MerkleTree, which can be modified
+// while the tree is used.
+type hookSet struct {
+	mu    sync.RWMutex
+	hooks []*EventHook
+}
+
+// add adds an EventHook, and returns the function that removes it.
+func (s *hookSet) add(h EventHook) func() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	hp := &h
+	s.hooks = append(s.hooks, hp)
+	return func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		for i, other := range s.hooks {
+			if other == hp {
+				s.hooks = append(s.hooks[:i:i], s.hooks[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+// list returns the current EventHooks.
+func (s *hookSet) list() []*EventHook {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.hooks
+}
+
+// Subscribe adds an EventHook called after each modification of the
+// MerkleTree, after the hooks added before. It returns the function that
+// removes the hook. See WithEventHook to add a hook when the tree is loaded.
+func (mt *MerkleTree) Subscribe(h EventHook) (unsubscribe func()) {
+	return mt.hooks.add(h)
+}
+
+// emitEvent calls the event hooks of the MerkleTree with the given Event, and
+// handles their errors according to the HookErrorPolicy of the tree.
+func (mt *MerkleTree) emitEvent(ctx context.Context, e Event) error {
+	var firstErr error
+	for _, h := range mt.hooks.list() {
+		err := (*h)(ctx, e)
+		if err == nil {
+			continue
+		}
+		switch mt.hookErrorPolicy {
+		case HookErrorIgnore:
+		case HookErrorReturn:
+			if firstErr == nil {
+				firstErr = &HookError{Event: e, Err: err}
+				continue
+			}
+			fallthrough
+		default:
+			mt.logf("merkletree: event hook failed for root %v: %v",
+				e.NewRoot, err)
+		}
+	}
+	return firstErr
+}
+
+// modified is called after each modification of the MerkleTree, once the lock
+// is released. It updates the leaf count and emits the Event.
+func (mt *MerkleTree) modified(ctx context.Context, e Event) error {
+	var delta int64
+	switch e.Op {
+	case FncInsert:
+		delta = 1
+	case FncDelete:
+		delta = -1
+	}
+	mt.trackLeafCount(ctx, e.OldRoot, e.NewRoot, delta)
+	return mt.emitEvent(ctx, e)
+}
@@ -0,0 +1,141 @@
+package merkletree_test
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/iden3/go-merkletree-sql/v2"
+	"github.com/iden3/go-merkletree-sql/v2/db/memory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSubscribe(t *testing.T) {
+	ctx := context.Background()
+	mt, err := merkletree.NewMerkleTree(ctx, memory.NewMemoryStorage(), 10)
+	require.NoError(t, err)
+
+	var events []merkletree.Event
+	unsubscribe := mt.Subscribe(
+		func(_ context.Context, e merkletree.Event) error {
+			// the new root is already stored when the hook is called
+			_, err := mt.GetNode(ctx, e.NewRoot)
+			require.NoError(t, err)
+			events = append(events, e)
+			return nil
+		})
+
+	require.NoError(t, mt.Add(ctx, big.NewInt(1), big.NewInt(10)))
+	cpAdd, err := mt.AddAndGetCircomProof(ctx, big.NewInt(2), big.NewInt(20))
+	require.NoError(t, err)
+	cpUpdate, err := mt.Update(ctx, big.NewInt(2), big.NewInt(21))
+	require.NoError(t, err)
+	cpDelete, err := mt.DeleteAndGetCircomProof(ctx, big.NewInt(1))
+	require.NoError(t, err)
+
+	require.Len(t, events, 4)
+	assert.Nil(t, events[0].Proof)
+	assert.Equal(t, cpAdd, events[1].Proof)
+	assert.Equal(t, merkletree.FncInsert, events[1].Op)
+	assert.Equal(t, "20", events[1].NewValue.String())
+	assert.Equal(t, cpUpdate, events[2].Proof)
+	assert.Equal(t, "20", events[2].OldValue.String())
+	assert.Equal(t, "21", events[2].NewValue.String())
+	assert.Equal(t, cpDelete, events[3].Proof)
+	assert.Equal(t, merkletree.FncDelete, events[3].Op)
+	assert.Equal(t, "10", events[3].OldValue.String())
+	assert.Equal(t, mt.Root(), events[3].NewRoot)
+	for i := 1; i < len(events); i++ {
+		assert.Equal(t, events[i-1].NewRoot, events[i].OldRoot)
+	}
+
+	// failed modifications emit no events
+	require.Error(t, mt.Delete(ctx, big.NewInt(1)))
+	require.Len(t, events, 4)
+
+	unsubscribe()
+	require.NoError(t, mt.Add(ctx, big.NewInt(3), big.NewInt(30)))
+	assert.Len(t, events, 4)
+	// unsubscribing twice is harmless
+	unsubscribe()
+}
+
+func TestHookErrorPolicy(t *testing.T) {
+	ctx := context.Background()
+	errHook := errors.New("index unavailable")
+	failing := func(context.Context, merkletree.Event) error { return errHook }
+
+	for _, tc := range []struct {
+		policy   merkletree.HookErrorPolicy
+		logLines int
+		fail     bool
+	}{
+		{merkletree.HookErrorLog, 2, false},
+		{merkletree.HookErrorIgnore, 0, false},
+		// the first error is returned, and the second one logged
+		{merkletree.HookErrorReturn, 1, true},
+	} {
+		logger := &testLogger{}
+		mt, err := merkletree.NewMerkleTree(ctx, memory.NewMemoryStorage(), 10,
+			merkletree.WithLogger(logger),
+			merkletree.WithHookErrorPolicy(tc.policy))
+		require.NoError(t, err)
+		require.NoError(t, mt.Add(ctx, big.NewInt(1), big.NewInt(10)))
+		logger.lines = nil
+		mt.Subscribe(failing)
+		called := false
+		mt.Subscribe(func(context.Context, merkletree.Event) error {
+			called = true
+			return errHook
+		})
+
+		cp, err := mt.Update(ctx, big.NewInt(1), big.NewInt(11))
+		// all the hooks are called, and the modification is applied
+		assert.True(t, called, tc.policy)
+		require.NotNil(t, cp, tc.policy)
+		assert.Equal(t, mt.Root(), cp.NewRoot, tc.policy)
+		if tc.fail {
+			var hookErr *merkletree.HookError
+			require.ErrorAs(t, err, &hookErr)
+			assert.ErrorIs(t, err, errHook)
+			assert.Equal(t, cp, hookErr.Event.Proof)
+		} else {
+			require.NoError(t, err, tc.policy)
+		}
+		assert.Len(t, logger.lines, tc.logLines, tc.policy)
+	}
+}
+
+func TestHookErrorPolicyBatch(t *testing.T) {
+	ctx := context.Background()
+	errHook := errors.New("index unavailable")
+	mt, err := merkletree.NewMerkleTree(ctx, memory.NewMemoryStorage(), 10,
+		merkletree.WithHookErrorPolicy(merkletree.HookErrorReturn))
+	require.NoError(t, err)
+	calls := 0
+	mt.Subscribe(func(context.Context, merkletree.Event) error {
+		calls++
+		return errHook
+	})
+
+	ops := []merkletree.BatchOperation{
+		{Fnc: merkletree.FncInsert, Key: big.NewInt(1), Value: big.NewInt(10)},
+		{Fnc: merkletree.FncInsert, Key: big.NewInt(2), Value: big.NewInt(20)},
+		{Fnc: merkletree.FncUpdate, Key: big.NewInt(1), Value: big.NewInt(11)},
+	}
+	w, err := mt.ProcessBatch(ctx, ops, 4)
+	// the whole batch is processed, and the first hook error returned
+	var hookErr *merkletree.HookError
+	require.ErrorAs(t, err, &hookErr)
+	assert.ErrorIs(t, err, errHook)
+	assert.Equal(t, 3, calls)
+	require.NotNil(t, w)
+	require.Len(t, w.Proofs, 4)
+	assert.Equal(t, w.Proofs[0], hookErr.Event.Proof)
+	assert.Equal(t, mt.Root(), w.Roots[4])
+	_, v, _, err := mt.Get(ctx, big.NewInt(1))
+	require.NoError(t, err)
+	assert.Equal(t, "11", v.String())
+}
@@ -0,0 +1,249 @@
+package merkletree
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	"github.com/iden3/go-iden3-crypto/poseidon"
+	cryptoUtils "github.com/iden3/go-iden3-crypto/utils"
+)
+
+// maxPoseidonInputs is the maximum number of inputs of poseidon.Hash
+const maxPoseidonInputs = 16
+
+// ErrInvalidGenericEntry is used when a GenericEntry can't be decoded.
+var ErrInvalidGenericEntry = errors.New("invalid generic entry")
+
+// GenericEntry is an entry of the MerkleTree with any number of index and
+// value elements, for the schemas that don't fit the IndexLen and DataLen of
+// Entry. Its hIndex and hValue are the poseidon hash of the elements, like
+// the ones of Entry, or their poseidon sponge hash when there are more than
+// 16 elements. A GenericEntry with the layout of an Entry has the same
+// hashes, see NewGenericEntryFromEntry.
+//
+// Its text form, also used for JSON, is the hex of the index elements and
+// the hex of the value elements separated by a colon.
+type GenericEntry struct {
+	Index []ElemBytes
+	Value []ElemBytes
+}
+
+// NewGenericEntryFromEntry returns the GenericEntry with the elements of the
+// Entry.
+func NewGenericEntryFromEntry(e *Entry) *GenericEntry {
+	ge := &GenericEntry{
+		Index: make([]ElemBytes, IndexLen),
+		Value: make([]ElemBytes, DataLen-IndexLen),
+	}
+	copy(ge.Index, e.Index())
+	copy(ge.Value, e.Value())
+	return ge
+}
+
+// hashEntryElems hashes the elements of an entry with poseidon.Hash, or with
+// poseidon.SpongeHash if there are too many for poseidon.Hash.
+func hashEntryElems(elems []ElemBytes) (*Hash, error) {
+	bigints := ElemBytesToBigInts(elems)
+	if len(bigints) <= maxPoseidonInputs {
+		return HashElems(bigints...)
+	}
+	h, err := poseidon.SpongeHash(bigints)
+	if err != nil {
+		return nil, err
+	}
+	return NewHashFromBigInt(h)
+}
+
+// entry returns the Entry with the elements of the GenericEntry, if it has the
+// layout of an Entry.
+func (e *GenericEntry) entry() (*Entry, bool) {
+	if len(e.Index) != IndexLen || len(e.Value) != DataLen-IndexLen {
+		return nil, false
+	}
+	entry := &Entry{}
+	copy(entry.Data[:IndexLen], e.Index)
+	copy(entry.Data[IndexLen:], e.Value)
+	return entry, true
+}
+
+// HIndex calculates the hash of the Index of the GenericEntry
+func (e *GenericEntry) HIndex() (*Hash, error) {
+	return hashEntryElems(e.Index)
+}
+
+// HValue calculates the hash of the Value of the GenericEntry
+func (e *GenericEntry) HValue() (*Hash, error) {
+	return hashEntryElems(e.Value)
+}
+
+// HiHv returns the HIndex and HValue of the GenericEntry
+func (e *GenericEntry) HiHv() (*Hash, *Hash, error) {
+	hi, err := e.HIndex()
+	if err != nil {
+		return nil, nil, err
+	}
+	hv, err := e.HValue()
+	if err != nil {
+		return nil, nil, err
+	}
+	return hi, hv, nil
+}
+
+// Equal returns true if both GenericEntries have the same elements
+func (e1 *GenericEntry) Equal(e2 *GenericEntry) bool {
+	return bytes.Equal(ElemBytesToBytes(e1.Index), ElemBytesToBytes(e2.Index)) &&
+		bytes.Equal(ElemBytesToBytes(e1.Value), ElemBytesToBytes(e2.Value))
+}
+
+// Clone returns a copy of the GenericEntry
+func (e *GenericEntry) Clone() *GenericEntry {
+	return &GenericEntry{
+		Index: append([]ElemBytes{}, e.Index...),
+		Value: append([]ElemBytes{}, e.Value...),
+	}
+}
+
+// MarshalText implements the encoding.TextMarshaler interface
+func (e GenericEntry) MarshalText() ([]byte, error) {
+	return []byte(hex.EncodeToString(ElemBytesToBytes(e.Index)) + ":" +
+		hex.EncodeToString(ElemBytesToBytes(e.Value))), nil
+}
+
+// UnmarshalText implements the encoding.TextUnmarshaler interface
+func (e *GenericEntry) UnmarshalText(text []byte) error {
+	parts := bytes.Split(text, []byte(":"))
+	if len(parts) != 2 {
+		return fmt.Errorf("%w: missing separator", ErrInvalidGenericEntry)
+	}
+	index, err := elemBytesFromHex(parts[0])
+	if err != nil {
+		return err
+	}
+	value, err := elemBytesFromHex(parts[1])
+	if err != nil {
+		return err
+	}
+	e.Index, e.Value = index, value
+	return nil
+}
+
+// elemBytesFromHex decodes a list of ElemBytes from their hex
+func elemBytesFromHex(text []byte) ([]ElemBytes, error) {
+	b := make([]byte, hex.DecodedLen(len(text)))
+	if _, err := hex.Decode(b, text); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidGenericEntry, err)
+	}
+	if len(b)%ElemBytesLen != 0 {
+		return nil, fmt.Errorf("%w: invalid length", ErrInvalidGenericEntry)
+	}
+	elems := make([]ElemBytes, len(b)/ElemBytesLen)
+	for i := range elems {
+		copy(elems[i][:], b[i*ElemBytesLen:])
+	}
+	return elems, nil
+}
+
+// CheckGenericEntryInField checks that the elements of the GenericEntry fit
+// inside the finite field.
+func CheckGenericEntryInField(e *GenericEntry) bool {
+	bigints := ElemBytesToBigInts(append(append([]ElemBytes{}, e.Index...),
+		e.Value...))
+	return cryptoUtils.CheckBigIntArrayInField(bigints)
+}
+
+// genericEntryHiHv returns the HIndex and HValue of the GenericEntry, once
+// checked that its elements fit inside the finite field.
+func genericEntryHiHv(e *GenericEntry) (*Hash, *Hash, error) {
+	if !CheckGenericEntryInField(e) {
+		return nil, nil, ErrEntryNotInField
+	}
+	return e.HiHv()
+}
+
+// AddGenericEntry adds the GenericEntry to the MerkleTree. If the Storage
+// implements EntryStorage, the GenericEntry is stored too, and can be read
+// with GetGenericEntry.
+func (mt *MerkleTree) AddGenericEntry(ctx context.Context,
+	e *GenericEntry) error {
+	if !mt.writable {
+		return ErrNotWritable
+	}
+	hIndex, hValue, err := genericEntryHiHv(e)
+	if err != nil {
+		return err
+	}
+	ev, err := mt.insert(ctx, hIndex, hValue)
+	if err != nil {
+		return err
+	}
+	return mt.entryModified(ctx, ev, e)
+}
+
+// GetGenericEntry returns the entry of the leaf with the given hIndex under
+// the current Root, added with AddGenericEntry or AddEntry. It returns
+// ErrKeyNotFound if there is no such leaf, and ErrEntryNotFound if the entry
+// of the leaf is not stored, like GetEntry.
+func (mt *MerkleTree) GetGenericEntry(ctx context.Context,
+	hIndex *Hash) (*GenericEntry, error) {
+	return mt.leafGenericEntry(ctx, hIndex)
+}
+
+// GenerateGenericEntryProof generates the proof of existence of the
+// GenericEntry for the given root, like GenerateEntryProof. It returns
+// ErrKeyNotFound if the tree doesn't contain the index of the GenericEntry.
+func (mt *MerkleTree) GenerateGenericEntryProof(ctx context.Context,
+	e *GenericEntry, rootKey *Hash) (*Proof, error) {
+	hIndex, hValue, err := genericEntryHiHv(e)
+	if err != nil {
+		return nil, err
+	}
+	return mt.generateLeafProof(ctx, hIndex, hValue, rootKey)
+}
+
+// VerifyGenericEntryProof verifies the Merkle Proof of existence of the
+// GenericEntry for the given root, like VerifyEntryProof. A proof of
+// non-existence is never valid.
+func VerifyGenericEntryProof(rootKey *Hash, proof *Proof,
+	e *GenericEntry) bool {
+	hIndex, hValue, err := genericEntryHiHv(e)
+	if err != nil {
+		return false
+	}
+	return verifyLeafProof(rootKey, proof, hIndex, hValue)
+}
+
+// UpdateGenericEntry sets the value of the leaf of the index of the
+// GenericEntry to the value of the GenericEntry, and stores the GenericEntry
+// if the Storage implements EntryStorage. Returns the CircomProcessorProof.
+func (mt *MerkleTree) UpdateGenericEntry(ctx context.Context,
+	e *GenericEntry) (*CircomProcessorProof, error) {
+	if !mt.writable {
+		return nil, ErrNotWritable
+	}
+	hIndex, hValue, err := genericEntryHiHv(e)
+	if err != nil {
+		return nil, err
+	}
+	ev, err := mt.replace(ctx, hIndex, hValue)
+	if err != nil {
+		return nil, err
+	}
+	return ev.Proof, mt.entryModified(ctx, ev, e)
+}
+
+// DeleteGenericEntry removes the leaf of the GenericEntry from the
+// MerkleTree, like DeleteEntry.
+func (mt *MerkleTree) DeleteGenericEntry(ctx context.Context,
+	e *GenericEntry) error {
+	if !mt.writable {
+		return ErrNotWritable
+	}
+	hIndex, hValue, err := genericEntryHiHv(e)
+	if err != nil {
+		return err
+	}
+	return mt.deleteLeaf(ctx, hIndex, hValue)
+}
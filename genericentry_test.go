@@ -0,0 +1,166 @@
+package merkletree_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/iden3/go-iden3-crypto/poseidon"
+	"github.com/iden3/go-merkletree-sql/v2"
+	"github.com/iden3/go-merkletree-sql/v2/db/memory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// elems returns n ElemBytes with consecutive values starting at first
+func elems(first, n int64) []merkletree.ElemBytes {
+	es := make([]merkletree.ElemBytes, n)
+	for i := range es {
+		es[i] = merkletree.NewElemBytesFromBigInt(big.NewInt(first + int64(i)))
+	}
+	return es
+}
+
+func TestGenericEntryHashes(t *testing.T) {
+	// the layout of an Entry has the same hashes
+	e := testEntry(3, 7)
+	ge := merkletree.NewGenericEntryFromEntry(e)
+	hi, hv, err := e.HiHv()
+	require.NoError(t, err)
+	ghi, ghv, err := ge.HiHv()
+	require.NoError(t, err)
+	assert.Equal(t, hi, ghi)
+	assert.Equal(t, hv, ghv)
+
+	// up to 16 elements are hashed with a single poseidon hash, and more
+	// with the poseidon sponge hash
+	ge = &merkletree.GenericEntry{Index: elems(1, 16), Value: elems(100, 20)}
+	ghi, ghv, err = ge.HiHv()
+	require.NoError(t, err)
+	expected, err := poseidon.Hash(merkletree.ElemBytesToBigInts(ge.Index))
+	require.NoError(t, err)
+	assert.Equal(t, expected, ghi.BigInt())
+	expected, err = poseidon.SpongeHash(merkletree.ElemBytesToBigInts(ge.Value))
+	require.NoError(t, err)
+	assert.Equal(t, expected, ghv.BigInt())
+}
+
+func TestGenericEntryMarshal(t *testing.T) {
+	ge := &merkletree.GenericEntry{Index: elems(1, 2), Value: elems(10, 17)}
+	b, err := json.Marshal(ge)
+	require.NoError(t, err)
+	var ge2 merkletree.GenericEntry
+	require.NoError(t, json.Unmarshal(b, &ge2))
+	assert.True(t, ge.Equal(&ge2))
+
+	text, err := ge.MarshalText()
+	require.NoError(t, err)
+	ge3 := &merkletree.GenericEntry{}
+	require.NoError(t, ge3.UnmarshalText(text))
+	assert.True(t, ge.Equal(ge3))
+
+	for _, invalid := range []string{"", "00", "0:0", "00:zz", "00:00:00"} {
+		err := ge3.UnmarshalText([]byte(invalid))
+		require.ErrorIs(t, err, merkletree.ErrInvalidGenericEntry, invalid)
+	}
+}
+
+func TestGenericEntryTree(t *testing.T) {
+	ctx := context.Background()
+	mt, err := merkletree.NewMerkleTree(ctx, memory.NewMemoryStorage(), 10)
+	require.NoError(t, err)
+	for i := int64(0); i < 5; i++ {
+		ge := &merkletree.GenericEntry{Index: elems(i*100, 20),
+			Value: elems(i, 3)}
+		require.NoError(t, mt.AddGenericEntry(ctx, ge))
+	}
+
+	ge := &merkletree.GenericEntry{Index: elems(200, 20), Value: elems(2, 3)}
+	p, err := mt.GenerateGenericEntryProof(ctx, ge, nil)
+	require.NoError(t, err)
+	assert.True(t, p.Existence)
+	assert.True(t, merkletree.VerifyGenericEntryProof(mt.Root(), p, ge))
+
+	updated := ge.Clone()
+	updated.Value = elems(50, 1)
+	_, err = mt.GenerateGenericEntryProof(ctx, updated, nil)
+	require.ErrorIs(t, err, merkletree.ErrEntryValueMismatch)
+	_, err = mt.UpdateGenericEntry(ctx, updated)
+	require.NoError(t, err)
+	p, err = mt.GenerateGenericEntryProof(ctx, updated, nil)
+	require.NoError(t, err)
+	assert.True(t, merkletree.VerifyGenericEntryProof(mt.Root(), p, updated))
+	assert.False(t, merkletree.VerifyGenericEntryProof(mt.Root(), p, ge))
+
+	require.ErrorIs(t, mt.DeleteGenericEntry(ctx, ge),
+		merkletree.ErrEntryValueMismatch)
+	require.NoError(t, mt.DeleteGenericEntry(ctx, updated))
+	// an absent entry has no proof, and a valid proof of non-existence of
+	// its index doesn't verify it
+	_, err = mt.GenerateGenericEntryProof(ctx, updated, nil)
+	require.ErrorIs(t, err, merkletree.ErrKeyNotFound)
+	hIndex, err := updated.HIndex()
+	require.NoError(t, err)
+	p, _, err = mt.GenerateProof(ctx, hIndex.BigInt(), nil)
+	require.NoError(t, err)
+	require.False(t, p.Existence)
+	assert.False(t, merkletree.VerifyGenericEntryProof(mt.Root(), p, updated))
+
+	notInField := &merkletree.GenericEntry{Index: elems(1, 1),
+		Value: []merkletree.ElemBytes{{0xff, 0xff, 0xff, 0xff, 0xff, 0xff,
+			0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff,
+			0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff,
+			0xff, 0xff, 0xff, 0xff}}}
+	require.ErrorIs(t, mt.AddGenericEntry(ctx, notInField),
+		merkletree.ErrEntryNotInField)
+}
+
+func TestGenericEntryStored(t *testing.T) {
+	ctx := context.Background()
+	mt, err := merkletree.NewMerkleTree(ctx, memory.NewMemoryStorage(), 10)
+	require.NoError(t, err)
+	ge := &merkletree.GenericEntry{Index: elems(100, 20), Value: elems(1, 3)}
+	require.NoError(t, mt.AddGenericEntry(ctx, ge))
+	require.NoError(t, mt.AddEntry(ctx, testEntry(1, 10)))
+
+	hIndex, err := ge.HIndex()
+	require.NoError(t, err)
+	got, err := mt.GetGenericEntry(ctx, hIndex)
+	require.NoError(t, err)
+	assert.True(t, ge.Equal(got))
+	// it doesn't have the layout of an Entry
+	_, err = mt.GetEntry(ctx, hIndex)
+	require.ErrorIs(t, err, merkletree.ErrEntryLayout)
+
+	// the Entries can be read as GenericEntries too
+	hIndex, err = testEntry(1, 10).HIndex()
+	require.NoError(t, err)
+	got, err = mt.GetGenericEntry(ctx, hIndex)
+	require.NoError(t, err)
+	assert.True(t, merkletree.NewGenericEntryFromEntry(testEntry(1, 10)).Equal(got))
+
+	// the updated GenericEntry is stored
+	updated := ge.Clone()
+	updated.Value = elems(50, 1)
+	_, err = mt.UpdateGenericEntry(ctx, updated)
+	require.NoError(t, err)
+	hIndex, err = ge.HIndex()
+	require.NoError(t, err)
+	got, err = mt.GetGenericEntry(ctx, hIndex)
+	require.NoError(t, err)
+	assert.True(t, updated.Equal(got))
+
+	var buf bytes.Buffer
+	require.NoError(t, mt.DumpEntries(ctx, &buf, nil))
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(t, lines, 2)
+	entryText, err := testEntry(1, 10).MarshalText()
+	require.NoError(t, err)
+	updatedText, err := updated.MarshalText()
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{string(entryText), string(updatedText)},
+		lines)
+}
@@ -0,0 +1,124 @@
+package merkletree
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+
+	"github.com/iden3/go-iden3-crypto/constants"
+	"github.com/iden3/go-iden3-crypto/keccak256"
+)
+
+var (
+	// ErrUnknownHasher is used when a Hasher name is not registered.
+	ErrUnknownHasher = errors.New("unknown hasher")
+	// ErrHasherMismatch is used when a proof, a dump or a stored tree is
+	// used with a different Hasher than the one that generated it.
+	ErrHasherMismatch = errors.New("hasher mismatch")
+)
+
+// Hasher is the hash function used to compute the keys of the nodes of a
+// MerkleTree. The middle nodes are hashed as H(ChildL, ChildR) and the leafs
+// as H(hIndex, hValue, 1). The result must be an element of the finite field.
+type Hasher interface {
+	// Name returns the name that identifies the hash function.
+	Name() string
+	// Hash hashes the given elements of the finite field.
+	Hash(elems ...*big.Int) (*Hash, error)
+}
+
+// PoseidonHasher is the default Hasher, compatible with the circom circuits
+// implementations.
+type PoseidonHasher struct{}
+
+// Name returns the name of the PoseidonHasher
+func (PoseidonHasher) Name() string {
+	return "poseidon"
+}
+
+// Hash performs a poseidon hash over the elements
+func (PoseidonHasher) Hash(elems ...*big.Int) (*Hash, error) {
+	return HashElems(elems...)
+}
+
+// Keccak256Hasher is a Hasher based on Keccak256, cheap to verify in the EVM.
+// The elements are hashed as 32 bytes big endian words, and the result is
+// reduced modulo the order of the finite field.
+type Keccak256Hasher struct{}
+
+// Name returns the name of the Keccak256Hasher
+func (Keccak256Hasher) Name() string {
+	return "keccak256"
+}
+
+// Hash performs a keccak256 hash over the elements
+func (Keccak256Hasher) Hash(elems ...*big.Int) (*Hash, error) {
+	return hashWordsInField(keccak256.Hash(elemsToWords(elems)))
+}
+
+// SHA256Hasher is a Hasher based on SHA-256. The elements are hashed as 32
+// bytes big endian words, and the result is reduced modulo the order of the
+// finite field.
+type SHA256Hasher struct{}
+
+// Name returns the name of the SHA256Hasher
+func (SHA256Hasher) Name() string {
+	return "sha256"
+}
+
+// Hash performs a sha256 hash over the elements
+func (SHA256Hasher) Hash(elems ...*big.Int) (*Hash, error) {
+	h := sha256.Sum256(elemsToWords(elems))
+	return hashWordsInField(h[:])
+}
+
+// elemsToWords concatenates the elements as 32 bytes big endian words.
+func elemsToWords(elems []*big.Int) []byte {
+	b := make([]byte, len(elems)*ElemBytesLen)
+	for i, e := range elems {
+		e.FillBytes(b[i*ElemBytesLen : (i+1)*ElemBytesLen])
+	}
+	return b
+}
+
+// hashWordsInField returns the Hash of a big endian digest reduced modulo the
+// order of the finite field.
+func hashWordsInField(digest []byte) (*Hash, error) {
+	bi := new(big.Int).SetBytes(digest)
+	return NewHashFromBigInt(bi.Mod(bi, constants.Q))
+}
+
+var (
+	hashersMu sync.RWMutex
+	hashers   = map[string]Hasher{
+		PoseidonHasher{}.Name():  PoseidonHasher{},
+		Keccak256Hasher{}.Name(): Keccak256Hasher{},
+		SHA256Hasher{}.Name():    SHA256Hasher{},
+	}
+)
+
+// RegisterHasher registers a Hasher by its name, so it can be found by
+// HasherByName when decoding proofs that reference it.
+func RegisterHasher(h Hasher) {
+	hashersMu.Lock()
+	defer hashersMu.Unlock()
+	hashers[h.Name()] = h
+}
+
+// HasherByName returns the registered Hasher with the given name.
+func HasherByName(name string) (Hasher, error) {
+	hashersMu.RLock()
+	defer hashersMu.RUnlock()
+	h, ok := hashers[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %v", ErrUnknownHasher, name)
+	}
+	return h, nil
+}
+
+// sameHasher returns whether both Hashers are the same hash function.
+func sameHasher(h1, h2 Hasher) bool {
+	return h1.Name() == h2.Name()
+}
@@ -0,0 +1,151 @@
+package merkletree_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"math/big"
+	"testing"
+
+	"github.com/iden3/go-merkletree-sql/v2"
+	"github.com/iden3/go-merkletree-sql/v2/db/memory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSHA256Hasher(t *testing.T) {
+	ctx := context.Background()
+	mt, err := merkletree.NewMerkleTreeWithHasher(ctx,
+		memory.NewMemoryStorage(), 10, merkletree.SHA256Hasher{})
+	require.NoError(t, err)
+
+	require.NoError(t, mt.Add(ctx, big.NewInt(1), big.NewInt(2)))
+	// sha256(1 || 2 || 1) mod Q, with 32 bytes big endian words
+	assert.Equal(t,
+		"12706785387696581956567559738757753774998074983498493811414768079406356216426",
+		mt.Root().BigInt().String())
+}
+
+func TestKeccak256Hasher(t *testing.T) {
+	ctx := context.Background()
+	mt, err := merkletree.NewMerkleTree(ctx, memory.NewMemoryStorage(), 40,
+		merkletree.WithHasher(merkletree.Keccak256Hasher{}))
+	require.NoError(t, err)
+	mtPoseidon, err := merkletree.NewMerkleTree(ctx,
+		memory.NewMemoryStorage(), 40)
+	require.NoError(t, err)
+	for i := 0; i < 16; i++ {
+		k, v := big.NewInt(int64(i)), big.NewInt(int64(i*3))
+		require.NoError(t, mt.Add(ctx, k, v))
+		require.NoError(t, mtPoseidon.Add(ctx, k, v))
+	}
+	require.NoError(t, mt.Delete(ctx, big.NewInt(3)))
+	require.NoError(t, mtPoseidon.Delete(ctx, big.NewInt(3)))
+	assert.NotEqual(t, mtPoseidon.Root(), mt.Root())
+	assert.Equal(t, "keccak256", mt.Hasher().Name())
+
+	proof, v, err := mt.GenerateProof(ctx, big.NewInt(5), nil)
+	require.NoError(t, err)
+	assert.Equal(t, "keccak256", proof.Hasher().Name())
+	assert.True(t, merkletree.VerifyProof(mt.Root(), proof, big.NewInt(5), v))
+	assert.True(t, merkletree.VerifyProofWithHasher(merkletree.Keccak256Hasher{},
+		mt.Root(), proof, big.NewInt(5), v))
+	assert.False(t, merkletree.VerifyProofWithHasher(merkletree.PoseidonHasher{},
+		mt.Root(), proof, big.NewInt(5), v))
+	_, err = merkletree.RootFromProofWithHasher(merkletree.PoseidonHasher{},
+		proof, big.NewInt(5), v)
+	assert.Equal(t, merkletree.ErrHasherMismatch, err)
+
+	// the hasher is kept in the JSON serialization
+	b, err := json.Marshal(proof)
+	require.NoError(t, err)
+	assert.Contains(t, string(b), `"hasher":"keccak256"`)
+	var p merkletree.Proof
+	require.NoError(t, json.Unmarshal(b, &p))
+	assert.Equal(t, "keccak256", p.Hasher().Name())
+	assert.True(t, merkletree.VerifyProof(mt.Root(), &p, big.NewInt(5), v))
+
+	// but not in the serialization of proofs with the default hasher
+	proof, _, err = mtPoseidon.GenerateProof(ctx, big.NewInt(5), nil)
+	require.NoError(t, err)
+	b, err = json.Marshal(proof)
+	require.NoError(t, err)
+	assert.NotContains(t, string(b), "hasher")
+
+	err = json.Unmarshal([]byte(`{"existence":true,"siblings":[],"hasher":"unknown"}`), &p)
+	assert.ErrorIs(t, err, merkletree.ErrUnknownHasher)
+}
+
+func TestStoredHasher(t *testing.T) {
+	ctx := context.Background()
+	sto := memory.NewMemoryStorage()
+	mt, err := merkletree.NewMerkleTree(ctx, sto, 40,
+		merkletree.WithHasher(merkletree.SHA256Hasher{}))
+	require.NoError(t, err)
+	require.NoError(t, mt.Add(ctx, big.NewInt(1), big.NewInt(2)))
+
+	// without the option, the tree is reopened with the stored hasher
+	mt2, err := merkletree.NewMerkleTree(ctx, sto, 40)
+	require.NoError(t, err)
+	assert.Equal(t, "sha256", mt2.Hasher().Name())
+	require.NoError(t, mt2.Add(ctx, big.NewInt(3), big.NewInt(4)))
+	ro, err := merkletree.OpenReadOnly(ctx, sto, 40)
+	require.NoError(t, err)
+	assert.Equal(t, "sha256", ro.Hasher().Name())
+
+	// and a different hasher is rejected
+	_, err = merkletree.NewMerkleTree(ctx, sto, 40,
+		merkletree.WithHasher(merkletree.PoseidonHasher{}))
+	assert.ErrorIs(t, err, merkletree.ErrHasherMismatch)
+	_, err = merkletree.NewMerkleTree(ctx, sto, 40,
+		merkletree.WithHasher(merkletree.SHA256Hasher{}))
+	assert.NoError(t, err)
+
+	// a read-only tree doesn't store the hasher of a new tree
+	sto = memory.NewMemoryStorage()
+	_, err = merkletree.OpenReadOnly(ctx, sto, 40,
+		merkletree.WithHasher(merkletree.Keccak256Hasher{}))
+	require.NoError(t, err)
+	_, err = sto.GetHasherName(ctx)
+	assert.ErrorIs(t, err, merkletree.ErrNotFound)
+}
+
+func TestProofBinaryHasher(t *testing.T) {
+	ctx := context.Background()
+	mt, err := merkletree.NewMerkleTree(ctx, memory.NewMemoryStorage(), 40,
+		merkletree.WithHasher(merkletree.Keccak256Hasher{}))
+	require.NoError(t, err)
+	for i := int64(0); i < 8; i++ {
+		require.NoError(t, mt.Add(ctx, big.NewInt(i), big.NewInt(i*3)))
+	}
+
+	for _, k := range []int64{5, 100} {
+		proof, v, err := mt.GenerateProof(ctx, big.NewInt(k), nil)
+		require.NoError(t, err)
+
+		// the hasher is kept in the binary formats
+		b, err := proof.MarshalBinary()
+		require.NoError(t, err)
+		var p merkletree.Proof
+		require.NoError(t, p.UnmarshalBinary(b))
+		assert.Equal(t, "keccak256", p.Hasher().Name())
+		assert.True(t, merkletree.VerifyProof(mt.Root(), &p, big.NewInt(k), v))
+
+		p2, err := merkletree.NewProofFromBytes(proof.Bytes())
+		require.NoError(t, err)
+		assert.Equal(t, "keccak256", p2.Hasher().Name())
+		assert.True(t, merkletree.VerifyProof(mt.Root(), p2, big.NewInt(k), v))
+	}
+
+	// a proof of an unknown hasher is rejected
+	proof, _, err := mt.GenerateProof(ctx, big.NewInt(5), nil)
+	require.NoError(t, err)
+	b := proof.Bytes()
+	nameStart := bytes.Index(b, []byte("keccak256"))
+	require.True(t, nameStart > 0)
+	b[nameStart] = 'x'
+	_, err = merkletree.NewProofFromBytes(b)
+	assert.ErrorIs(t, err, merkletree.ErrUnknownHasher)
+	_, err = merkletree.NewProofFromBytes(b[:nameStart+3])
+	assert.ErrorIs(t, err, merkletree.ErrInvalidProofBytes)
+}
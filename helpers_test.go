@@ -0,0 +1,30 @@
+package merkletree_test
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/iden3/go-merkletree-sql/v2"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestTree returns a MerkleTree of maxLevels levels on the given Storage,
+// with the leafs i => i*2 for i in [0, n).
+func newTestTree(t *testing.T, storage merkletree.Storage, maxLevels, n int,
+	opts ...merkletree.Option) *merkletree.MerkleTree {
+	mt, err := merkletree.NewMerkleTree(context.Background(), storage,
+		maxLevels, opts...)
+	require.NoError(t, err)
+	addTestLeafs(t, mt, 0, n)
+	return mt
+}
+
+// addTestLeafs adds the leafs i => i*2 for i in [from, to) to the MerkleTree.
+func addTestLeafs(t *testing.T, mt *merkletree.MerkleTree, from, to int) {
+	for i := from; i < to; i++ {
+		err := mt.Add(context.Background(), big.NewInt(int64(i)),
+			big.NewInt(int64(i*2)))
+		require.NoError(t, err)
+	}
+}
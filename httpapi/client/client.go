@@ -0,0 +1,367 @@
+// Package client implements a client of the API served by httpapi.Handler
+// that doesn't trust the server: every proof is verified locally against the
+// expected root before it's returned.
+//
+// A Client implements Tree, the read side of a MerkleTree, so it can replace a
+// local tree in the code paths that only read and prove.
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/iden3/go-merkletree-sql/v2"
+	"github.com/iden3/go-merkletree-sql/v2/httpapi"
+)
+
+var (
+	// ErrInvalidProof is used when a proof returned by the server doesn't
+	// verify against the expected root.
+	ErrInvalidProof = errors.New("the server returned an invalid proof")
+	// ErrRootMismatch is used when the server answers for a root different
+	// from the requested one.
+	ErrRootMismatch = errors.New("the server returned a different root")
+	// ErrRootRejected is used when a root of the server is rejected by the
+	// root validator of the Client.
+	ErrRootRejected = errors.New("the root was rejected")
+)
+
+// Tree is the read side of a MerkleTree, implemented by both
+// *merkletree.MerkleTree and *Client.
+type Tree interface {
+	Root() *merkletree.Hash
+	Hasher() merkletree.Hasher
+	Get(ctx context.Context,
+		k *big.Int) (*big.Int, *big.Int, []*merkletree.Hash, error)
+	GenerateProof(ctx context.Context, k *big.Int,
+		rootKey *merkletree.Hash) (*merkletree.Proof, *big.Int, error)
+	GenerateCircomVerifierProof(ctx context.Context, k *big.Int,
+		rootKey *merkletree.Hash) (*merkletree.CircomVerifierProof, error)
+	GenerateSCVerifierProof(ctx context.Context, k *big.Int,
+		rootKey *merkletree.Hash) (*merkletree.CircomVerifierProof, error)
+}
+
+// APIError is an error response of the server. The errors with status 404
+// wrap merkletree.ErrNotFound.
+type APIError struct {
+	StatusCode int
+	Message    string
+}
+
+// Error implements the error interface
+func (e *APIError) Error() string {
+	return fmt.Sprintf("merkletree api: %d %v: %v", e.StatusCode,
+		http.StatusText(e.StatusCode), e.Message)
+}
+
+// Unwrap returns merkletree.ErrNotFound for the errors with status 404
+func (e *APIError) Unwrap() error {
+	if e.StatusCode == http.StatusNotFound {
+		return merkletree.ErrNotFound
+	}
+	return nil
+}
+
+// RootValidator validates a root before it's used by a Client, for example
+// against a root published in a smart contract.
+type RootValidator func(ctx context.Context, root *merkletree.Hash) error
+
+// Client is a client of the API served by httpapi.Handler.
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+	hasher     merkletree.Hasher
+	pinned     *merkletree.Hash
+	validate   RootValidator
+
+	mu   sync.RWMutex
+	root *merkletree.Hash
+}
+
+// Option configures a Client.
+type Option func(*Client)
+
+// WithHTTPClient sets the http.Client used for the requests. By default
+// http.DefaultClient is used.
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = hc
+	}
+}
+
+// WithHasher sets the Hasher used to verify the proofs, which must be the one
+// of the tree of the server. By default the PoseidonHasher is used.
+func WithHasher(h merkletree.Hasher) Option {
+	return func(c *Client) {
+		c.hasher = h
+	}
+}
+
+// WithPinnedRoot pins the root of the Client: the current root of the server
+// is never fetched, and all the requests without an explicit root use the
+// given one.
+func WithPinnedRoot(root *merkletree.Hash) Option {
+	return func(c *Client) {
+		c.pinned = root
+	}
+}
+
+// WithRootValidator sets a RootValidator called with each new current root
+// fetched from the server. If it returns an error the root is not used.
+func WithRootValidator(v RootValidator) Option {
+	return func(c *Client) {
+		c.validate = v
+	}
+}
+
+// New returns a Client of the API served at baseURL, configured with the
+// given Options. Unless the root is pinned, the current root of the server is
+// fetched and validated.
+func New(ctx context.Context, baseURL string, opts ...Option) (*Client,
+	error) {
+	c := &Client{
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		httpClient: http.DefaultClient,
+		hasher:     merkletree.PoseidonHasher{},
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.pinned != nil {
+		c.root = c.pinned
+		return c, nil
+	}
+	if _, err := c.Refresh(ctx); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Root returns the root used by the requests without an explicit root: the
+// pinned root, or the last root fetched by Refresh.
+func (c *Client) Root() *merkletree.Hash {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.root
+}
+
+// Hasher returns the Hasher used to verify the proofs
+func (c *Client) Hasher() merkletree.Hasher {
+	return c.hasher
+}
+
+// Refresh fetches the current root of the server, validates it, and uses it
+// for the next requests. If the root is pinned, it returns the pinned root
+// without contacting the server.
+func (c *Client) Refresh(ctx context.Context) (*merkletree.Hash, error) {
+	if c.pinned != nil {
+		return c.pinned, nil
+	}
+	var resp httpapi.RootResponse
+	if err := c.get(ctx, "/root", nil, &resp); err != nil {
+		return nil, err
+	}
+	if resp.Root == nil {
+		return nil, fmt.Errorf("merkletree api: missing root")
+	}
+	if c.validate != nil {
+		if err := c.validate(ctx, resp.Root); err != nil {
+			return nil, fmt.Errorf("%w: %v: %v", ErrRootRejected,
+				resp.Root.BigInt(), err)
+		}
+	}
+	c.mu.Lock()
+	c.root = resp.Root
+	c.mu.Unlock()
+	return resp.Root, nil
+}
+
+// Roots returns the root history of the server. The roots are not verified.
+func (c *Client) Roots(ctx context.Context) ([]*merkletree.Hash, error) {
+	var resp httpapi.RootsResponse
+	if err := c.get(ctx, "/roots", nil, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Roots, nil
+}
+
+// Get returns the value of the leaf for the given key under the root of the
+// Client, like MerkleTree.Get. The value is obtained from a verified proof.
+func (c *Client) Get(ctx context.Context,
+	k *big.Int) (*big.Int, *big.Int, []*merkletree.Hash, error) {
+	p, v, err := c.GenerateProof(ctx, k, nil)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	siblings := merkletree.SiblingsFromProof(p)
+	switch {
+	case p.Existence:
+		return k, v, siblings, nil
+	case p.NodeAux != nil:
+		return p.NodeAux.Key.BigInt(), p.NodeAux.Value.BigInt(), siblings,
+			merkletree.ErrKeyNotFound
+	default:
+		return big.NewInt(0), big.NewInt(0), siblings,
+			merkletree.ErrKeyNotFound
+	}
+}
+
+// GenerateProof returns the proof of existence or non-existence of the key
+// under the given root, like MerkleTree.GenerateProof. If rootKey is nil, the
+// root of the Client is used. The proof is verified before it's returned.
+func (c *Client) GenerateProof(ctx context.Context, k *big.Int,
+	rootKey *merkletree.Hash) (*merkletree.Proof, *big.Int, error) {
+	root, kHash, err := c.request(k, rootKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	var resp httpapi.ProofResponse
+	if err := c.get(ctx, "/proofs/"+k.String(), root, &resp); err != nil {
+		return nil, nil, err
+	}
+	if resp.Proof == nil {
+		return nil, nil, fmt.Errorf("%w: missing proof", ErrInvalidProof)
+	}
+	if err := checkRootAndKey(root, resp.Root, kHash, resp.Key); err != nil {
+		return nil, nil, err
+	}
+
+	v := big.NewInt(0)
+	if resp.Proof.Existence {
+		if resp.Value == nil {
+			return nil, nil, fmt.Errorf("%w: missing value", ErrInvalidProof)
+		}
+		v = resp.Value.BigInt()
+	}
+	if !merkletree.VerifyProofWithHasher(c.hasher, root, resp.Proof, k, v) {
+		return nil, nil, ErrInvalidProof
+	}
+	if resp.Proof.NodeAux != nil {
+		// like MerkleTree.GenerateProof, return the value of the leaf found
+		v = resp.Proof.NodeAux.Value.BigInt()
+	}
+	return resp.Proof, v, nil
+}
+
+// GenerateCircomVerifierProof returns the CircomVerifierProof for the key
+// under the given root, like MerkleTree.GenerateCircomVerifierProof. If
+// rootKey is nil, the root of the Client is used. The proof is verified before
+// it's returned.
+func (c *Client) GenerateCircomVerifierProof(ctx context.Context, k *big.Int,
+	rootKey *merkletree.Hash) (*merkletree.CircomVerifierProof, error) {
+	return c.verifierProof(ctx, "verifier", k, rootKey)
+}
+
+// GenerateSCVerifierProof returns the CircomVerifierProof for the key under
+// the given root without the extra siblings of the circom circuits, like
+// MerkleTree.GenerateSCVerifierProof. If rootKey is nil, the root of the
+// Client is used. The proof is verified before it's returned.
+func (c *Client) GenerateSCVerifierProof(ctx context.Context, k *big.Int,
+	rootKey *merkletree.Hash) (*merkletree.CircomVerifierProof, error) {
+	return c.verifierProof(ctx, "sc", k, rootKey)
+}
+
+// verifierProof fetches a CircomVerifierProof of the given kind and verifies
+// it, rebuilding the Proof from its siblings.
+func (c *Client) verifierProof(ctx context.Context, kind string, k *big.Int,
+	rootKey *merkletree.Hash) (*merkletree.CircomVerifierProof, error) {
+	root, kHash, err := c.request(k, rootKey)
+	if err != nil {
+		return nil, err
+	}
+	var cp merkletree.CircomVerifierProof
+	if err := c.get(ctx, "/proofs/"+k.String()+"/"+kind, root,
+		&cp); err != nil {
+		return nil, err
+	}
+	if cp.Key == nil || cp.Value == nil || cp.OldKey == nil ||
+		cp.OldValue == nil {
+		return nil, fmt.Errorf("%w: missing fields", ErrInvalidProof)
+	}
+	if err := checkRootAndKey(root, cp.Root, kHash, cp.Key); err != nil {
+		return nil, err
+	}
+
+	var nodeAux *merkletree.NodeAux
+	v := cp.Value.BigInt()
+	switch cp.Fnc {
+	case 0: // inclusion
+	case 1: // non inclusion
+		if !cp.IsOld0 {
+			nodeAux = &merkletree.NodeAux{Key: cp.OldKey, Value: cp.OldValue}
+		}
+		v = big.NewInt(0)
+	default:
+		return nil, fmt.Errorf("%w: invalid fnc %d", ErrInvalidProof, cp.Fnc)
+	}
+	p, err := merkletree.NewProofFromData(cp.Fnc == 0, cp.Siblings, nodeAux)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidProof, err)
+	}
+	if !merkletree.VerifyProofWithHasher(c.hasher, root, p, k, v) {
+		return nil, ErrInvalidProof
+	}
+	return &cp, nil
+}
+
+// request returns the root and the key of a request. If rootKey is nil, the
+// root of the Client is used.
+func (c *Client) request(k *big.Int,
+	rootKey *merkletree.Hash) (*merkletree.Hash, *merkletree.Hash, error) {
+	if rootKey == nil {
+		rootKey = c.Root()
+	}
+	kHash, err := merkletree.NewHashFromBigInt(k)
+	if err != nil {
+		return nil, nil, fmt.Errorf("can't create hash from Key: %w", err)
+	}
+	return rootKey, kHash, nil
+}
+
+// checkRootAndKey checks that a response is for the requested root and key.
+func checkRootAndKey(root, gotRoot, k, gotK *merkletree.Hash) error {
+	if gotRoot == nil || !gotRoot.Equals(root) {
+		return ErrRootMismatch
+	}
+	if gotK == nil || !gotK.Equals(k) {
+		return fmt.Errorf("%w: key mismatch", ErrInvalidProof)
+	}
+	return nil
+}
+
+// get sends a GET request for the path under the given root, if not nil, and
+// decodes the JSON response into v.
+func (c *Client) get(ctx context.Context, path string, root *merkletree.Hash,
+	v interface{}) error {
+	u := c.baseURL + path
+	if root != nil {
+		u += "?" + url.Values{"root": {root.BigInt().String()}}.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		var e httpapi.ErrorResponse
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		if json.Unmarshal(body, &e) != nil || e.Error == "" {
+			e.Error = strings.TrimSpace(string(body))
+		}
+		return &APIError{StatusCode: resp.StatusCode, Message: e.Error}
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
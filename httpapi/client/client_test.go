@@ -0,0 +1,196 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/iden3/go-merkletree-sql/v2"
+	"github.com/iden3/go-merkletree-sql/v2/db/memory"
+	"github.com/iden3/go-merkletree-sql/v2/httpapi"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	_ Tree = (*merkletree.MerkleTree)(nil)
+	_ Tree = (*Client)(nil)
+)
+
+func newTestServer(t *testing.T, n int,
+	wrap func(http.Handler) http.Handler) (*merkletree.MerkleTree,
+	*httptest.Server) {
+	ctx := context.Background()
+	mt, err := merkletree.NewMerkleTree(ctx, memory.NewMemoryStorage(), 10)
+	require.NoError(t, err)
+	for i := 1; i <= n; i++ {
+		require.NoError(t, mt.Add(ctx, big.NewInt(int64(i)),
+			big.NewInt(int64(i*10))))
+	}
+	var h http.Handler = httpapi.NewHandler(mt)
+	if wrap != nil {
+		h = wrap(h)
+	}
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+	return mt, srv
+}
+
+func TestClientMatchesTree(t *testing.T) {
+	ctx := context.Background()
+	mt, srv := newTestServer(t, 5, nil)
+	c, err := New(ctx, srv.URL)
+	require.NoError(t, err)
+	assert.Equal(t, mt.Root(), c.Root())
+
+	for _, tree := range []Tree{mt, c} {
+		// existence, non-existence with and without a leaf in the path
+		for _, k := range []int64{1, 3, 6, 9} {
+			key := big.NewInt(k)
+			expK, expV, expSiblings, expErr := mt.Get(ctx, key)
+			gotK, gotV, gotSiblings, gotErr := tree.Get(ctx, key)
+			assert.Equal(t, expErr, gotErr, k)
+			assert.Equal(t, 0, expK.Cmp(gotK), k)
+			assert.Equal(t, 0, expV.Cmp(gotV), k)
+			assert.Equal(t, expSiblings, gotSiblings, k)
+
+			expP, expV, err := mt.GenerateProof(ctx, key, nil)
+			require.NoError(t, err)
+			gotP, gotV, err := tree.GenerateProof(ctx, key, nil)
+			require.NoError(t, err)
+			assert.Equal(t, expP.Bytes(), gotP.Bytes(), k)
+			assert.Equal(t, 0, expV.Cmp(gotV), k)
+
+			expCP, err := mt.GenerateCircomVerifierProof(ctx, key, nil)
+			require.NoError(t, err)
+			gotCP, err := tree.GenerateCircomVerifierProof(ctx, key, nil)
+			require.NoError(t, err)
+			assert.Equal(t, expCP, gotCP, k)
+
+			expCP, err = mt.GenerateSCVerifierProof(ctx, key, nil)
+			require.NoError(t, err)
+			gotCP, err = tree.GenerateSCVerifierProof(ctx, key, nil)
+			require.NoError(t, err)
+			assert.Equal(t, expCP, gotCP, k)
+		}
+	}
+}
+
+func TestRoots(t *testing.T) {
+	ctx := context.Background()
+	mt, srv := newTestServer(t, 2, nil)
+	oldRoot := mt.Root()
+	c, err := New(ctx, srv.URL)
+	require.NoError(t, err)
+
+	require.NoError(t, mt.Add(ctx, big.NewInt(3), big.NewInt(30)))
+	_, _, _, err = c.Get(ctx, big.NewInt(3))
+	assert.ErrorIs(t, err, merkletree.ErrKeyNotFound)
+
+	root, err := c.Refresh(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, mt.Root(), root)
+	_, v, _, err := c.Get(ctx, big.NewInt(3))
+	require.NoError(t, err)
+	assert.Equal(t, "30", v.String())
+
+	roots, err := c.Roots(ctx)
+	require.NoError(t, err)
+	require.Len(t, roots, 4)
+	assert.Equal(t, []*merkletree.Hash{oldRoot, mt.Root()}, roots[2:])
+
+	// a pinned root never changes
+	pinned, err := New(ctx, srv.URL, WithPinnedRoot(oldRoot))
+	require.NoError(t, err)
+	root, err = pinned.Refresh(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, oldRoot, root)
+	_, _, _, err = pinned.Get(ctx, big.NewInt(3))
+	assert.ErrorIs(t, err, merkletree.ErrKeyNotFound)
+
+	// unknown roots are not found
+	_, _, err = c.GenerateProof(ctx, big.NewInt(1), &merkletree.Hash{1})
+	var apiErr *APIError
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, http.StatusNotFound, apiErr.StatusCode)
+	assert.ErrorIs(t, err, merkletree.ErrNotFound)
+
+	errRejected := errors.New("not published")
+	_, err = New(ctx, srv.URL, WithRootValidator(
+		func(_ context.Context, root *merkletree.Hash) error {
+			if root.Equals(oldRoot) {
+				return nil
+			}
+			return errRejected
+		}))
+	assert.ErrorIs(t, err, ErrRootRejected)
+}
+
+// tamper returns a wrapper of a handler that replaces old with new in the
+// responses.
+func tamper(old, new string) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, r)
+			w.WriteHeader(rec.Code)
+			_, _ = w.Write(bytes.ReplaceAll(rec.Body.Bytes(), []byte(old),
+				[]byte(new)))
+		})
+	}
+}
+
+func TestTamperedResponses(t *testing.T) {
+	ctx := context.Background()
+	// the value of the leaf 2 is 20
+	_, srv := newTestServer(t, 3, tamper(`"value":"20"`, `"value":"21"`))
+	c, err := New(ctx, srv.URL)
+	require.NoError(t, err)
+	_, _, _, err = c.Get(ctx, big.NewInt(2))
+	assert.ErrorIs(t, err, ErrInvalidProof)
+	_, err = c.GenerateCircomVerifierProof(ctx, big.NewInt(2), nil)
+	assert.ErrorIs(t, err, ErrInvalidProof)
+	// other leafs are not affected
+	_, v, _, err := c.Get(ctx, big.NewInt(3))
+	require.NoError(t, err)
+	assert.Equal(t, "30", v.String())
+
+	// a proof of existence turned into a proof of non-existence
+	_, srv = newTestServer(t, 3, tamper(`"existence":true`,
+		`"existence":false`))
+	c, err = New(ctx, srv.URL)
+	require.NoError(t, err)
+	_, _, _, err = c.Get(ctx, big.NewInt(2))
+	assert.ErrorIs(t, err, ErrInvalidProof)
+
+	// a response for another root
+	mt, srv := newTestServer(t, 3, nil)
+	oldRoot := mt.Root()
+	require.NoError(t, mt.Add(ctx, big.NewInt(4), big.NewInt(40)))
+	newRoot := mt.Root().BigInt().String()
+	_, srv = newTestServer(t, 0, func(http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r.URL.RawQuery = strings.ReplaceAll(r.URL.RawQuery,
+				oldRoot.BigInt().String(), newRoot)
+			httpapi.NewHandler(mt).ServeHTTP(w, r)
+		})
+	})
+	c, err = New(ctx, srv.URL, WithPinnedRoot(oldRoot))
+	require.NoError(t, err)
+	_, _, err = c.GenerateProof(ctx, big.NewInt(4), nil)
+	assert.ErrorIs(t, err, ErrRootMismatch)
+}
+
+func TestHasher(t *testing.T) {
+	ctx := context.Background()
+	_, srv := newTestServer(t, 3, nil)
+	c, err := New(ctx, srv.URL, WithHasher(merkletree.Keccak256Hasher{}))
+	require.NoError(t, err)
+	_, _, err = c.GenerateProof(ctx, big.NewInt(2), nil)
+	assert.ErrorIs(t, err, ErrInvalidProof)
+}
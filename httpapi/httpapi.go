@@ -0,0 +1,472 @@
+// Package httpapi implements an http.Handler that exposes a MerkleTree as a
+// JSON API. All the payloads use the JSON marshalers of merkletree.Hash,
+// merkletree.Proof, merkletree.CircomVerifierProof and
+// merkletree.CircomProcessorProof, so hashes are encoded as decimal strings.
+//
+// The endpoints, relative to the path where the Handler is mounted, are:
+//
+//	GET    /root                       the current root
+//	GET    /roots                      the recent roots
+//	GET    /leafs/{key}?root=          the value of a leaf
+//	GET    /proofs/{key}?root=         a proof of existence or non-existence
+//	GET    /proofs/{key}/verifier?root=  a CircomVerifierProof
+//	GET    /proofs/{key}/sc?root=      a CircomVerifierProof for smart contracts
+//	POST   /leafs                      adds a leaf, if mutations are enabled
+//	PUT    /leafs/{key}                updates a leaf, if mutations are enabled
+//	DELETE /leafs/{key}                deletes a leaf, if mutations are enabled
+//
+// Keys and roots in the paths and the queries are decimal. The responses
+// of the GET endpoints with an explicit root never change, so they can be
+// cached by the root hash. The client package implements a client that
+// verifies all the proofs.
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/iden3/go-merkletree-sql/v2"
+)
+
+// defaultRootHistorySize is the default number of roots kept by the Handler.
+const defaultRootHistorySize = 256
+
+var (
+	// ErrMutationsDisabled is used when a mutation is requested to a Handler
+	// without WithMutations.
+	ErrMutationsDisabled = errors.New("mutations are disabled")
+	// ErrInvalidRequest is used when a request can't be parsed.
+	ErrInvalidRequest = errors.New("invalid request")
+)
+
+// RootResponse is the response of GET /root.
+type RootResponse struct {
+	Root *merkletree.Hash `json:"root"`
+}
+
+// RootsResponse is the response of GET /roots. Roots are sorted from the
+// oldest to the current one.
+type RootsResponse struct {
+	Roots []*merkletree.Hash `json:"roots"`
+}
+
+// LeafResponse is the response of GET /leafs/{key}.
+type LeafResponse struct {
+	Root  *merkletree.Hash `json:"root"`
+	Key   *merkletree.Hash `json:"key"`
+	Value *merkletree.Hash `json:"value"`
+}
+
+// ProofResponse is the response of GET /proofs/{key}. Value is the value of
+// the leaf, and is nil for a proof of non-existence.
+type ProofResponse struct {
+	Root  *merkletree.Hash  `json:"root"`
+	Key   *merkletree.Hash  `json:"key"`
+	Value *merkletree.Hash  `json:"value,omitempty"`
+	Proof *merkletree.Proof `json:"proof"`
+}
+
+// LeafRequest is the body of POST /leafs and PUT /leafs/{key}. Key is
+// ignored by PUT, which takes the key from the path.
+type LeafRequest struct {
+	Key   *merkletree.Hash `json:"key,omitempty"`
+	Value *merkletree.Hash `json:"value"`
+}
+
+// ErrorResponse is the body of the responses with an error status.
+type ErrorResponse struct {
+	Error string `json:"error"`
+}
+
+// Handler is an http.Handler that serves a MerkleTree.
+type Handler struct {
+	mt          *merkletree.MerkleTree
+	mutations   bool
+	historySize int
+
+	// mutationMu serializes the mutations through the Handler
+	mutationMu sync.Mutex
+	// mu protects the history
+	mu          sync.Mutex
+	history     []*merkletree.Hash
+	unsubscribe func()
+}
+
+// Option configures a Handler.
+type Option func(*Handler)
+
+// WithMutations enables the endpoints that modify the MerkleTree, which must
+// be writable.
+func WithMutations() Option {
+	return func(h *Handler) {
+		h.mutations = true
+	}
+}
+
+// WithRootHistorySize sets the number of roots served by GET /roots.
+func WithRootHistorySize(size int) Option {
+	return func(h *Handler) {
+		h.historySize = size
+	}
+}
+
+// NewHandler returns a Handler that serves the given MerkleTree, configured
+// with the given Options. By default only the read endpoints are served.
+//
+// The root history is the one kept by the Storage of the MerkleTree if it
+// implements merkletree.RootLister. Otherwise, it contains the root of the
+// MerkleTree when the Handler is created, and the roots of all the later
+// modifications of the tree, which the Handler receives through
+// MerkleTree.Subscribe. Close unsubscribes the Handler.
+func NewHandler(mt *merkletree.MerkleTree, opts ...Option) *Handler {
+	h := &Handler{mt: mt, historySize: defaultRootHistorySize}
+	for _, opt := range opts {
+		opt(h)
+	}
+	h.observeRoot(h.currentRoot())
+	h.unsubscribe = mt.Subscribe(
+		func(_ context.Context, e merkletree.Event) error {
+			h.observeRoot(e.NewRoot)
+			return nil
+		})
+	return h
+}
+
+// Close stops the recording of the roots of the MerkleTree in the history.
+func (h *Handler) Close() {
+	h.unsubscribe()
+}
+
+// currentRoot returns the current root of the MerkleTree.
+func (h *Handler) currentRoot() *merkletree.Hash {
+	h.mt.RLock()
+	defer h.mt.RUnlock()
+	return h.mt.Root()
+}
+
+// observeRoot adds the root to the history if it's not the last one.
+func (h *Handler) observeRoot(root *merkletree.Hash) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if n := len(h.history); n > 0 && h.history[n-1].Equals(root) {
+		return
+	}
+	h.history = append(h.history, root)
+	if h.historySize > 0 && len(h.history) > h.historySize {
+		h.history = h.history[len(h.history)-h.historySize:]
+	}
+}
+
+// ServeHTTP implements the http.Handler interface
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	switch {
+	case len(parts) == 1 && parts[0] == "root":
+		h.serveRead(w, r, h.getRoot)
+	case len(parts) == 1 && parts[0] == "roots":
+		h.serveRoots(w, r)
+	case len(parts) == 1 && parts[0] == "leafs":
+		h.serveMutation(w, r, http.MethodPost, h.addLeaf)
+	case len(parts) == 2 && parts[0] == "leafs":
+		switch r.Method {
+		case http.MethodPut:
+			h.serveMutation(w, r, http.MethodPut, h.updateLeaf)
+		case http.MethodDelete:
+			h.serveMutation(w, r, http.MethodDelete, h.deleteLeaf)
+		default:
+			h.serveRead(w, r, h.getLeaf)
+		}
+	case len(parts) == 2 && parts[0] == "proofs":
+		h.serveRead(w, r, h.getProof)
+	case len(parts) == 3 && parts[0] == "proofs" && parts[2] == "verifier":
+		h.serveRead(w, r, h.getVerifierProof)
+	case len(parts) == 3 && parts[0] == "proofs" && parts[2] == "sc":
+		h.serveRead(w, r, h.getSCVerifierProof)
+	default:
+		writeError(w, http.StatusNotFound, errors.New("not found"))
+	}
+}
+
+// readFunc serves a read endpoint under the given root, which is the current
+// root if the request has no explicit root.
+type readFunc func(ctx context.Context, root *merkletree.Hash,
+	parts []string) (interface{}, error)
+
+// serveRead serves a GET endpoint. The root of the response is used as ETag.
+// If the request has an explicit root the response is immutable; otherwise it
+// must be revalidated, as the current root can change.
+func (h *Handler) serveRead(w http.ResponseWriter, r *http.Request,
+	f readFunc) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		writeError(w, http.StatusMethodNotAllowed,
+			fmt.Errorf("method %v not allowed", r.Method))
+		return
+	}
+	var root *merkletree.Hash
+	if s := r.URL.Query().Get("root"); s != "" {
+		var err error
+		root, err = parseHash(s)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	} else {
+		root = h.currentRoot()
+		w.Header().Set("Cache-Control", "no-cache")
+	}
+	etag := `"` + root.Hex() + `"`
+	w.Header().Set("ETag", etag)
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	resp, err := f(r.Context(), root, parts)
+	if err != nil {
+		w.Header().Del("Cache-Control")
+		w.Header().Del("ETag")
+		writeError(w, errorStatus(err), err)
+		return
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// mutationFunc serves a mutation endpoint, returning the CircomProcessorProof
+// of the mutation.
+type mutationFunc func(ctx context.Context, r *http.Request,
+	parts []string) (*merkletree.CircomProcessorProof, error)
+
+// serveMutation serves a mutation endpoint. The mutations through the Handler
+// are serialized, so the processor proofs are consistent.
+func (h *Handler) serveMutation(w http.ResponseWriter, r *http.Request,
+	method string, f mutationFunc) {
+	if r.Method != method {
+		w.Header().Set("Allow", method)
+		writeError(w, http.StatusMethodNotAllowed,
+			fmt.Errorf("method %v not allowed", r.Method))
+		return
+	}
+	if !h.mutations {
+		writeError(w, http.StatusForbidden, ErrMutationsDisabled)
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	h.mutationMu.Lock()
+	cp, err := f(r.Context(), r, parts)
+	h.mutationMu.Unlock()
+	if err != nil {
+		writeError(w, errorStatus(err), err)
+		return
+	}
+	writeJSON(w, http.StatusOK, cp)
+}
+
+func (h *Handler) getRoot(_ context.Context, root *merkletree.Hash,
+	_ []string) (interface{}, error) {
+	return RootResponse{Root: root}, nil
+}
+
+// serveRoots serves GET /roots. The history can change without a change of
+// the current root, so it's never cached.
+func (h *Handler) serveRoots(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		writeError(w, http.StatusMethodNotAllowed,
+			fmt.Errorf("method %v not allowed", r.Method))
+		return
+	}
+	roots, err := h.storedRoots(r.Context())
+	if errors.Is(err, merkletree.ErrRootListingNotSupported) {
+		h.mu.Lock()
+		roots = make([]*merkletree.Hash, len(h.history))
+		copy(roots, h.history)
+		h.mu.Unlock()
+	} else if err != nil {
+		writeError(w, errorStatus(err), err)
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, RootsResponse{Roots: roots})
+}
+
+// storedRoots returns the last roots of the history kept by the Storage of the
+// MerkleTree, ending with the current root.
+func (h *Handler) storedRoots(ctx context.Context) ([]*merkletree.Hash,
+	error) {
+	h.mt.RLock()
+	defer h.mt.RUnlock()
+	var roots []*merkletree.Hash
+	err := h.mt.ListRoots(ctx, func(root *merkletree.Hash) error {
+		r := *root
+		roots = append(roots, &r)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	current := h.mt.Root()
+	if n := len(roots); n == 0 || !roots[n-1].Equals(current) {
+		roots = append(roots, current)
+	}
+	if h.historySize > 0 && len(roots) > h.historySize {
+		roots = roots[len(roots)-h.historySize:]
+	}
+	return roots, nil
+}
+
+func (h *Handler) getLeaf(ctx context.Context, root *merkletree.Hash,
+	parts []string) (interface{}, error) {
+	k, err := parseHash(parts[1])
+	if err != nil {
+		return nil, err
+	}
+	mt, err := h.mt.Snapshot(ctx, root)
+	if err != nil {
+		return nil, err
+	}
+	_, v, _, err := mt.Get(ctx, k.BigInt())
+	if err != nil {
+		return nil, err
+	}
+	vHash, err := merkletree.NewHashFromBigInt(v)
+	if err != nil {
+		return nil, err
+	}
+	return LeafResponse{Root: root, Key: k, Value: vHash}, nil
+}
+
+func (h *Handler) getProof(ctx context.Context, root *merkletree.Hash,
+	parts []string) (interface{}, error) {
+	k, err := parseHash(parts[1])
+	if err != nil {
+		return nil, err
+	}
+	p, v, err := h.mt.GenerateProof(ctx, k.BigInt(), root)
+	if err != nil {
+		return nil, err
+	}
+	resp := ProofResponse{Root: root, Key: k, Proof: p}
+	if p.Existence {
+		resp.Value, err = merkletree.NewHashFromBigInt(v)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return resp, nil
+}
+
+func (h *Handler) getVerifierProof(ctx context.Context, root *merkletree.Hash,
+	parts []string) (interface{}, error) {
+	k, err := parseHash(parts[1])
+	if err != nil {
+		return nil, err
+	}
+	return h.mt.GenerateCircomVerifierProof(ctx, k.BigInt(), root)
+}
+
+func (h *Handler) getSCVerifierProof(ctx context.Context,
+	root *merkletree.Hash, parts []string) (interface{}, error) {
+	k, err := parseHash(parts[1])
+	if err != nil {
+		return nil, err
+	}
+	return h.mt.GenerateSCVerifierProof(ctx, k.BigInt(), root)
+}
+
+func (h *Handler) addLeaf(ctx context.Context, r *http.Request,
+	_ []string) (*merkletree.CircomProcessorProof, error) {
+	req, err := readLeafRequest(r)
+	if err != nil {
+		return nil, err
+	}
+	if req.Key == nil {
+		return nil, fmt.Errorf("%w: missing key", ErrInvalidRequest)
+	}
+	return h.mt.AddAndGetCircomProof(ctx, req.Key.BigInt(),
+		req.Value.BigInt())
+}
+
+func (h *Handler) updateLeaf(ctx context.Context, r *http.Request,
+	parts []string) (*merkletree.CircomProcessorProof, error) {
+	k, err := parseHash(parts[1])
+	if err != nil {
+		return nil, err
+	}
+	req, err := readLeafRequest(r)
+	if err != nil {
+		return nil, err
+	}
+	return h.mt.Update(ctx, k.BigInt(), req.Value.BigInt())
+}
+
+func (h *Handler) deleteLeaf(ctx context.Context, _ *http.Request,
+	parts []string) (*merkletree.CircomProcessorProof, error) {
+	k, err := parseHash(parts[1])
+	if err != nil {
+		return nil, err
+	}
+	return h.mt.DeleteAndGetCircomProof(ctx, k.BigInt())
+}
+
+// readLeafRequest decodes the LeafRequest in the body of a request.
+func readLeafRequest(r *http.Request) (*LeafRequest, error) {
+	var req LeafRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidRequest, err)
+	}
+	if req.Value == nil {
+		return nil, fmt.Errorf("%w: missing value", ErrInvalidRequest)
+	}
+	return &req, nil
+}
+
+// parseHash parses a decimal key or root of a request.
+func parseHash(s string) (*merkletree.Hash, error) {
+	i, ok := new(big.Int).SetString(s, 10)
+	if !ok || i.Sign() < 0 {
+		return nil, fmt.Errorf("%w: invalid number %q", ErrInvalidRequest, s)
+	}
+	h, err := merkletree.NewHashFromBigInt(i)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidRequest, err)
+	}
+	return h, nil
+}
+
+// errorStatus returns the HTTP status of an error.
+func errorStatus(err error) int {
+	switch {
+	case errors.Is(err, ErrInvalidRequest):
+		return http.StatusBadRequest
+	case errors.Is(err, merkletree.ErrKeyNotFound),
+		errors.Is(err, merkletree.ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, merkletree.ErrEntryIndexAlreadyExists):
+		return http.StatusConflict
+	case errors.Is(err, merkletree.ErrNotWritable):
+		return http.StatusForbidden
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, ErrorResponse{Error: err.Error()})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	// the status is already sent, so an encoding error can't be reported
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,232 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/iden3/go-merkletree-sql/v2"
+	"github.com/iden3/go-merkletree-sql/v2/db/memory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestTree(t *testing.T, n int) *merkletree.MerkleTree {
+	ctx := context.Background()
+	mt, err := merkletree.NewMerkleTree(ctx, memory.NewMemoryStorage(), 10)
+	require.NoError(t, err)
+	for i := 1; i <= n; i++ {
+		require.NoError(t, mt.Add(ctx, big.NewInt(int64(i)),
+			big.NewInt(int64(i*10))))
+	}
+	return mt
+}
+
+// do serves a request with the Handler, and decodes the JSON response into v
+// if it's not nil.
+func do(t *testing.T, h http.Handler, method, target, body string,
+	v interface{}) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, target, strings.NewReader(body))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if v != nil && w.Code == http.StatusOK {
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), v))
+	}
+	return w
+}
+
+func TestReadEndpoints(t *testing.T) {
+	mt := newTestTree(t, 3)
+	h := NewHandler(mt)
+
+	var root RootResponse
+	w := do(t, h, http.MethodGet, "/root", "", &root)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, mt.Root(), root.Root)
+	assert.Equal(t, "no-cache", w.Header().Get("Cache-Control"))
+
+	var leaf LeafResponse
+	w = do(t, h, http.MethodGet, "/leafs/2", "", &leaf)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "20", leaf.Value.BigInt().String())
+
+	w = do(t, h, http.MethodGet, "/leafs/4", "", nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	w = do(t, h, http.MethodGet, "/leafs/x", "", nil)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	var proof ProofResponse
+	w = do(t, h, http.MethodGet, "/proofs/2", "", &proof)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.True(t, proof.Proof.Existence)
+	assert.True(t, merkletree.VerifyProof(proof.Root, proof.Proof,
+		big.NewInt(2), proof.Value.BigInt()))
+
+	proof = ProofResponse{}
+	w = do(t, h, http.MethodGet, "/proofs/4", "", &proof)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.False(t, proof.Proof.Existence)
+	assert.Nil(t, proof.Value)
+	assert.True(t, merkletree.VerifyProof(proof.Root, proof.Proof,
+		big.NewInt(4), big.NewInt(0)))
+
+	var cp merkletree.CircomVerifierProof
+	w = do(t, h, http.MethodGet, "/proofs/2/verifier", "", &cp)
+	require.Equal(t, http.StatusOK, w.Code)
+	expected, err := mt.GenerateCircomVerifierProof(context.Background(),
+		big.NewInt(2), nil)
+	require.NoError(t, err)
+	assert.Equal(t, expected, &cp)
+
+	cp = merkletree.CircomVerifierProof{}
+	w = do(t, h, http.MethodGet, "/proofs/2/sc", "", &cp)
+	require.Equal(t, http.StatusOK, w.Code)
+	expected, err = mt.GenerateSCVerifierProof(context.Background(),
+		big.NewInt(2), nil)
+	require.NoError(t, err)
+	assert.Equal(t, expected, &cp)
+
+	w = do(t, h, http.MethodGet, "/unknown", "", nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	w = do(t, h, http.MethodPost, "/proofs/2", "", nil)
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+}
+
+func TestCacheByRoot(t *testing.T) {
+	mt := newTestTree(t, 3)
+	oldRoot := mt.Root()
+	h := NewHandler(mt)
+	require.NoError(t, mt.Add(context.Background(), big.NewInt(4),
+		big.NewInt(40)))
+
+	target := "/proofs/4?root=" + oldRoot.BigInt().String()
+	var proof ProofResponse
+	w := do(t, h, http.MethodGet, target, "", &proof)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.False(t, proof.Proof.Existence)
+	assert.Equal(t, oldRoot, proof.Root)
+	assert.Contains(t, w.Header().Get("Cache-Control"), "immutable")
+	etag := w.Header().Get("ETag")
+	assert.Equal(t, `"`+oldRoot.Hex()+`"`, etag)
+
+	r := httptest.NewRequest(http.MethodGet, target, nil)
+	r.Header.Set("If-None-Match", etag)
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusNotModified, w.Code)
+	assert.Empty(t, w.Body.Bytes())
+
+	// unknown roots are not found, and not cached
+	w = do(t, h, http.MethodGet, "/proofs/4?root=12345", "", nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Empty(t, w.Header().Get("Cache-Control"))
+
+	// the history ends with the old and the new roots
+	var roots RootsResponse
+	w = do(t, h, http.MethodGet, "/roots", "", &roots)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Len(t, roots.Roots, 5)
+	assert.Equal(t, []*merkletree.Hash{oldRoot, mt.Root()}, roots.Roots[3:])
+}
+
+func TestMutations(t *testing.T) {
+	mt := newTestTree(t, 2)
+	w := do(t, NewHandler(mt), http.MethodPost, "/leafs",
+		`{"key": "3", "value": "30"}`, nil)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	h := NewHandler(mt, WithMutations(), WithRootHistorySize(3))
+	var cp merkletree.CircomProcessorProof
+	w = do(t, h, http.MethodPost, "/leafs", `{"key": "3", "value": "30"}`,
+		&cp)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, merkletree.FncInsert, cp.Fnc)
+	assert.Equal(t, mt.Root(), cp.NewRoot)
+	assert.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+
+	w = do(t, h, http.MethodPost, "/leafs", `{"key": "3", "value": "31"}`,
+		nil)
+	assert.Equal(t, http.StatusConflict, w.Code)
+	w = do(t, h, http.MethodPost, "/leafs", `{"value": "31"}`, nil)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	cp = merkletree.CircomProcessorProof{}
+	w = do(t, h, http.MethodPut, "/leafs/3", `{"value": "31"}`, &cp)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, merkletree.FncUpdate, cp.Fnc)
+	_, v, _, err := mt.Get(context.Background(), big.NewInt(3))
+	require.NoError(t, err)
+	assert.Equal(t, "31", v.String())
+
+	cp = merkletree.CircomProcessorProof{}
+	w = do(t, h, http.MethodDelete, "/leafs/1", "", &cp)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, merkletree.FncDelete, cp.Fnc)
+	w = do(t, h, http.MethodDelete, "/leafs/1", "", nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	// the history is limited to the last 3 roots
+	var roots RootsResponse
+	w = do(t, h, http.MethodGet, "/roots", "", &roots)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Len(t, roots.Roots, 3)
+	assert.Equal(t, mt.Root(), roots.Roots[2])
+}
+
+// nodeStorage hides the optional interfaces of a Storage, like RootLister
+type nodeStorage struct {
+	merkletree.Storage
+}
+
+func TestRoots(t *testing.T) {
+	ctx := context.Background()
+	// the roots set before the Handler is created are kept by the Storage
+	mt := newTestTree(t, 3)
+	var stored []*merkletree.Hash
+	require.NoError(t, mt.ListRoots(ctx, func(root *merkletree.Hash) error {
+		stored = append(stored, root)
+		return nil
+	}))
+	require.Len(t, stored, 4)
+	h := NewHandler(mt)
+	defer h.Close()
+	var roots RootsResponse
+	w := do(t, h, http.MethodGet, "/roots", "", &roots)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, stored, roots.Roots)
+
+	// without RootLister, the Handler keeps the roots it sees
+	mt, err := merkletree.NewMerkleTree(ctx,
+		nodeStorage{memory.NewMemoryStorage()}, 10)
+	require.NoError(t, err)
+	require.NoError(t, mt.Add(ctx, big.NewInt(1), big.NewInt(10)))
+	h = NewHandler(mt)
+	defer h.Close()
+	require.NoError(t, mt.Add(ctx, big.NewInt(2), big.NewInt(20)))
+	roots = RootsResponse{}
+	w = do(t, h, http.MethodGet, "/roots", "", &roots)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Len(t, roots.Roots, 2)
+	assert.Equal(t, mt.Root(), roots.Roots[1])
+}
+
+func TestServer(t *testing.T) {
+	mt := newTestTree(t, 3)
+	mux := http.NewServeMux()
+	mux.Handle("/mt/", http.StripPrefix("/mt", NewHandler(mt)))
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/mt/leafs/3")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+	var leaf LeafResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&leaf))
+	assert.Equal(t, "30", leaf.Value.BigInt().String())
+}
@@ -0,0 +1,141 @@
+package merkletree
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// ErrReplayDivergence is used when the root computed by Replay after an
+// operation doesn't match the root recorded in the Journal.
+var ErrReplayDivergence = errors.New("the replayed root diverges from the journal")
+
+// Journal is an append-only log of the modifications of a MerkleTree, set
+// with WithJournal. Each record contains the operation (FncInsert, FncUpdate
+// or FncDelete), the key, the new value (nil for FncDelete) and the root of
+// the tree after the modification.
+type Journal interface {
+	// Append appends a record to the Journal.
+	Append(ctx context.Context, op int, key, value, root *Hash) error
+	// Records calls f with each record of the Journal, in the order they
+	// were appended. If f returns an error, it stops and returns it.
+	Records(ctx context.Context,
+		f func(op int, key, value, root *Hash) error) error
+}
+
+// JournalRecord is a record of a Journal.
+type JournalRecord struct {
+	Op    int
+	Key   *Hash
+	Value *Hash // nil for FncDelete
+	Root  *Hash
+}
+
+// ReplayError is the error returned by Replay when an operation of the
+// Journal can't be replayed, or its root diverges from the recorded one.
+type ReplayError struct {
+	// Index is the position of the operation in the Journal, starting at 0.
+	Index int
+	// Record is the record of the operation.
+	Record JournalRecord
+	// Root is the root after the replayed operation, or nil if it failed.
+	Root *Hash
+	// Err is the error of the operation, or ErrReplayDivergence.
+	Err error
+}
+
+// Error implements the error interface
+func (e *ReplayError) Error() string {
+	if errors.Is(e.Err, ErrReplayDivergence) {
+		return fmt.Sprintf(
+			"replay of operation %d (fnc %d, key %v): %v: expected root %v, got %v",
+			e.Index, e.Record.Op, e.Record.Key, e.Err, e.Record.Root, e.Root)
+	}
+	return fmt.Sprintf("replay of operation %d (fnc %d, key %v): %v",
+		e.Index, e.Record.Op, e.Record.Key, e.Err)
+}
+
+// Unwrap returns the error of the operation
+func (e *ReplayError) Unwrap() error {
+	return e.Err
+}
+
+// appendJournal appends the modification of the Event to the Journal of the
+// MerkleTree, once the new root is stored. If the append fails, the root is
+// rolled back to the old one, so the tree never contains modifications that
+// are missing from the Journal. The caller must hold the lock of the tree.
+func (mt *MerkleTree) appendJournal(ctx context.Context, e Event) error {
+	if mt.journal == nil {
+		return nil
+	}
+	err := mt.journal.Append(ctx, e.Op, e.Key, e.NewValue, e.NewRoot)
+	if err == nil {
+		return nil
+	}
+	mt.rootKey = e.OldRoot
+	if rbErr := mt.db.SetRoot(ctx, e.OldRoot); rbErr != nil {
+		return fmt.Errorf("can't append to the journal: %v; "+
+			"can't roll back the root: %w", err, rbErr)
+	}
+	return fmt.Errorf("can't append to the journal: %w", err)
+}
+
+// Replay rebuilds a MerkleTree in the given Storage, which must be empty, by
+// applying in order all the operations of the Journal. The root after each
+// operation is checked against the recorded one, and the first divergence or
+// failed operation is returned as a *ReplayError, along with the MerkleTree
+// containing the operations applied until then. The tree is loaded with the
+// given maxLevels and Options, as with NewMerkleTree; a Journal set with
+// WithJournal only records the operations applied after the replay.
+func Replay(ctx context.Context, journal Journal, storage Storage,
+	maxLevels int, opts ...Option) (*MerkleTree, error) {
+	mt, err := NewMerkleTree(ctx, storage, maxLevels, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if !mt.writable {
+		return nil, ErrNotWritable
+	}
+	if !mt.Root().Equals(&HashZero) {
+		return nil, ErrTreeNotEmpty
+	}
+	j := mt.journal
+	mt.journal = nil
+	defer func() { mt.journal = j }()
+
+	i := 0
+	err = journal.Records(ctx, func(op int, key, value, root *Hash) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		r := JournalRecord{Op: op, Key: key, Value: value, Root: root}
+		if err := mt.replayRecord(ctx, r); err != nil {
+			return &ReplayError{Index: i, Record: r, Err: err}
+		}
+		if !mt.Root().Equals(root) {
+			return &ReplayError{Index: i, Record: r, Root: mt.Root(),
+				Err: ErrReplayDivergence}
+		}
+		i++
+		return nil
+	})
+	return mt, err
+}
+
+// replayRecord applies the operation of a JournalRecord.
+func (mt *MerkleTree) replayRecord(ctx context.Context, r JournalRecord) error {
+	if r.Key == nil || r.Root == nil || (r.Op != FncDelete && r.Value == nil) {
+		return fmt.Errorf("invalid record")
+	}
+	switch r.Op {
+	case FncInsert:
+		return mt.Add(ctx, r.Key.BigInt(), r.Value.BigInt())
+	case FncUpdate:
+		_, err := mt.Update(ctx, r.Key.BigInt(), r.Value.BigInt())
+		return err
+	case FncDelete:
+		return mt.Delete(ctx, r.Key.BigInt())
+	default:
+		return fmt.Errorf("invalid fnc %d", r.Op)
+	}
+}
@@ -0,0 +1,174 @@
+package merkletree_test
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/iden3/go-merkletree-sql/v2"
+	"github.com/iden3/go-merkletree-sql/v2/db/memory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// journaledTree returns a tree with a Journal with some modifications
+func journaledTree(t *testing.T) (*merkletree.MerkleTree, *memory.Journal) {
+	ctx := context.Background()
+	j := memory.NewMemoryJournal()
+	mt, err := merkletree.NewMerkleTree(ctx, memory.NewMemoryStorage(), 10,
+		merkletree.WithJournal(j))
+	require.NoError(t, err)
+	for i := int64(1); i <= 5; i++ {
+		require.NoError(t, mt.Add(ctx, big.NewInt(i), big.NewInt(i*10)))
+	}
+	_, err = mt.Update(ctx, big.NewInt(2), big.NewInt(21))
+	require.NoError(t, err)
+	_, err = mt.DeleteAndGetCircomProof(ctx, big.NewInt(3))
+	require.NoError(t, err)
+	require.NoError(t, mt.Delete(ctx, big.NewInt(4)))
+	return mt, j
+}
+
+func TestJournalReplay(t *testing.T) {
+	ctx := context.Background()
+	mt, j := journaledTree(t)
+
+	var ops []int
+	require.NoError(t, j.Records(ctx,
+		func(op int, _, value, _ *merkletree.Hash) error {
+			ops = append(ops, op)
+			if op == merkletree.FncDelete {
+				assert.Nil(t, value)
+			}
+			return nil
+		}))
+	assert.Equal(t, []int{merkletree.FncInsert, merkletree.FncInsert,
+		merkletree.FncInsert, merkletree.FncInsert, merkletree.FncInsert,
+		merkletree.FncUpdate, merkletree.FncDelete, merkletree.FncDelete}, ops)
+
+	// the replayed tree records new modifications in its own journal
+	j2 := memory.NewMemoryJournal()
+	replayed, err := merkletree.Replay(ctx, j, memory.NewMemoryStorage(), 10,
+		merkletree.WithJournal(j2))
+	require.NoError(t, err)
+	assert.Equal(t, mt.Root(), replayed.Root())
+	require.NoError(t, replayed.Add(ctx, big.NewInt(6), big.NewInt(60)))
+	n := 0
+	require.NoError(t, j2.Records(ctx,
+		func(int, *merkletree.Hash, *merkletree.Hash, *merkletree.Hash) error {
+			n++
+			return nil
+		}))
+	assert.Equal(t, 1, n)
+
+	// the storage must be empty
+	_, err = merkletree.Replay(ctx, j, replayedStorage(t, j), 10)
+	assert.ErrorIs(t, err, merkletree.ErrTreeNotEmpty)
+}
+
+// replayedStorage returns a storage with the tree replayed from the Journal
+func replayedStorage(t *testing.T, j merkletree.Journal) merkletree.Storage {
+	s := memory.NewMemoryStorage()
+	_, err := merkletree.Replay(context.Background(), j, s, 10)
+	require.NoError(t, err)
+	return s
+}
+
+// tamperedJournal is a Journal that modifies the record at index
+type tamperedJournal struct {
+	merkletree.Journal
+	index  int
+	tamper func(op *int, key, value, root **merkletree.Hash)
+}
+
+func (j *tamperedJournal) Records(ctx context.Context,
+	f func(op int, key, value, root *merkletree.Hash) error) error {
+	i := 0
+	return j.Journal.Records(ctx,
+		func(op int, key, value, root *merkletree.Hash) error {
+			if i == j.index {
+				j.tamper(&op, &key, &value, &root)
+			}
+			i++
+			return f(op, key, value, root)
+		})
+}
+
+func TestJournalReplayDivergence(t *testing.T) {
+	ctx := context.Background()
+	mt, j := journaledTree(t)
+
+	// a modified value diverges at the exact operation
+	replayed, err := merkletree.Replay(ctx, &tamperedJournal{Journal: j,
+		index: 5,
+		tamper: func(_ *int, _, value, _ **merkletree.Hash) {
+			*value = &merkletree.Hash{22}
+		}}, memory.NewMemoryStorage(), 10)
+	var replayErr *merkletree.ReplayError
+	require.ErrorAs(t, err, &replayErr)
+	assert.ErrorIs(t, err, merkletree.ErrReplayDivergence)
+	assert.Equal(t, 5, replayErr.Index)
+	assert.Equal(t, merkletree.FncUpdate, replayErr.Record.Op)
+	assert.Equal(t, "2", replayErr.Record.Key.String())
+	assert.Equal(t, replayed.Root(), replayErr.Root)
+	assert.NotEqual(t, mt.Root(), replayed.Root())
+
+	// an operation that can't be applied
+	_, err = merkletree.Replay(ctx, &tamperedJournal{Journal: j, index: 6,
+		tamper: func(_ *int, key, _, _ **merkletree.Hash) {
+			*key = &merkletree.Hash{99}
+		}}, memory.NewMemoryStorage(), 10)
+	require.ErrorAs(t, err, &replayErr)
+	assert.Equal(t, 6, replayErr.Index)
+	assert.ErrorIs(t, err, merkletree.ErrKeyNotFound)
+	assert.Nil(t, replayErr.Root)
+}
+
+// failingJournal is a Journal whose appends fail
+type failingJournal struct {
+	merkletree.Journal
+	fail bool
+}
+
+var errJournal = errors.New("journal unavailable")
+
+func (j *failingJournal) Append(ctx context.Context, op int, key, value,
+	root *merkletree.Hash) error {
+	if j.fail {
+		return errJournal
+	}
+	return j.Journal.Append(ctx, op, key, value, root)
+}
+
+func TestJournalFailureRollsBack(t *testing.T) {
+	ctx := context.Background()
+	j := &failingJournal{Journal: memory.NewMemoryJournal()}
+	storage := memory.NewMemoryStorage()
+	var events int
+	mt, err := merkletree.NewMerkleTree(ctx, storage, 10,
+		merkletree.WithJournal(j),
+		merkletree.WithEventHook(func(context.Context, merkletree.Event) error {
+			events++
+			return nil
+		}))
+	require.NoError(t, err)
+	require.NoError(t, mt.Add(ctx, big.NewInt(1), big.NewInt(10)))
+	root := mt.Root()
+
+	j.fail = true
+	require.ErrorIs(t, mt.Add(ctx, big.NewInt(2), big.NewInt(20)), errJournal)
+	_, err = mt.Update(ctx, big.NewInt(1), big.NewInt(11))
+	require.ErrorIs(t, err, errJournal)
+	require.ErrorIs(t, mt.Delete(ctx, big.NewInt(1)), errJournal)
+	assert.Equal(t, root, mt.Root())
+	stored, err := storage.GetRoot(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, root, stored)
+	assert.Equal(t, 1, events)
+
+	// the journal still replays the tree
+	replayed, err := merkletree.Replay(ctx, j, memory.NewMemoryStorage(), 10)
+	require.NoError(t, err)
+	assert.Equal(t, root, replayed.Root())
+}
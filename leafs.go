@@ -0,0 +1,240 @@
+package merkletree
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+)
+
+// ErrInvalidLeafCursor is used when a LeafCursor can't be decoded.
+var ErrInvalidLeafCursor = errors.New("invalid leaf cursor")
+
+// Leaf is a leaf of the MerkleTree.
+type Leaf struct {
+	HIndex *Hash
+	HValue *Hash
+}
+
+// LeafCursor is an opaque position in the ordered sequence of leafs of a
+// MerkleTree, used to resume an iteration after a given leaf. The empty
+// LeafCursor is the start of the sequence. A LeafCursor remains valid after
+// the tree is modified: the iteration resumes after the position of the leaf
+// it was taken from.
+type LeafCursor string
+
+// leafCursor returns the LeafCursor of the position after the given key.
+func leafCursor(hIndex *Hash) LeafCursor {
+	return LeafCursor(hex.EncodeToString(hIndex[:]))
+}
+
+// key returns the key of the leaf after which the cursor is positioned, or
+// nil for the empty LeafCursor.
+func (c LeafCursor) key() (*Hash, error) {
+	if c == "" {
+		return nil, nil
+	}
+	b, err := hex.DecodeString(string(c))
+	if err != nil || len(b) != len(Hash{}) {
+		return nil, ErrInvalidLeafCursor
+	}
+	var k Hash
+	copy(k[:], b)
+	return &k, nil
+}
+
+// LeafIterator iterates over the leafs of a MerkleTree in path order: the
+// order in which WalkNodes visits them, where the leafs of the left subtree of
+// a node come before the leafs of its right subtree.
+//
+//	it, err := mt.NewLeafIterator(ctx, nil, "")
+//	...
+//	for it.Next() {
+//		leaf := it.Leaf()
+//		...
+//	}
+//	if err := it.Err(); err != nil {
+//		...
+//	}
+//
+// Like WalkNodes, if the MerkleTree was loaded with WithWalkPrefetch, the
+// children of the visited nodes are fetched concurrently in advance.
+type LeafIterator struct {
+	ctx      context.Context
+	mt       *MerkleTree
+	after    *Hash
+	stack    []leafIteratorItem
+	prefetch *nodePrefetcher
+	leaf     *Leaf
+	err      error
+}
+
+// leafIteratorItem is a node pending to be visited by a LeafIterator. bounded
+// is set for the nodes in the path of the cursor, which can contain leafs
+// before it.
+type leafIteratorItem struct {
+	key     *Hash
+	depth   int
+	bounded bool
+	// fetched is the result of the prefetch of the node, if any
+	fetched *fetchedNode
+}
+
+// NewLeafIterator returns a LeafIterator over the leafs of the MerkleTree
+// with the given rootKey, starting after the given cursor. If rootKey is nil,
+// the current Root of the MerkleTree is used.
+func (mt *MerkleTree) NewLeafIterator(ctx context.Context, rootKey *Hash,
+	cursor LeafCursor) (*LeafIterator, error) {
+	after, err := cursor.key()
+	if err != nil {
+		return nil, err
+	}
+	if rootKey == nil {
+		rootKey = mt.Root()
+	}
+	return &LeafIterator{
+		ctx:      ctx,
+		mt:       mt,
+		after:    after,
+		stack:    []leafIteratorItem{{key: rootKey, bounded: after != nil}},
+		prefetch: newNodePrefetcher(mt, mt.prefetch),
+	}, nil
+}
+
+// Next advances the iterator to the next leaf, and returns whether there is
+// one. It returns false at the end of the leafs or if an error is found, which
+// is returned by Err.
+func (it *LeafIterator) Next() bool {
+	it.leaf = nil
+	if it.err != nil {
+		return false
+	}
+	for len(it.stack) > 0 {
+		item := it.stack[len(it.stack)-1]
+		it.stack = it.stack[:len(it.stack)-1]
+
+		if it.err = it.ctx.Err(); it.err != nil {
+			return false
+		}
+		n, err := item.fetched.node(it.ctx, it.mt, item.key)
+		if err != nil {
+			it.err = err
+			return false
+		}
+		switch n.Type {
+		case NodeTypeEmpty:
+		case NodeTypeLeaf:
+			if item.bounded &&
+				!pathAfter(n.Entry[0], it.after, it.mt.maxLevels) {
+				continue
+			}
+			it.leaf = &Leaf{HIndex: n.Entry[0], HValue: n.Entry[1]}
+			return true
+		case NodeTypeMiddle:
+			if item.depth >= it.mt.maxLevels {
+				it.err = ErrReachedMaxLevel
+				return false
+			}
+			right := leafIteratorItem{key: n.ChildR, depth: item.depth + 1}
+			left := leafIteratorItem{key: n.ChildL, depth: item.depth + 1}
+			if !item.bounded {
+				it.push(right, left)
+			} else if TestBit(it.after[:], uint(item.depth)) {
+				// all the leafs of the left subtree are before the cursor
+				right.bounded = true
+				it.push(right)
+			} else {
+				left.bounded = true
+				it.push(right, left)
+			}
+		default:
+			it.err = ErrInvalidNodeFound
+			return false
+		}
+	}
+	return false
+}
+
+// push adds the items to the stack of nodes to visit, starting their
+// prefetch.
+func (it *LeafIterator) push(items ...leafIteratorItem) {
+	for _, item := range items {
+		item.fetched = it.prefetch.prefetch(it.ctx, item.key)
+		it.stack = append(it.stack, item)
+	}
+}
+
+// Leaf returns the current leaf of the iterator.
+func (it *LeafIterator) Leaf() *Leaf {
+	return it.leaf
+}
+
+// Cursor returns the LeafCursor of the position after the current leaf, which
+// can be used to resume the iteration later.
+func (it *LeafIterator) Cursor() LeafCursor {
+	if it.leaf == nil {
+		return ""
+	}
+	return leafCursor(it.leaf.HIndex)
+}
+
+// Err returns the error found during the iteration, if any.
+func (it *LeafIterator) Err() error {
+	return it.err
+}
+
+// All returns a function that yields the hIndex and hValue of the remaining
+// leafs, compatible with iter.Seq2[*Hash, *Hash], so it can be used in a
+// range loop. The iteration stops on the first error, which is returned by
+// Err.
+func (it *LeafIterator) All() func(yield func(*Hash, *Hash) bool) {
+	return func(yield func(*Hash, *Hash) bool) {
+		for it.Next() {
+			if !yield(it.leaf.HIndex, it.leaf.HValue) {
+				return
+			}
+		}
+	}
+}
+
+// LeafsPage returns up to limit leafs of the MerkleTree with the given
+// rootKey, starting after the given cursor, in path order. If rootKey is nil,
+// the current Root of the MerkleTree is used. It also returns the LeafCursor
+// of the next page, which is empty if there are no more leafs. If limit is 0
+// or negative, all the remaining leafs are returned.
+func (mt *MerkleTree) LeafsPage(ctx context.Context, rootKey *Hash,
+	cursor LeafCursor, limit int) ([]Leaf, LeafCursor, error) {
+	it, err := mt.NewLeafIterator(ctx, rootKey, cursor)
+	if err != nil {
+		return nil, "", err
+	}
+	var leafs []Leaf
+	for (limit <= 0 || len(leafs) < limit) && it.Next() {
+		leafs = append(leafs, *it.Leaf())
+	}
+	if it.Err() != nil {
+		return nil, "", it.Err()
+	}
+	if limit <= 0 || len(leafs) < limit {
+		return leafs, "", nil
+	}
+	next := it.Cursor()
+	// check if there are more leafs, to not return a cursor to an empty page
+	if !it.Next() {
+		if it.Err() != nil {
+			return nil, "", it.Err()
+		}
+		next = ""
+	}
+	return leafs, next, nil
+}
+
+// pathAfter returns whether the path of k comes after the path of c.
+func pathAfter(k, c *Hash, levels int) bool {
+	for i := 0; i < levels; i++ {
+		bk, bc := TestBit(k[:], uint(i)), TestBit(c[:], uint(i))
+		if bk != bc {
+			return bk
+		}
+	}
+	return false
+}
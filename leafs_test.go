@@ -0,0 +1,129 @@
+package merkletree_test
+
+import (
+	"bytes"
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/iden3/go-merkletree-sql/v2"
+	"github.com/iden3/go-merkletree-sql/v2/db/memory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func dumpedLeafs(leafs []merkletree.Leaf) []byte {
+	var buf bytes.Buffer
+	for _, l := range leafs {
+		buf.Write(l.HIndex[:])
+		buf.Write(l.HValue[:])
+	}
+	return buf.Bytes()
+}
+
+func TestLeafIteratorOrder(t *testing.T) {
+	ctx := context.Background()
+	mt := newTestTree(t, memory.NewMemoryStorage(), 40, 50)
+
+	it, err := mt.NewLeafIterator(ctx, nil, "")
+	require.NoError(t, err)
+	var leafs []merkletree.Leaf
+	it.All()(func(hIndex, hValue *merkletree.Hash) bool {
+		leafs = append(leafs, merkletree.Leaf{HIndex: hIndex, HValue: hValue})
+		return true
+	})
+	require.NoError(t, it.Err())
+	require.Len(t, leafs, 50)
+
+	// same order as DumpLeafs
+	dump, err := mt.DumpLeafs(ctx, nil)
+	require.NoError(t, err)
+	assert.Equal(t, dump, dumpedLeafs(leafs))
+
+	all, next, err := mt.LeafsPage(ctx, nil, "", 0)
+	require.NoError(t, err)
+	assert.Equal(t, leafs, all)
+	assert.Empty(t, next)
+}
+
+func TestLeafsPage(t *testing.T) {
+	ctx := context.Background()
+	mt := newTestTree(t, memory.NewMemoryStorage(), 40, 50)
+	all, _, err := mt.LeafsPage(ctx, nil, "", 0)
+	require.NoError(t, err)
+
+	var leafs []merkletree.Leaf
+	var cursor merkletree.LeafCursor
+	pages := 0
+	for {
+		page, next, err := mt.LeafsPage(ctx, nil, cursor, 7)
+		require.NoError(t, err)
+		leafs = append(leafs, page...)
+		pages++
+		if next == "" {
+			break
+		}
+		cursor = next
+	}
+	assert.Equal(t, 8, pages)
+	assert.Equal(t, all, leafs)
+
+	// a page that ends exactly at the last leaf has no next cursor
+	page, next, err := mt.LeafsPage(ctx, nil, "", 50)
+	require.NoError(t, err)
+	assert.Len(t, page, 50)
+	assert.Empty(t, next)
+
+	_, _, err = mt.LeafsPage(ctx, nil, "zz", 10)
+	assert.ErrorIs(t, err, merkletree.ErrInvalidLeafCursor)
+}
+
+func TestLeafIteratorResumeAfterDelete(t *testing.T) {
+	ctx := context.Background()
+	mt := newTestTree(t, memory.NewMemoryStorage(), 40, 50)
+	all, _, err := mt.LeafsPage(ctx, nil, "", 0)
+	require.NoError(t, err)
+
+	page, cursor, err := mt.LeafsPage(ctx, nil, "", 20)
+	require.NoError(t, err)
+	require.Len(t, page, 20)
+
+	// the leaf of the cursor is removed, the iteration resumes after its
+	// position
+	require.NoError(t, mt.Delete(ctx, page[19].HIndex.BigInt()))
+	rest, next, err := mt.LeafsPage(ctx, nil, cursor, 0)
+	require.NoError(t, err)
+	assert.Empty(t, next)
+	assert.Equal(t, all[20:], rest)
+}
+
+func TestLeafIteratorPrefetch(t *testing.T) {
+	ctx := context.Background()
+	storage := memory.NewMemoryStorage()
+	mt, err := merkletree.NewMerkleTree(ctx, storage, 40)
+	require.NoError(t, err)
+	for i := 0; i < 64; i++ {
+		err = mt.Add(ctx, big.NewInt(int64(i)), big.NewInt(int64(i*2)))
+		require.NoError(t, err)
+	}
+	mtPrefetch, err := merkletree.NewMerkleTree(ctx, storage, 40,
+		merkletree.WithWalkPrefetch(4))
+	require.NoError(t, err)
+
+	leafs, _, err := mt.LeafsPage(ctx, nil, "", 0)
+	require.NoError(t, err)
+	require.Len(t, leafs, 64)
+	// the pages resume from a cursor, where only part of the path is visited
+	var leafsPrefetch []merkletree.Leaf
+	var cursor merkletree.LeafCursor
+	for {
+		var page []merkletree.Leaf
+		page, cursor, err = mtPrefetch.LeafsPage(ctx, nil, cursor, 10)
+		require.NoError(t, err)
+		leafsPrefetch = append(leafsPrefetch, page...)
+		if cursor == "" {
+			break
+		}
+	}
+	assert.Equal(t, leafs, leafsPrefetch)
+}
@@ -51,6 +51,9 @@ var (
 	// ErrNotWritable is used when the MerkleTree is not writable and a
 	// write function is called
 	ErrNotWritable = errors.New("Merkle Tree not writable")
+	// ErrInvalidMaxLevels is used when the maximum level of the MerkleTree
+	// is not between 1 and MaxTreeLevels.
+	ErrInvalidMaxLevels = errors.New("invalid maximum level of the merkle tree")
 )
 
 // MerkleTree is the struct with the main elements of the MerkleTree
@@ -60,21 +63,45 @@ type MerkleTree struct {
 	rootKey   *Hash
 	writable  bool
 	maxLevels int
+	hasher    Hasher
+	cache     NodeCache
+	hooks     hookSet
+	logger    Logger
+	prefetch  int
+
+	hookErrorPolicy HookErrorPolicy
+	journal         Journal
 }
 
 // NewMerkleTree loads a new MerkleTree. If in the storage already exists one
-// will open that one, if not, will create a new one.
+// will open that one, if not, will create a new one. maxLevels must be
+// between 1 and MaxTreeLevels. The MerkleTree can be configured with the
+// given Options.
 func NewMerkleTree(ctx context.Context, storage Storage,
-	maxLevels int) (*MerkleTree, error) {
+	maxLevels int, opts ...Option) (*MerkleTree, error) {
+	if maxLevels < 1 || maxLevels > MaxTreeLevels {
+		return nil, ErrInvalidMaxLevels
+	}
 	mt := MerkleTree{db: storage, maxLevels: maxLevels, writable: true}
+	for _, opt := range opts {
+		opt(&mt)
+	}
+	if err := mt.loadHasher(ctx); err != nil {
+		return nil, err
+	}
 
 	root, err := mt.db.GetRoot(ctx)
 	if err == ErrNotFound {
 		mt.rootKey = &HashZero
+		if !mt.writable {
+			// a read-only tree never writes to the storage
+			return &mt, nil
+		}
 		err = mt.db.SetRoot(ctx, mt.rootKey)
 		if err != nil {
 			return nil, err
 		}
+		mt.logf("merkletree: created new tree with %d levels", maxLevels)
 		return &mt, nil
 	} else if err != nil {
 		return nil, err
@@ -83,6 +110,83 @@ func NewMerkleTree(ctx context.Context, storage Storage,
 	return &mt, nil
 }
 
+// loadHasher checks the Hasher of the MerkleTree against the name stored in
+// a HasherStorage, or loads the stored Hasher if none was given. If no name
+// is stored yet, the name of the Hasher is stored, unless the MerkleTree is
+// read-only.
+func (mt *MerkleTree) loadHasher(ctx context.Context) error {
+	name, err := storedHasherName(ctx, mt.db)
+	if err != nil {
+		return err
+	}
+	if name == "" {
+		if mt.hasher == nil {
+			mt.hasher = PoseidonHasher{}
+		}
+		if !mt.writable {
+			return nil
+		}
+		return storeHasherName(ctx, mt.db, mt.hasher.Name())
+	}
+	if mt.hasher == nil {
+		mt.hasher, err = HasherByName(name)
+		return err
+	}
+	return checkHasherName(name, mt.hasher.Name())
+}
+
+// storedHasherName returns the name of the Hasher stored in the Storage, or
+// an empty name if the Storage is not a HasherStorage or has no name stored.
+func storedHasherName(ctx context.Context, storage Storage) (string, error) {
+	hs, ok := storage.(HasherStorage)
+	if !ok {
+		return "", nil
+	}
+	name, err := hs.GetHasherName(ctx)
+	if err == ErrNotFound {
+		return "", nil
+	}
+	return name, err
+}
+
+// storeHasherName stores the name of the Hasher in the Storage, if it's a
+// HasherStorage.
+func storeHasherName(ctx context.Context, storage Storage, name string) error {
+	hs, ok := storage.(HasherStorage)
+	if !ok {
+		return nil
+	}
+	return hs.SetHasherName(ctx, name)
+}
+
+// checkHasherName returns ErrHasherMismatch if the name of the Hasher is not
+// the stored one.
+func checkHasherName(stored, name string) error {
+	if stored != name {
+		return fmt.Errorf("%w: the tree uses hasher %v", ErrHasherMismatch,
+			stored)
+	}
+	return nil
+}
+
+// OpenReadOnly loads a read-only MerkleTree from the storage, without ever
+// writing to it, so it can be used with storages that reject writes. If the
+// storage doesn't contain a root, the tree is opened as the empty tree. All
+// the operations that modify the tree return ErrNotWritable.
+func OpenReadOnly(ctx context.Context, storage Storage, maxLevels int,
+	opts ...Option) (*MerkleTree, error) {
+	opts = append(opts[:len(opts):len(opts)], WithReadOnly())
+	return NewMerkleTree(ctx, storage, maxLevels, opts...)
+}
+
+// NewMerkleTreeWithHasher loads a new MerkleTree like NewMerkleTree, using
+// the given Hasher to compute the keys of the nodes. It's equivalent to
+// NewMerkleTree with the WithHasher Option.
+func NewMerkleTreeWithHasher(ctx context.Context, storage Storage,
+	maxLevels int, hasher Hasher) (*MerkleTree, error) {
+	return NewMerkleTree(ctx, storage, maxLevels, WithHasher(hasher))
+}
+
 // Root returns the MerkleRoot
 func (mt *MerkleTree) Root() *Hash {
 	return mt.rootKey
@@ -93,6 +197,11 @@ func (mt *MerkleTree) MaxLevels() int {
 	return mt.maxLevels
 }
 
+// Hasher returns the Hasher used to compute the keys of the nodes
+func (mt *MerkleTree) Hasher() Hasher {
+	return mt.hasher
+}
+
 // Snapshot returns a read-only copy of the MerkleTree
 func (mt *MerkleTree) Snapshot(
 	ctx context.Context, rootKey *Hash) (*MerkleTree, error) {
@@ -106,7 +215,11 @@ func (mt *MerkleTree) Snapshot(
 		db:        mt.db,
 		maxLevels: mt.maxLevels,
 		rootKey:   rootKey,
-		writable:  false}, nil
+		writable:  false,
+		hasher:    mt.hasher,
+		cache:     mt.cache,
+		logger:    mt.logger,
+		prefetch:  mt.prefetch}, nil
 }
 
 // Add adds a Key & Value into the MerkleTree. Where the `k` determines the
@@ -126,21 +239,15 @@ func (mt *MerkleTree) Add(ctx context.Context, k, v *big.Int) error {
 		return fmt.Errorf("can't create hash from Value: %w", err)
 	}
 
-	mt.Lock()
-	defer mt.Unlock()
-
-	newNodeLeaf := NewNodeLeaf(kHash, vHash)
-	path := getPath(mt.maxLevels, kHash[:])
-
-	newRootKey, err := mt.addLeaf(ctx, newNodeLeaf, mt.rootKey, 0, path)
+	e, err := mt.insert(ctx, kHash, vHash)
 	if err != nil {
 		return err
 	}
-	mt.rootKey = newRootKey
-	return mt.db.SetRoot(ctx, mt.rootKey)
+	return mt.modified(ctx, e)
 }
 
-// AddEntry adds the Entry to the MerkleTree
+// AddEntry adds the Entry to the MerkleTree. If the Storage implements
+// EntryStorage, the Entry is stored too, and can be read with GetEntry.
 func (mt *MerkleTree) AddEntry(ctx context.Context, e *Entry) error {
 	// verify that the MerkleTree is writable
 	if !mt.writable {
@@ -148,12 +255,9 @@ func (mt *MerkleTree) AddEntry(ctx context.Context, e *Entry) error {
 	}
 	// verify that the ElemBytes are valid and fit inside the mimc7 field.
 	if !CheckEntryInField(*e) {
-		return errors.New("Elements not inside the Finite Field over R")
+		return ErrEntryNotInField
 	}
 
-	mt.Lock()
-	defer mt.Unlock()
-
 	hIndex, err := e.HIndex()
 	if err != nil {
 		return err
@@ -162,10 +266,35 @@ func (mt *MerkleTree) AddEntry(ctx context.Context, e *Entry) error {
 	if err != nil {
 		return err
 	}
-	newNodeLeaf := NewNodeLeaf(hIndex, hValue)
-	path := getPath(mt.maxLevels, hIndex[:])
 
-	newRootKey, err := mt.addLeaf(ctx, newNodeLeaf, mt.rootKey, 0, path)
+	ev, err := mt.insert(ctx, hIndex, hValue)
+	if err != nil {
+		return err
+	}
+	return mt.entryModified(ctx, ev, NewGenericEntryFromEntry(e))
+}
+
+// insert adds the leaf of kHash and vHash to the tree, and returns the Event
+// of the insertion, which is not emitted.
+func (mt *MerkleTree) insert(ctx context.Context,
+	kHash, vHash *Hash) (Event, error) {
+	mt.Lock()
+	defer mt.Unlock()
+	e := Event{Op: FncInsert, Key: kHash, NewValue: vHash,
+		OldRoot: mt.rootKey}
+	if err := mt.addLeafAndSetRoot(ctx, NewNodeLeaf(kHash, vHash)); err != nil {
+		return Event{}, err
+	}
+	e.NewRoot = mt.rootKey
+	return e, mt.appendJournal(ctx, e)
+}
+
+// addLeafAndSetRoot adds the leaf to the tree under the current root, and
+// stores the new root. The caller must hold the lock of the tree.
+func (mt *MerkleTree) addLeafAndSetRoot(ctx context.Context,
+	leaf *Node) error {
+	path := getPath(mt.maxLevels, leaf.Entry[0][:])
+	newRootKey, err := mt.addLeaf(ctx, leaf, mt.rootKey, 0, path)
 	if err != nil {
 		return err
 	}
@@ -176,8 +305,12 @@ func (mt *MerkleTree) AddEntry(ctx context.Context, e *Entry) error {
 // AddAndGetCircomProof does an Add, and returns a CircomProcessorProof
 func (mt *MerkleTree) AddAndGetCircomProof(ctx context.Context,
 	k, v *big.Int) (*CircomProcessorProof, error) {
+	// verify that the MerkleTree is writable
+	if !mt.writable {
+		return nil, ErrNotWritable
+	}
 	var cp CircomProcessorProof
-	cp.Fnc = 2
+	cp.Fnc = FncInsert
 	cp.OldRoot = mt.rootKey
 	gotK, gotV, _, err := mt.Get(ctx, k)
 	if err != nil && err != ErrKeyNotFound {
@@ -200,22 +333,86 @@ func (mt *MerkleTree) AddAndGetCircomProof(ctx context.Context,
 	}
 	cp.Siblings = CircomSiblingsFromSiblings(siblings, mt.maxLevels)
 
-	err = mt.Add(ctx, k, v)
+	cp.NewKey, err = NewHashFromBigInt(k)
+	if err != nil {
+		return nil, err
+	}
+	cp.NewValue, err = NewHashFromBigInt(v)
 	if err != nil {
 		return nil, err
 	}
+	e, err := mt.insert(ctx, cp.NewKey, cp.NewValue)
+	if err != nil {
+		return nil, err
+	}
+	cp.NewRoot = e.NewRoot
 
-	cp.NewKey, err = NewHashFromBigInt(k)
+	e.Proof = &cp
+	return &cp, mt.modified(ctx, e)
+}
+
+// DeleteAndGetCircomProof does a Delete, and returns a CircomProcessorProof.
+// As in circomlib's smt.js, NewKey & NewValue contain the deleted leaf, and
+// OldKey & OldValue contain the sibling leaf that moves up, in which case the
+// siblings that become empty after the deletion are trimmed. If there's no
+// such leaf, OldKey is the deleted key, OldValue is 0 and IsOld0 is true.
+func (mt *MerkleTree) DeleteAndGetCircomProof(ctx context.Context,
+	k *big.Int) (*CircomProcessorProof, error) {
+	// verify that the MerkleTree is writable
+	if !mt.writable {
+		return nil, ErrNotWritable
+	}
+	var cp CircomProcessorProof
+	cp.Fnc = FncDelete
+	cp.OldRoot = mt.rootKey
+	gotK, gotV, siblings, err := mt.Get(ctx, k)
 	if err != nil {
 		return nil, err
 	}
-	cp.NewValue, err = NewHashFromBigInt(v)
+	cp.NewKey, err = NewHashFromBigInt(gotK)
+	if err != nil {
+		return nil, err
+	}
+	cp.NewValue, err = NewHashFromBigInt(gotV)
 	if err != nil {
 		return nil, err
 	}
-	cp.NewRoot = mt.rootKey
+	cp.OldKey = cp.NewKey
+	cp.OldValue = &HashZero
+	cp.IsOld0 = true
 
-	return &cp, nil
+	// if the last sibling is a leaf, it takes the place of the deleted leaf
+	mixed := true
+	if len(siblings) > 0 {
+		n, err := mt.GetNode(ctx, siblings[len(siblings)-1])
+		if err != nil {
+			return nil, err
+		}
+		if n.Type == NodeTypeLeaf {
+			mixed = false
+			cp.OldKey = n.Entry[0]
+			cp.OldValue = n.Entry[1]
+			cp.IsOld0 = false
+		}
+	}
+	sibLen := len(siblings)
+	if !mixed {
+		sibLen--
+		for sibLen > 0 && siblings[sibLen-1].Equals(&HashZero) {
+			sibLen--
+		}
+	}
+	cp.Siblings = CircomSiblingsFromSiblings(siblings[:sibLen:sibLen],
+		mt.maxLevels)
+
+	e, err := mt.remove(ctx, cp.NewKey, nil)
+	if err != nil {
+		return nil, err
+	}
+	cp.NewRoot = e.NewRoot
+
+	e.Proof = &cp
+	return &cp, mt.modified(ctx, e)
 }
 
 // pushLeaf recursively pushes an existing oldLeaf down until its path diverges
@@ -241,11 +438,11 @@ func (mt *MerkleTree) pushLeaf(ctx context.Context, newLeaf *Node,
 		}
 		return mt.addNode(context.TODO(), newNodeMiddle)
 	}
-	oldLeafKey, err := oldLeaf.Key()
+	oldLeafKey, err := oldLeaf.KeyWithHasher(mt.hasher)
 	if err != nil {
 		return nil, err
 	}
-	newLeafKey, err := newLeaf.Key()
+	newLeafKey, err := newLeaf.KeyWithHasher(mt.hasher)
 	if err != nil {
 		return nil, err
 	}
@@ -321,18 +518,25 @@ func (mt *MerkleTree) addNode(ctx context.Context, n *Node) (*Hash, error) {
 		return nil, ErrNotWritable
 	}
 	if n.Type == NodeTypeEmpty {
-		return n.Key()
+		return n.KeyWithHasher(mt.hasher)
 	}
-	k, err := n.Key()
+	k, err := n.KeyWithHasher(mt.hasher)
 	if err != nil {
 		return nil, err
 	}
 	//v := n.Value()
-	// Check that the node key doesn't already exist
+	// Check that the node key doesn't already exist in the storage. The
+	// cache is not checked, as it may be shared with other storages.
 	if _, err := mt.db.Get(ctx, k[:]); err == nil {
 		return k, nil
 	}
-	return k, mt.db.Put(ctx, k[:], n)
+	if err := mt.db.Put(ctx, k[:], n); err != nil {
+		return nil, err
+	}
+	if mt.cache != nil {
+		mt.cache.Add(*k, n)
+	}
+	return k, nil
 }
 
 // updateNode updates an existing node in the MT.  Empty nodes are not stored
@@ -343,14 +547,17 @@ func (mt *MerkleTree) updateNode(ctx context.Context, n *Node) (*Hash, error) {
 		return nil, ErrNotWritable
 	}
 	if n.Type == NodeTypeEmpty {
-		return n.Key()
+		return n.KeyWithHasher(mt.hasher)
 	}
-	k, err := n.Key()
+	k, err := n.KeyWithHasher(mt.hasher)
 	if err != nil {
 		return nil, err
 	}
 	//v := n.Value()
 	err = mt.db.Put(ctx, k[:], n)
+	if err == nil && mt.cache != nil {
+		mt.cache.Add(*k, n)
+	}
 	return k, err
 }
 
@@ -412,9 +619,6 @@ func (mt *MerkleTree) Update(ctx context.Context,
 		return nil, errors.New("Key not inside the Finite Field")
 	}
 
-	mt.Lock()
-	defer mt.Unlock()
-
 	kHash, err := NewHashFromBigInt(k)
 	if err != nil {
 		return nil, err
@@ -423,10 +627,37 @@ func (mt *MerkleTree) Update(ctx context.Context,
 	if err != nil {
 		return nil, err
 	}
+
+	e, err := mt.replace(ctx, kHash, vHash)
+	if err != nil {
+		return nil, err
+	}
+	return e.Proof, mt.modified(ctx, e)
+}
+
+// replace sets the value of the leaf of kHash to vHash, and returns the Event
+// of the update, which is not emitted.
+func (mt *MerkleTree) replace(ctx context.Context,
+	kHash, vHash *Hash) (Event, error) {
+	mt.Lock()
+	defer mt.Unlock()
+	cp, err := mt.update(ctx, kHash, vHash)
+	if err != nil {
+		return Event{}, err
+	}
+	e := Event{Op: FncUpdate, Key: kHash, OldValue: cp.OldValue,
+		NewValue: vHash, OldRoot: cp.OldRoot, NewRoot: cp.NewRoot, Proof: cp}
+	return e, mt.appendJournal(ctx, e)
+}
+
+// update updates the value of the leaf of kHash. The caller must hold the lock
+// of the tree.
+func (mt *MerkleTree) update(ctx context.Context,
+	kHash, vHash *Hash) (*CircomProcessorProof, error) {
 	path := getPath(mt.maxLevels, kHash[:])
 
 	var cp CircomProcessorProof
-	cp.Fnc = 1
+	cp.Fnc = FncUpdate
 	cp.OldRoot = mt.rootKey
 	cp.OldKey = kHash
 	cp.NewKey = kHash
@@ -498,13 +729,47 @@ func (mt *MerkleTree) Delete(ctx context.Context, k *big.Int) error {
 		return ErrNotWritable
 	}
 
-	mt.Lock()
-	defer mt.Unlock()
-
 	kHash, err := NewHashFromBigInt(k)
 	if err != nil {
 		return err
 	}
+
+	e, err := mt.remove(ctx, kHash, nil)
+	if err != nil {
+		return err
+	}
+	return mt.modified(ctx, e)
+}
+
+// remove removes the leaf of kHash from the tree, and returns the Event of
+// the deletion, which is not emitted. If vHash is not nil, the leaf is only
+// removed if it has that value.
+func (mt *MerkleTree) remove(ctx context.Context,
+	kHash, vHash *Hash) (Event, error) {
+	mt.Lock()
+	defer mt.Unlock()
+	if vHash != nil {
+		_, v, _, err := mt.Get(ctx, kHash.BigInt())
+		if err != nil {
+			return Event{}, err
+		}
+		if v.Cmp(vHash.BigInt()) != 0 {
+			return Event{}, ErrEntryValueMismatch
+		}
+	}
+	e := Event{Op: FncDelete, Key: kHash, OldRoot: mt.rootKey}
+	oldValue, err := mt.delete(ctx, kHash)
+	if err != nil {
+		return Event{}, err
+	}
+	e.OldValue = oldValue
+	e.NewRoot = mt.rootKey
+	return e, mt.appendJournal(ctx, e)
+}
+
+// delete removes the leaf of kHash, and returns its value. The caller must
+// hold the lock of the tree.
+func (mt *MerkleTree) delete(ctx context.Context, kHash *Hash) (*Hash, error) {
 	path := getPath(mt.maxLevels, kHash[:])
 
 	nextKey := mt.rootKey
@@ -512,18 +777,18 @@ func (mt *MerkleTree) Delete(ctx context.Context, k *big.Int) error {
 	for i := 0; i < mt.maxLevels; i++ {
 		n, err := mt.GetNode(ctx, nextKey)
 		if err != nil {
-			return err
+			return nil, err
 		}
 		switch n.Type {
 		case NodeTypeEmpty:
-			return ErrKeyNotFound
+			return nil, ErrKeyNotFound
 		case NodeTypeLeaf:
 			if bytes.Equal(kHash[:], n.Entry[0][:]) {
 				// remove and go up with the sibling
 				err = mt.rmAndUpload(ctx, path, kHash, siblings)
-				return err
+				return n.Entry[1], err
 			}
-			return ErrKeyNotFound
+			return nil, ErrKeyNotFound
 		case NodeTypeMiddle:
 			if path[i] {
 				nextKey = n.ChildR
@@ -533,11 +798,11 @@ func (mt *MerkleTree) Delete(ctx context.Context, k *big.Int) error {
 				siblings = append(siblings, n.ChildR)
 			}
 		default:
-			return ErrInvalidNodeFound
+			return nil, ErrInvalidNodeFound
 		}
 	}
 
-	return ErrKeyNotFound
+	return nil, ErrKeyNotFound
 }
 
 // rmAndUpload removes the key, and goes up until the root updating all the
@@ -561,7 +826,7 @@ func (mt *MerkleTree) rmAndUpload(ctx context.Context, path []bool, kHash *Hash,
 
 	//When deleting a leaf node that is on the same level as middleNode,
 	//need to nullify the leaf node instead of removing it from the tree.
-	nearestSibling, err := mt.db.Get(ctx, toUpload[:])
+	nearestSibling, err := mt.GetNode(ctx, toUpload)
 	if err != nil {
 		return err
 	}
@@ -633,7 +898,7 @@ func (mt *MerkleTree) rmAndUpload(ctx context.Context, path []bool, kHash *Hash,
 func (mt *MerkleTree) recalculatePathUntilRoot(path []bool, node *Node,
 	siblings []*Hash) (*Hash, error) {
 	for i := len(siblings) - 1; i >= 0; i-- {
-		nodeKey, err := node.Key()
+		nodeKey, err := node.KeyWithHasher(mt.hasher)
 		if err != nil {
 			return nil, err
 		}
@@ -649,7 +914,7 @@ func (mt *MerkleTree) recalculatePathUntilRoot(path []bool, node *Node,
 	}
 
 	// return last node added, which is the root
-	nodeKey, err := node.Key()
+	nodeKey, err := node.KeyWithHasher(mt.hasher)
 	return nodeKey, err
 }
 
@@ -659,10 +924,18 @@ func (mt *MerkleTree) GetNode(ctx context.Context, key *Hash) (*Node, error) {
 	if bytes.Equal(key[:], HashZero[:]) {
 		return NewNodeEmpty(), nil
 	}
+	if mt.cache != nil {
+		if n, ok := mt.cache.Get(*key); ok {
+			return n, nil
+		}
+	}
 	n, err := mt.db.Get(ctx, key[:])
 	if err != nil {
 		return nil, err
 	}
+	if mt.cache != nil {
+		mt.cache.Add(*key, n)
+	}
 	return n, nil
 }
 
@@ -705,6 +978,17 @@ type CircomProcessorProof struct {
 	Fnc int `json:"fnc"`
 }
 
+const (
+	// FncNOP is the CircomProcessorProof function of a no-operation.
+	FncNOP = 0
+	// FncUpdate is the CircomProcessorProof function of an update.
+	FncUpdate = 1
+	// FncInsert is the CircomProcessorProof function of an insertion.
+	FncInsert = 2
+	// FncDelete is the CircomProcessorProof function of a deletion.
+	FncDelete = 3
+)
+
 // String returns a human readable string representation of the
 // CircomProcessorProof
 func (p CircomProcessorProof) String() string {
@@ -797,7 +1081,7 @@ func (mt *MerkleTree) GenerateSCVerifierProof(ctx context.Context, k *big.Int,
 // If the rootKey is nil, the current merkletree root is used
 func (mt *MerkleTree) GenerateProof(ctx context.Context, k *big.Int,
 	rootKey *Hash) (*Proof, *big.Int, error) {
-	p := &Proof{}
+	p := &Proof{hasher: mt.hasher}
 	var siblingKey *Hash
 
 	kHash, err := NewHashFromBigInt(k)
@@ -844,47 +1128,24 @@ func (mt *MerkleTree) GenerateProof(ctx context.Context, k *big.Int,
 	return nil, nil, ErrKeyNotFound
 }
 
-// walk is a helper recursive function to iterate over all tree branches
-func (mt *MerkleTree) walk(ctx context.Context,
-	key *Hash, f func(*Node)) error {
-	n, err := mt.GetNode(ctx, key)
-	if err != nil {
-		return err
-	}
-	switch n.Type {
-	case NodeTypeEmpty:
-		f(n)
-	case NodeTypeLeaf:
-		f(n)
-	case NodeTypeMiddle:
-		f(n)
-		if err := mt.walk(ctx, n.ChildL, f); err != nil {
-			return err
-		}
-		if err := mt.walk(ctx, n.ChildR, f); err != nil {
-			return err
-		}
-	default:
-		return ErrInvalidNodeFound
-	}
-	return nil
-}
-
 // Walk iterates over all the branches of a MerkleTree with the given rootKey
 // if rootKey is nil, it will get the current RootKey of the current state of
 // the MerkleTree.  For each node, it calls the f function given in the
-// parameters.  See some examples of the Walk function usage in the
-// merkletree.go and merkletree_test.go
+// parameters.  See WalkNodes to control the traversal or return an error from
+// the function.
 func (mt *MerkleTree) Walk(ctx context.Context, rootKey *Hash,
 	f func(*Node)) error {
 	if rootKey == nil {
 		rootKey = mt.Root()
 	}
-	err := mt.walk(ctx, rootKey, f)
-	return err
+	return mt.WalkNodes(ctx, rootKey,
+		func(n *Node, _ int, _ []bool) (WalkAction, error) {
+			f(n)
+			return WalkContinue, nil
+		})
 }
 
-// GraphViz uses Walk function to generate a string GraphViz representation of
+// GraphViz uses WalkNodes function to generate a string GraphViz representation of
 // the tree and writes it to w
 func (mt *MerkleTree) GraphViz(ctx context.Context, w io.Writer,
 	rootKey *Hash) error {
@@ -892,37 +1153,35 @@ func (mt *MerkleTree) GraphViz(ctx context.Context, w io.Writer,
 node [fontname=Monospace,fontsize=10,shape=box]
 `)
 	cnt := 0
-	var errIn error
-	err := mt.Walk(ctx, rootKey, func(n *Node) {
-		k, err := n.Key()
-		if err != nil {
-			errIn = err
-		}
-		switch n.Type {
-		case NodeTypeEmpty:
-		case NodeTypeLeaf:
-			fmt.Fprintf(w, "\"%v\" [style=filled];\n", k.String())
-		case NodeTypeMiddle:
-			lr := [2]string{n.ChildL.String(), n.ChildR.String()}
-			emptyNodes := ""
-			for i := range lr {
-				if lr[i] == "0" {
-					lr[i] = fmt.Sprintf("empty%v", cnt)
-					emptyNodes += fmt.Sprintf("\"%v\" [style=dashed,label=0];\n",
-						lr[i])
-					cnt++
+	err := mt.WalkNodes(ctx, rootKey,
+		func(n *Node, _ int, _ []bool) (WalkAction, error) {
+			k, err := n.KeyWithHasher(mt.hasher)
+			if err != nil {
+				return WalkStop, err
+			}
+			switch n.Type {
+			case NodeTypeEmpty:
+			case NodeTypeLeaf:
+				fmt.Fprintf(w, "\"%v\" [style=filled];\n", k.String())
+			case NodeTypeMiddle:
+				lr := [2]string{n.ChildL.String(), n.ChildR.String()}
+				emptyNodes := ""
+				for i := range lr {
+					if lr[i] == "0" {
+						lr[i] = fmt.Sprintf("empty%v", cnt)
+						emptyNodes += fmt.Sprintf(
+							"\"%v\" [style=dashed,label=0];\n", lr[i])
+						cnt++
+					}
 				}
+				fmt.Fprintf(w, "\"%v\" -> {\"%v\" \"%v\"}\n", k.String(),
+					lr[0], lr[1])
+				fmt.Fprint(w, emptyNodes)
+			default:
 			}
-			fmt.Fprintf(w, "\"%v\" -> {\"%v\" \"%v\"}\n", k.String(), lr[0],
-				lr[1])
-			fmt.Fprint(w, emptyNodes)
-		default:
-		}
-	})
+			return WalkContinue, nil
+		})
 	fmt.Fprintf(w, "}\n")
-	if errIn != nil {
-		return errIn
-	}
 	return err
 }
 
@@ -950,19 +1209,25 @@ func (mt *MerkleTree) PrintGraphViz(ctx context.Context, rootKey *Hash) error {
 func (mt *MerkleTree) DumpLeafs(ctx context.Context,
 	rootKey *Hash) ([]byte, error) {
 	var buf bytes.Buffer
-	err := mt.Walk(ctx, rootKey, func(n *Node) {
-		if n.Type == NodeTypeLeaf {
-			buf.Grow(len(n.Entry[0]) + len(n.Entry[1]))
-			buf.Write(n.Entry[0][:])
-			buf.Write(n.Entry[1][:])
-		}
-	})
+	err := mt.WalkNodes(ctx, rootKey,
+		func(n *Node, _ int, _ []bool) (WalkAction, error) {
+			if n.Type == NodeTypeLeaf {
+				buf.Grow(len(n.Entry[0]) + len(n.Entry[1]))
+				buf.Write(n.Entry[0][:])
+				buf.Write(n.Entry[1][:])
+			}
+			return WalkContinue, nil
+		})
 	return buf.Bytes(), err
 }
 
 // ImportDumpedLeafs parses and adds to the MerkleTree the dumped list of leafs
 // from the DumpLeafs function.
 func (mt *MerkleTree) ImportDumpedLeafs(ctx context.Context, b []byte) error {
+	// verify that the MerkleTree is writable
+	if !mt.writable {
+		return ErrNotWritable
+	}
 	hashLn := len(Hash{})
 	nodeLn := hashLn * 2
 	if len(b)%nodeLn != 0 {
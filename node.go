@@ -35,6 +35,8 @@ type Node struct {
 	Entry [2]*Hash
 	// key is a cache used to avoid recalculating key
 	key *Hash
+	// keyHasher is the name of the Hasher used to calculate the cached key
+	keyHasher string
 }
 
 // NewNodeLeaf creates a new leaf node.
@@ -85,33 +87,47 @@ func NewNodeFromBytes(b []byte) (*Node, error) {
 // LeafKey computes the key of a leaf node given the hIndex and hValue of the
 // entry of the leaf.
 func LeafKey(k, v *Hash) (*Hash, error) {
-	return HashElemsKey(big.NewInt(1), k.BigInt(), v.BigInt())
+	return LeafKeyWithHasher(PoseidonHasher{}, k, v)
+}
+
+// LeafKeyWithHasher computes the key of a leaf node given the hIndex and
+// hValue of the entry of the leaf, using the given Hasher.
+func LeafKeyWithHasher(h Hasher, k, v *Hash) (*Hash, error) {
+	return h.Hash(k.BigInt(), v.BigInt(), big.NewInt(1))
 }
 
 // Key computes the key of the node by hashing the content in a specific way
 // for each type of node.  This key is used as the hash of the merkle tree for
 // each node.
 func (n *Node) Key() (*Hash, error) {
-	if n.key == nil { // Cache the key to avoid repeated hash computations.
+	return n.KeyWithHasher(PoseidonHasher{})
+}
+
+// KeyWithHasher computes the key of the node like Key, using the given
+// Hasher.
+func (n *Node) KeyWithHasher(h Hasher) (*Hash, error) {
+	// Cache the key to avoid repeated hash computations.
+	if n.key == nil || n.keyHasher != h.Name() {
+		var key *Hash
+		var err error
 		// NOTE: We are not using the type to calculate the hash!
 		switch n.Type {
 		case NodeTypeMiddle: // H(ChildL || ChildR)
-			var err error
-			n.key, err = HashElems(n.ChildL.BigInt(), n.ChildR.BigInt())
+			key, err = h.Hash(n.ChildL.BigInt(), n.ChildR.BigInt())
 			if err != nil {
 				return nil, err
 			}
 		case NodeTypeLeaf:
-			var err error
-			n.key, err = LeafKey(n.Entry[0], n.Entry[1])
+			key, err = LeafKeyWithHasher(h, n.Entry[0], n.Entry[1])
 			if err != nil {
 				return nil, err
 			}
 		case NodeTypeEmpty: // Zero
-			n.key = &HashZero
+			key = &HashZero
 		default:
-			n.key = &HashZero
+			key = &HashZero
 		}
+		n.key, n.keyHasher = key, h.Name()
 	}
 	return n.key, nil
 }
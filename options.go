@@ -0,0 +1,158 @@
+package merkletree
+
+import (
+	"container/list"
+	"sync"
+)
+
+// Option configures a MerkleTree when it's loaded with NewMerkleTree.
+type Option func(*MerkleTree)
+
+// WithReadOnly loads the MerkleTree in read-only mode. The storage is never
+// written, and all the operations that modify the tree return ErrNotWritable.
+// See OpenReadOnly.
+func WithReadOnly() Option {
+	return func(mt *MerkleTree) {
+		mt.writable = false
+	}
+}
+
+// WithHasher sets the Hasher used to compute the keys of the nodes. A tree
+// must always be opened with the Hasher it was created with. If the Storage
+// is a HasherStorage, the Hasher of a new tree is stored, a tree opened with
+// a different Hasher returns ErrHasherMismatch, and the stored Hasher is used
+// when this Option is not given. Otherwise the PoseidonHasher is used by
+// default.
+func WithHasher(h Hasher) Option {
+	return func(mt *MerkleTree) {
+		mt.hasher = h
+	}
+}
+
+// WithNodeCache sets a NodeCache used to avoid reading from the Storage the
+// nodes that were recently read or written.
+func WithNodeCache(c NodeCache) Option {
+	return func(mt *MerkleTree) {
+		mt.cache = c
+	}
+}
+
+// WithEventHook adds an EventHook called after each modification of the tree.
+// It can be used several times to add several hooks, which are called in the
+// same order. See MerkleTree.Subscribe to add hooks once the tree is loaded.
+func WithEventHook(h EventHook) Option {
+	return func(mt *MerkleTree) {
+		mt.hooks.add(h)
+	}
+}
+
+// WithHookErrorPolicy sets how the errors returned by the EventHooks are
+// handled. By default they are logged with HookErrorLog.
+func WithHookErrorPolicy(p HookErrorPolicy) Option {
+	return func(mt *MerkleTree) {
+		mt.hookErrorPolicy = p
+	}
+}
+
+// WithJournal sets a Journal where each modification of the tree is recorded.
+// See Replay.
+func WithJournal(j Journal) Option {
+	return func(mt *MerkleTree) {
+		mt.journal = j
+	}
+}
+
+// WithWalkPrefetch sets the number of nodes that WalkNodes (and all the
+// traversals based on it) fetches concurrently in advance, which reduces the
+// latency of walking trees in remote storages. By default the nodes are
+// fetched one by one.
+func WithWalkPrefetch(workers int) Option {
+	return func(mt *MerkleTree) {
+		mt.prefetch = workers
+	}
+}
+
+// WithLogger sets the Logger used by the MerkleTree. By default nothing is
+// logged.
+func WithLogger(l Logger) Option {
+	return func(mt *MerkleTree) {
+		mt.logger = l
+	}
+}
+
+// Logger is the interface used by the MerkleTree to log. It's satisfied by
+// *log.Logger.
+type Logger interface {
+	Printf(format string, v ...interface{})
+}
+
+// logf logs using the Logger of the MerkleTree, if any.
+func (mt *MerkleTree) logf(format string, v ...interface{}) {
+	if mt.logger != nil {
+		mt.logger.Printf(format, v...)
+	}
+}
+
+// NodeCache is a cache of the nodes of a MerkleTree, indexed by their key. As
+// the key of a node is the hash of its content, cached nodes never become
+// stale. The cache only serves reads, and the nodes are always written to the
+// Storage, so a NodeCache can be shared by several trees. Implementations must
+// be safe for concurrent use.
+type NodeCache interface {
+	// Get returns the cached node with the given key, if any.
+	Get(key Hash) (*Node, bool)
+	// Add adds the node with the given key to the cache.
+	Add(key Hash, n *Node)
+}
+
+// lruNodeCache is a NodeCache that keeps the most recently used nodes.
+type lruNodeCache struct {
+	mu    sync.Mutex
+	size  int
+	ll    *list.List
+	items map[Hash]*list.Element
+}
+
+type lruNodeCacheEntry struct {
+	key  Hash
+	node Node
+}
+
+// NewLRUNodeCache returns a NodeCache that keeps up to size nodes, evicting
+// the least recently used one when it's full.
+func NewLRUNodeCache(size int) NodeCache {
+	return &lruNodeCache{size: size, ll: list.New(),
+		items: make(map[Hash]*list.Element)}
+}
+
+// Get returns the cached node with the given key, if any.
+func (c *lruNodeCache) Get(key Hash) (*Node, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	c.ll.MoveToFront(e)
+	n := e.Value.(*lruNodeCacheEntry).node
+	return &n, true
+}
+
+// Add adds the node with the given key to the cache.
+func (c *lruNodeCache) Add(key Hash, n *Node) {
+	if c.size <= 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.items[key]; ok {
+		c.ll.MoveToFront(e)
+		return
+	}
+	c.items[key] = c.ll.PushFront(&lruNodeCacheEntry{key: key, node: *n})
+	if c.ll.Len() > c.size {
+		last := c.ll.Back()
+		c.ll.Remove(last)
+		delete(c.items, last.Value.(*lruNodeCacheEntry).key)
+	}
+}
@@ -0,0 +1,166 @@
+package merkletree_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"testing"
+
+	"github.com/iden3/go-merkletree-sql/v2"
+	"github.com/iden3/go-merkletree-sql/v2/db/memory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type countingStorage struct {
+	merkletree.Storage
+	gets int
+}
+
+func (s *countingStorage) Get(ctx context.Context,
+	key []byte) (*merkletree.Node, error) {
+	s.gets++
+	return s.Storage.Get(ctx, key)
+}
+
+type testLogger struct {
+	lines []string
+}
+
+func (l *testLogger) Printf(format string, v ...interface{}) {
+	l.lines = append(l.lines, fmt.Sprintf(format, v...))
+}
+
+func TestOptionReadOnly(t *testing.T) {
+	ctx := context.Background()
+	mt, err := merkletree.NewMerkleTree(ctx, memory.NewMemoryStorage(), 10,
+		merkletree.WithReadOnly())
+	require.NoError(t, err)
+	err = mt.Add(ctx, big.NewInt(1), big.NewInt(2))
+	assert.ErrorIs(t, err, merkletree.ErrNotWritable)
+}
+
+func TestOptionNodeCache(t *testing.T) {
+	ctx := context.Background()
+	storage := &countingStorage{Storage: memory.NewMemoryStorage()}
+	mt, err := merkletree.NewMerkleTree(ctx, storage, 40,
+		merkletree.WithNodeCache(merkletree.NewLRUNodeCache(1024)))
+	require.NoError(t, err)
+	mtNoCache, err := merkletree.NewMerkleTree(ctx,
+		memory.NewMemoryStorage(), 40)
+	require.NoError(t, err)
+	for i := 0; i < 32; i++ {
+		k, v := big.NewInt(int64(i)), big.NewInt(int64(i*2))
+		require.NoError(t, mt.Add(ctx, k, v))
+		require.NoError(t, mtNoCache.Add(ctx, k, v))
+	}
+	assert.Equal(t, mtNoCache.Root(), mt.Root())
+
+	// all the nodes were written through the cache
+	storage.gets = 0
+	for i := 0; i < 32; i++ {
+		_, v, _, err := mt.Get(ctx, big.NewInt(int64(i)))
+		require.NoError(t, err)
+		assert.Equal(t, 0, big.NewInt(int64(i*2)).Cmp(v))
+	}
+	assert.Equal(t, 0, storage.gets)
+}
+
+func TestOptionNodeCacheShared(t *testing.T) {
+	ctx := context.Background()
+	cache := merkletree.NewLRUNodeCache(1024)
+	storage1 := memory.NewMemoryStorage()
+	storage2 := memory.NewMemoryStorage()
+	mt1, err := merkletree.NewMerkleTree(ctx, storage1, 40,
+		merkletree.WithNodeCache(cache))
+	require.NoError(t, err)
+	mt2, err := merkletree.NewMerkleTree(ctx, storage2, 40,
+		merkletree.WithNodeCache(cache))
+	require.NoError(t, err)
+	for i := 0; i < 16; i++ {
+		k, v := big.NewInt(int64(i)), big.NewInt(int64(i*2))
+		require.NoError(t, mt1.Add(ctx, k, v))
+		require.NoError(t, mt2.Add(ctx, k, v))
+	}
+	require.Equal(t, mt1.Root(), mt2.Root())
+
+	// the second storage has all its nodes, although they were cached by
+	// the first tree
+	reopened, err := merkletree.NewMerkleTree(ctx, storage2, 40)
+	require.NoError(t, err)
+	report, err := reopened.Check(ctx, nil)
+	require.NoError(t, err)
+	assert.True(t, report.OK(), report.Issues)
+	for i := 0; i < 16; i++ {
+		_, v, _, err := reopened.Get(ctx, big.NewInt(int64(i)))
+		require.NoError(t, err)
+		assert.Equal(t, 0, big.NewInt(int64(i*2)).Cmp(v))
+	}
+}
+
+func TestLRUNodeCacheEviction(t *testing.T) {
+	c := merkletree.NewLRUNodeCache(2)
+	n1 := merkletree.NewNodeLeaf(&merkletree.Hash{1}, &merkletree.Hash{1})
+	n2 := merkletree.NewNodeLeaf(&merkletree.Hash{2}, &merkletree.Hash{2})
+	n3 := merkletree.NewNodeLeaf(&merkletree.Hash{3}, &merkletree.Hash{3})
+	c.Add(merkletree.Hash{1}, n1)
+	c.Add(merkletree.Hash{2}, n2)
+	_, ok := c.Get(merkletree.Hash{1})
+	require.True(t, ok)
+	c.Add(merkletree.Hash{3}, n3)
+
+	_, ok = c.Get(merkletree.Hash{2})
+	assert.False(t, ok)
+	n, ok := c.Get(merkletree.Hash{1})
+	require.True(t, ok)
+	assert.Equal(t, n1.Entry, n.Entry)
+	_, ok = c.Get(merkletree.Hash{3})
+	assert.True(t, ok)
+}
+
+func TestOptionEventHook(t *testing.T) {
+	ctx := context.Background()
+	logger := &testLogger{}
+	var events []merkletree.Event
+	mt, err := merkletree.NewMerkleTree(ctx, memory.NewMemoryStorage(), 10,
+		merkletree.WithLogger(logger),
+		merkletree.WithEventHook(
+			func(_ context.Context, e merkletree.Event) error {
+				events = append(events, e)
+				return nil
+			}),
+		merkletree.WithEventHook(
+			func(_ context.Context, e merkletree.Event) error {
+				return errors.New("hook failure")
+			}))
+	require.NoError(t, err)
+
+	root0 := mt.Root()
+	require.NoError(t, mt.Add(ctx, big.NewInt(1), big.NewInt(2)))
+	root1 := mt.Root()
+	_, err = mt.Update(ctx, big.NewInt(1), big.NewInt(3))
+	require.NoError(t, err)
+	root2 := mt.Root()
+	require.NoError(t, mt.Delete(ctx, big.NewInt(1)))
+
+	require.Len(t, events, 3)
+	assert.Equal(t, merkletree.FncInsert, events[0].Op)
+	assert.Equal(t, root0, events[0].OldRoot)
+	assert.Equal(t, root1, events[0].NewRoot)
+	assert.Nil(t, events[0].OldValue)
+	assert.Equal(t, "2", events[0].NewValue.String())
+	assert.Equal(t, merkletree.FncUpdate, events[1].Op)
+	assert.Equal(t, root1, events[1].OldRoot)
+	assert.Equal(t, root2, events[1].NewRoot)
+	assert.Equal(t, "2", events[1].OldValue.String())
+	assert.Equal(t, "3", events[1].NewValue.String())
+	assert.Equal(t, merkletree.FncDelete, events[2].Op)
+	assert.Equal(t, "1", events[2].Key.String())
+	assert.Equal(t, "3", events[2].OldValue.String())
+	assert.Nil(t, events[2].NewValue)
+	assert.Equal(t, &merkletree.HashZero, events[2].NewRoot)
+
+	// creation of the tree, and a failure of the second hook for each event
+	assert.Len(t, logger.lines, 4)
+}
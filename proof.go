@@ -2,11 +2,40 @@ package merkletree
 
 import (
 	"bytes"
+	"encoding/binary"
 	"encoding/json"
 	"fmt"
 	"math/big"
 )
 
+const (
+	// MaxTreeLevels is the maximum number of levels of a MerkleTree, which
+	// is the bit length of the elements of the Poseidon field.
+	MaxTreeLevels = 254
+
+	// proofBitmapLen is the byte length of the bitmap of non-empty
+	// siblings, enough to hold MaxTreeLevels bits.
+	proofBitmapLen = 32
+	// proofLegacyBitmapLen is the byte length of the bitmap of non-empty
+	// siblings in the legacy proof format, which limits the depth of the
+	// proofs to 240 levels.
+	proofLegacyBitmapLen = ElemBytesLen - proofFlagsLen
+	// proofFlagVersioned is set in the flags of versioned proof formats.
+	// The legacy format only uses the two lower bits of the flags.
+	proofFlagVersioned = 0x80
+	// proofFlagHasher is set in the flags of the version 2 format when the
+	// proof contains the name of its Hasher, which is omitted for the
+	// default one.
+	proofFlagHasher = 0x04
+	// proofVersion2 is the version of the current proof format:
+	// {flags | version | depth | notempties (32 bytes) |
+	// [hasher name length (uvarint) | hasher name] | siblings | nodeAux}
+	proofVersion2 = 2
+	// proofV2HeaderLen is the byte length of the header of the version 2
+	// proof format.
+	proofV2HeaderLen = 3 + proofBitmapLen
+)
+
 // Proof defines the required elements for a MT proof of existence or
 // non-existence.
 type Proof struct {
@@ -16,11 +45,13 @@ type Proof struct {
 	// depth indicates how deep in the tree the proof goes
 	depth uint
 	// notempties is a bitmap of non-empty siblings found in siblings
-	notempties [ElemBytesLen - proofFlagsLen]byte
+	notempties [proofBitmapLen]byte
 	// siblings is a list of non-empty sibling keys
 	siblings []*Hash
 	// Auxiliary node if needed
 	NodeAux *NodeAux
+	// hasher is the Hasher of the tree that generated the proof
+	hasher Hasher
 }
 
 // proofJSON defines the required elements for a MT proof in json serializable structure
@@ -32,25 +63,77 @@ type proofJSON struct {
 	Siblings []*Hash `json:"siblings"`
 	// Auxiliary node if needed
 	NodeAux *NodeAux `json:"node_aux,omitempty"`
+	// Hasher is the name of the Hasher, omitted for the default one
+	Hasher string `json:"hasher,omitempty"`
 }
 
-// NewProofFromBytes parses a byte array into a Proof
+// NewProofFromBytes parses a byte array into a Proof. Both the version 2
+// format and the legacy format are supported.
 func NewProofFromBytes(bs []byte) (*Proof, error) {
+	if len(bs) > 0 && bs[0]&proofFlagVersioned != 0 {
+		return newProofFromBytesV2(bs)
+	}
 	if len(bs) < ElemBytesLen {
 		return nil, ErrInvalidProofBytes
 	}
 	p := &Proof{}
-	if (bs[0] & 0x01) == 0 {
+	p.depth = uint(bs[1])
+	if p.depth > proofLegacyBitmapLen*8 {
+		return nil, ErrInvalidProofBytes
+	}
+	copy(p.notempties[proofBitmapLen-proofLegacyBitmapLen:],
+		bs[proofFlagsLen:ElemBytesLen])
+	err := p.parseBody(bs[0], bs[ElemBytesLen:])
+	if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// newProofFromBytesV2 parses a byte array in the version 2 format into a
+// Proof
+func newProofFromBytesV2(bs []byte) (*Proof, error) {
+	if len(bs) < proofV2HeaderLen || bs[1] != proofVersion2 {
+		return nil, ErrInvalidProofBytes
+	}
+	p := &Proof{}
+	p.depth = uint(bs[2])
+	if p.depth > MaxTreeLevels {
+		return nil, ErrInvalidProofBytes
+	}
+	copy(p.notempties[:], bs[3:proofV2HeaderLen])
+	body := bs[proofV2HeaderLen:]
+	if bs[0]&proofFlagHasher != 0 {
+		nameLen, n := binary.Uvarint(body)
+		if n <= 0 || nameLen > uint64(len(body)-n) {
+			return nil, ErrInvalidProofBytes
+		}
+		name := string(body[n : n+int(nameLen)])
+		body = body[n+int(nameLen):]
+		var err error
+		p.hasher, err = HasherByName(name)
+		if err != nil {
+			return nil, err
+		}
+	}
+	err := p.parseBody(bs[0], body)
+	if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// parseBody parses the siblings and the auxiliary node of a serialized proof,
+// once the header has been parsed.
+func (p *Proof) parseBody(flags byte, siblingBytes []byte) error {
+	if (flags & 0x01) == 0 {
 		p.Existence = true
 	}
-	p.depth = uint(bs[1])
-	copy(p.notempties[:], bs[proofFlagsLen:ElemBytesLen])
-	siblingBytes := bs[ElemBytesLen:]
 	sibIdx := 0
 	for i := uint(0); i < p.depth; i++ {
 		if TestBitBigEndian(p.notempties[:], i) {
 			if len(siblingBytes) < (sibIdx+1)*ElemBytesLen {
-				return nil, ErrInvalidProofBytes
+				return ErrInvalidProofBytes
 			}
 			var sib Hash
 			copy(sib[:],
@@ -60,16 +143,16 @@ func NewProofFromBytes(bs []byte) (*Proof, error) {
 		}
 	}
 
-	if !p.Existence && ((bs[0] & 0x02) != 0) {
+	if !p.Existence && ((flags & 0x02) != 0) {
 		p.NodeAux = &NodeAux{Key: &Hash{}, Value: &Hash{}}
 		nodeAuxBytes := siblingBytes[len(p.siblings)*ElemBytesLen:]
 		if len(nodeAuxBytes) != 2*ElemBytesLen {
-			return nil, ErrInvalidProofBytes
+			return ErrInvalidProofBytes
 		}
 		copy(p.NodeAux.Key[:], nodeAuxBytes[:ElemBytesLen])
 		copy(p.NodeAux.Value[:], nodeAuxBytes[ElemBytesLen:2*ElemBytesLen])
 	}
-	return p, nil
+	return nil
 }
 
 // NewProofFromData reconstructs proof from siblings and auxiliary node
@@ -79,6 +162,9 @@ func NewProofFromData(existence bool,
 	var p Proof
 	p.Existence = existence
 	p.NodeAux = nodeAux
+	if len(allSiblings) > MaxTreeLevels {
+		return nil, ErrReachedMaxLevel
+	}
 	var siblings []*Hash
 	p.depth = 0
 	for lvl, sibling := range allSiblings {
@@ -92,9 +178,65 @@ func NewProofFromData(existence bool,
 	return &p, nil
 }
 
-// Bytes serializes a Proof into a byte array.
+// Bytes serializes a Proof into a byte array. Proofs of up to 240 levels with
+// the default Hasher are serialized in the legacy format, to be compatible
+// with existing parsers, and deeper proofs or proofs of other Hashers in the
+// version 2 format, which contains the name of the Hasher.
 func (p *Proof) Bytes() []byte {
-	bsLen := proofFlagsLen + len(p.notempties) + ElemBytesLen*len(p.siblings)
+	if p.depth > proofLegacyBitmapLen*8 ||
+		!sameHasher(p.Hasher(), PoseidonHasher{}) {
+		return p.bytesV2()
+	}
+	bs := p.encode(ElemBytesLen)
+	bs[1] = byte(p.depth)
+	copy(bs[proofFlagsLen:ElemBytesLen],
+		p.notempties[proofBitmapLen-proofLegacyBitmapLen:])
+	return bs
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler interface, serializing
+// the Proof in the version 2 format.
+func (p Proof) MarshalBinary() ([]byte, error) {
+	return p.bytesV2(), nil
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler interface
+func (p *Proof) UnmarshalBinary(data []byte) error {
+	proof, err := NewProofFromBytes(data)
+	if err != nil {
+		return err
+	}
+	*p = *proof
+	return nil
+}
+
+// bytesV2 serializes a Proof into a byte array in the version 2 format. The
+// name of the Hasher is included unless it's the default one.
+func (p *Proof) bytesV2() []byte {
+	var hasherName []byte
+	if !sameHasher(p.Hasher(), PoseidonHasher{}) {
+		name := p.Hasher().Name()
+		hasherName = make([]byte, binary.MaxVarintLen64,
+			binary.MaxVarintLen64+len(name))
+		n := binary.PutUvarint(hasherName, uint64(len(name)))
+		hasherName = append(hasherName[:n], name...)
+	}
+	bs := p.encode(proofV2HeaderLen + len(hasherName))
+	bs[0] |= proofFlagVersioned
+	if hasherName != nil {
+		bs[0] |= proofFlagHasher
+	}
+	bs[1] = proofVersion2
+	bs[2] = byte(p.depth)
+	copy(bs[3:proofV2HeaderLen], p.notempties[:])
+	copy(bs[proofV2HeaderLen:], hasherName)
+	return bs
+}
+
+// encode allocates the serialized Proof with a header of headerLen bytes,
+// and sets the flags, the siblings and the auxiliary node.
+func (p *Proof) encode(headerLen int) []byte {
+	bsLen := headerLen + ElemBytesLen*len(p.siblings)
 	if p.NodeAux != nil {
 		bsLen += 2 * ElemBytesLen
 	}
@@ -103,9 +245,7 @@ func (p *Proof) Bytes() []byte {
 	if !p.Existence {
 		bs[0] |= 0x01
 	}
-	bs[1] = byte(p.depth)
-	copy(bs[proofFlagsLen:len(p.notempties)+proofFlagsLen], p.notempties[:])
-	siblingsBytes := bs[len(p.notempties)+proofFlagsLen:]
+	siblingsBytes := bs[headerLen:]
 	for i, k := range p.siblings {
 		copy(siblingsBytes[i*ElemBytesLen:(i+1)*ElemBytesLen], k[:])
 	}
@@ -122,6 +262,15 @@ func (p *Proof) AllSiblings() []*Hash {
 	return SiblingsFromProof(p)
 }
 
+// Hasher returns the Hasher of the tree that generated the proof. If it's
+// unknown, the default PoseidonHasher is returned.
+func (p *Proof) Hasher() Hasher {
+	if p.hasher == nil {
+		return PoseidonHasher{}
+	}
+	return p.hasher
+}
+
 // MarshalJSON implements json.Marshaler interface
 func (p Proof) MarshalJSON() ([]byte, error) {
 	obj := proofJSON{
@@ -129,6 +278,9 @@ func (p Proof) MarshalJSON() ([]byte, error) {
 		Siblings:  p.AllSiblings(),
 		NodeAux:   p.NodeAux,
 	}
+	if !sameHasher(p.Hasher(), PoseidonHasher{}) {
+		obj.Hasher = p.Hasher().Name()
+	}
 	return json.Marshal(obj)
 }
 
@@ -150,6 +302,13 @@ func (p *Proof) UnmarshalJSON(data []byte) error {
 	p.NodeAux = proof.NodeAux
 	p.notempties = proof.notempties
 	p.depth = proof.depth
+	p.hasher = nil
+	if obj.Hasher != "" {
+		p.hasher, err = HasherByName(obj.Hasher)
+		if err != nil {
+			return err
+		}
+	}
 
 	return nil
 }
@@ -169,9 +328,18 @@ func SiblingsFromProof(proof *Proof) []*Hash {
 	return siblings
 }
 
-// VerifyProof verifies the Merkle Proof for the entry and root.
+// VerifyProof verifies the Merkle Proof for the entry and root, using the
+// Hasher of the proof.
 func VerifyProof(rootKey *Hash, proof *Proof, k, v *big.Int) bool {
-	rootFromProof, err := RootFromProof(proof, k, v)
+	return VerifyProofWithHasher(proof.Hasher(), rootKey, proof, k, v)
+}
+
+// VerifyProofWithHasher verifies the Merkle Proof for the entry and root
+// using the given Hasher. If the proof was generated by a tree with a
+// different Hasher, it's not valid.
+func VerifyProofWithHasher(h Hasher, rootKey *Hash, proof *Proof,
+	k, v *big.Int) bool {
+	rootFromProof, err := RootFromProofWithHasher(h, proof, k, v)
 	if err != nil {
 		return false
 	}
@@ -180,8 +348,19 @@ func VerifyProof(rootKey *Hash, proof *Proof, k, v *big.Int) bool {
 
 // RootFromProof calculates the root that would correspond to a tree whose
 // siblings are the ones in the proof with the leaf hashing to hIndex and
-// hValue.
+// hValue, using the Hasher of the proof.
 func RootFromProof(proof *Proof, k, v *big.Int) (*Hash, error) {
+	return RootFromProofWithHasher(proof.Hasher(), proof, k, v)
+}
+
+// RootFromProofWithHasher calculates the root like RootFromProof, using the
+// given Hasher. If the proof was generated by a tree with a different Hasher,
+// ErrHasherMismatch is returned.
+func RootFromProofWithHasher(h Hasher, proof *Proof,
+	k, v *big.Int) (*Hash, error) {
+	if proof.hasher != nil && !sameHasher(h, proof.hasher) {
+		return nil, ErrHasherMismatch
+	}
 	kHash, err := NewHashFromBigInt(k)
 	if err != nil {
 		return nil, fmt.Errorf("can't create hash from Key: %w", err)
@@ -193,7 +372,7 @@ func RootFromProof(proof *Proof, k, v *big.Int) (*Hash, error) {
 	sibIdx := len(proof.siblings) - 1
 	var midKey *Hash
 	if proof.Existence {
-		midKey, err = LeafKey(kHash, vHash)
+		midKey, err = LeafKeyWithHasher(h, kHash, vHash)
 		if err != nil {
 			return nil, err
 		}
@@ -205,7 +384,8 @@ func RootFromProof(proof *Proof, k, v *big.Int) (*Hash, error) {
 				return nil,
 					fmt.Errorf("Non-existence proof being checked against hIndex equal to nodeAux")
 			}
-			midKey, err = LeafKey(proof.NodeAux.Key, proof.NodeAux.Value)
+			midKey, err = LeafKeyWithHasher(h, proof.NodeAux.Key,
+				proof.NodeAux.Value)
 			if err != nil {
 				return nil, err
 			}
@@ -221,12 +401,12 @@ func RootFromProof(proof *Proof, k, v *big.Int) (*Hash, error) {
 			siblingKey = &HashZero
 		}
 		if path[lvl] {
-			midKey, err = NewNodeMiddle(siblingKey, midKey).Key()
+			midKey, err = NewNodeMiddle(siblingKey, midKey).KeyWithHasher(h)
 			if err != nil {
 				return nil, err
 			}
 		} else {
-			midKey, err = NewNodeMiddle(midKey, siblingKey).Key()
+			midKey, err = NewNodeMiddle(midKey, siblingKey).KeyWithHasher(h)
 			if err != nil {
 				return nil, err
 			}
@@ -2,6 +2,7 @@ package merkletree_test
 
 import (
 	"context"
+	"encoding/hex"
 	"encoding/json"
 	"math/big"
 	"testing"
@@ -197,3 +198,89 @@ func TestProof_UnmarshalJSON_NonInclusionProofWithNodeAuxAllSiblings(t *testing.
 	valid = merkletree.VerifyProof(mt.Root(), &p, big.NewInt(11), big.NewInt(0))
 	assert.True(t, valid)
 }
+
+func TestProof_BytesLegacy(t *testing.T) {
+	db := memory.NewMemoryStorage()
+	ctx := context.Background()
+	mt, err := merkletree.NewMerkleTree(ctx, db, 40)
+	require.NoError(t, err)
+
+	_ = mt.Add(ctx, big.NewInt(1), big.NewInt(2)) // 1 0b000001
+	_ = mt.Add(ctx, big.NewInt(3), big.NewInt(8)) // 3 0b000011
+	_ = mt.Add(ctx, big.NewInt(7), big.NewInt(8)) // 7 0b000111
+	_ = mt.Add(ctx, big.NewInt(9), big.NewInt(8)) // 9 0b001001
+
+	proof, _, err := mt.GenerateProof(ctx, big.NewInt(11), mt.Root()) // 11 0b001011
+	require.NoError(t, err)
+
+	// legacy format, as serialized before the version 2 format
+	expected := "030300000000000000000000000000000000000000000000000000000000000" +
+		"658908ea0040f9fbf9411a90a60c0d7ca0d9e3b465c1fa5c80f1e0bd1801be61a8" +
+		"f13884439a26f4295d310badce9fb6d2851fbf85de04de84fe3582ef3a92211030" +
+		"000000000000000000000000000000000000000000000000000000000000008000" +
+		"00000000000000000000000000000000000000000000000000000000000"
+	b := proof.Bytes()
+	assert.Equal(t, expected, hex.EncodeToString(b))
+
+	p, err := merkletree.NewProofFromBytes(b)
+	require.NoError(t, err)
+	assert.Equal(t, proof.AllSiblings(), p.AllSiblings())
+	assert.Equal(t, proof.NodeAux, p.NodeAux)
+	assert.Equal(t, proof.Existence, p.Existence)
+	assert.True(t,
+		merkletree.VerifyProof(mt.Root(), p, big.NewInt(11), big.NewInt(0)))
+}
+
+func TestProof_BytesV2(t *testing.T) {
+	db := memory.NewMemoryStorage()
+	ctx := context.Background()
+	mt, err := merkletree.NewMerkleTree(ctx, db, merkletree.MaxTreeLevels)
+	require.NoError(t, err)
+
+	// the keys share the first 250 bits of the path
+	k1 := big.NewInt(1)
+	k2 := new(big.Int).Add(k1, new(big.Int).Lsh(big.NewInt(1), 250))
+	require.NoError(t, mt.Add(ctx, k1, big.NewInt(2)))
+	require.NoError(t, mt.Add(ctx, k2, big.NewInt(3)))
+
+	proof, _, err := mt.GenerateProof(ctx, k1, nil)
+	require.NoError(t, err)
+	assert.Len(t, proof.AllSiblings(), 251)
+
+	// too deep for the legacy format
+	b := proof.Bytes()
+	assert.Equal(t, byte(0x80), b[0])
+	assert.Equal(t, byte(2), b[1])
+	assert.Equal(t, byte(251), b[2])
+
+	p, err := merkletree.NewProofFromBytes(b)
+	require.NoError(t, err)
+	assert.Equal(t, proof.AllSiblings(), p.AllSiblings())
+	assert.True(t, merkletree.VerifyProof(mt.Root(), p, k1, big.NewInt(2)))
+
+	// shallow proofs can be encoded in the version 2 format too
+	proof, _, err = mt.GenerateProof(ctx, big.NewInt(5), nil)
+	require.NoError(t, err)
+	b, err = proof.MarshalBinary()
+	require.NoError(t, err)
+	assert.Equal(t, byte(0x81), b[0])
+	var p2 merkletree.Proof
+	require.NoError(t, p2.UnmarshalBinary(b))
+	assert.Equal(t, proof.AllSiblings(), p2.AllSiblings())
+	assert.Equal(t, proof.NodeAux, p2.NodeAux)
+	assert.True(t,
+		merkletree.VerifyProof(mt.Root(), &p2, big.NewInt(5), big.NewInt(0)))
+
+	b[1] = 3
+	_, err = merkletree.NewProofFromBytes(b)
+	assert.Equal(t, merkletree.ErrInvalidProofBytes, err)
+}
+
+func TestNewMerkleTreeMaxLevels(t *testing.T) {
+	ctx := context.Background()
+	_, err := merkletree.NewMerkleTree(ctx, memory.NewMemoryStorage(), 0)
+	assert.Equal(t, merkletree.ErrInvalidMaxLevels, err)
+	_, err = merkletree.NewMerkleTree(ctx, memory.NewMemoryStorage(),
+		merkletree.MaxTreeLevels+1)
+	assert.Equal(t, merkletree.ErrInvalidMaxLevels, err)
+}
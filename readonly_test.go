@@ -0,0 +1,75 @@
+package merkletree_test
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/iden3/go-merkletree-sql/v2"
+	"github.com/iden3/go-merkletree-sql/v2/db/memory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var errWriteRejected = errors.New("write rejected")
+
+// readOnlyStorage is a Storage that rejects all writes, like a database
+// opened with read-only credentials.
+type readOnlyStorage struct {
+	merkletree.Storage
+}
+
+func (readOnlyStorage) Put(context.Context, []byte, *merkletree.Node) error {
+	return errWriteRejected
+}
+
+func (readOnlyStorage) SetRoot(context.Context, *merkletree.Hash) error {
+	return errWriteRejected
+}
+
+func TestOpenReadOnlyEmptyStorage(t *testing.T) {
+	ctx := context.Background()
+	storage := readOnlyStorage{memory.NewMemoryStorage()}
+
+	_, err := merkletree.NewMerkleTree(ctx, storage, 10)
+	require.ErrorIs(t, err, errWriteRejected)
+
+	mt, err := merkletree.OpenReadOnly(ctx, storage, 10)
+	require.NoError(t, err)
+	assert.Equal(t, &merkletree.HashZero, mt.Root())
+	_, _, _, err = mt.Get(ctx, big.NewInt(1))
+	assert.ErrorIs(t, err, merkletree.ErrKeyNotFound)
+}
+
+func TestOpenReadOnly(t *testing.T) {
+	ctx := context.Background()
+	memStorage := memory.NewMemoryStorage()
+	mtW, err := merkletree.NewMerkleTree(ctx, memStorage, 10)
+	require.NoError(t, err)
+	for i := 0; i < 8; i++ {
+		err = mtW.Add(ctx, big.NewInt(int64(i)), big.NewInt(int64(i*2)))
+		require.NoError(t, err)
+	}
+
+	mt, err := merkletree.OpenReadOnly(ctx, readOnlyStorage{memStorage}, 10)
+	require.NoError(t, err)
+	assert.Equal(t, mtW.Root(), mt.Root())
+	_, v, _, err := mt.Get(ctx, big.NewInt(3))
+	require.NoError(t, err)
+	assert.Equal(t, "6", v.String())
+
+	err = mt.Add(ctx, big.NewInt(100), big.NewInt(1))
+	assert.ErrorIs(t, err, merkletree.ErrNotWritable)
+	_, err = mt.Update(ctx, big.NewInt(3), big.NewInt(1))
+	assert.ErrorIs(t, err, merkletree.ErrNotWritable)
+	err = mt.Delete(ctx, big.NewInt(3))
+	assert.ErrorIs(t, err, merkletree.ErrNotWritable)
+	_, err = mt.AddAndGetCircomProof(ctx, big.NewInt(100), big.NewInt(1))
+	assert.ErrorIs(t, err, merkletree.ErrNotWritable)
+	_, err = mt.DeleteAndGetCircomProof(ctx, big.NewInt(3))
+	assert.ErrorIs(t, err, merkletree.ErrNotWritable)
+	_, err = mt.ProcessBatch(ctx, nil, 1)
+	assert.ErrorIs(t, err, merkletree.ErrNotWritable)
+	assert.Equal(t, mtW.Root(), mt.Root())
+}
@@ -0,0 +1,111 @@
+package merkletree
+
+import (
+	"context"
+	"errors"
+)
+
+// TreeStats contains the statistics of the nodes under a root of a
+// MerkleTree.
+type TreeStats struct {
+	// Leafs is the number of leafs.
+	Leafs int
+	// Middles is the number of middle nodes.
+	Middles int
+	// EmptyChildren is the number of empty children of the middle nodes.
+	EmptyChildren int
+	// LeafDepths is the histogram of the depth of the leafs, where
+	// LeafDepths[d] is the number of leafs at depth d. Its length is
+	// MaxLevels+1.
+	LeafDepths []int
+	// MaxDepth is the depth of the deepest leaf, to be compared with the
+	// MaxLevels of the tree to know how close it is to ErrReachedMaxLevel.
+	MaxDepth int
+}
+
+// Stats walks the MerkleTree under the given rootKey and returns its
+// TreeStats. If rootKey is nil, the current Root of the MerkleTree is used.
+// It returns ErrReachedMaxLevel if the tree is deeper than its MaxLevels.
+func (mt *MerkleTree) Stats(ctx context.Context,
+	rootKey *Hash) (*TreeStats, error) {
+	stats := &TreeStats{LeafDepths: make([]int, mt.maxLevels+1)}
+	err := mt.WalkNodes(ctx, rootKey,
+		func(n *Node, depth int, _ []bool) (WalkAction, error) {
+			switch n.Type {
+			case NodeTypeLeaf:
+				stats.Leafs++
+				stats.LeafDepths[depth]++
+				if depth > stats.MaxDepth {
+					stats.MaxDepth = depth
+				}
+			case NodeTypeMiddle:
+				stats.Middles++
+				if n.ChildL.Equals(&HashZero) {
+					stats.EmptyChildren++
+				}
+				if n.ChildR.Equals(&HashZero) {
+					stats.EmptyChildren++
+				}
+			}
+			return WalkContinue, nil
+		})
+	if err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+// Count returns the number of leafs under the current Root of the MerkleTree.
+// If the Storage implements LeafCountStorage, the count is kept updated on
+// each modification of the tree, and Count doesn't need to walk the tree. The
+// count of a root not tracked yet is computed once with Stats and stored.
+func (mt *MerkleTree) Count(ctx context.Context) (uint64, error) {
+	root := mt.Root()
+	lcs, ok := mt.db.(LeafCountStorage)
+	if ok {
+		count, err := lcs.GetLeafCount(ctx, root)
+		if err == nil {
+			return count, nil
+		} else if !errors.Is(err, ErrNotFound) {
+			return 0, err
+		}
+	}
+	stats, err := mt.Stats(ctx, root)
+	if err != nil {
+		return 0, err
+	}
+	count := uint64(stats.Leafs)
+	if ok && mt.writable {
+		if err := lcs.SetLeafCount(ctx, root, count); err != nil {
+			return 0, err
+		}
+	}
+	return count, nil
+}
+
+// trackLeafCount stores the leaf count of newRoot, as the count of oldRoot
+// plus delta, if the Storage implements LeafCountStorage and the count of
+// oldRoot is known. As the count can always be recomputed, errors are only
+// logged.
+func (mt *MerkleTree) trackLeafCount(ctx context.Context, oldRoot,
+	newRoot *Hash, delta int64) {
+	lcs, ok := mt.db.(LeafCountStorage)
+	if !ok {
+		return
+	}
+	var count uint64
+	if !oldRoot.Equals(&HashZero) {
+		var err error
+		count, err = lcs.GetLeafCount(ctx, oldRoot)
+		if errors.Is(err, ErrNotFound) {
+			return
+		} else if err != nil {
+			mt.logf("merkletree: can't get leaf count: %v", err)
+			return
+		}
+	}
+	count = uint64(int64(count) + delta)
+	if err := lcs.SetLeafCount(ctx, newRoot, count); err != nil {
+		mt.logf("merkletree: can't set leaf count: %v", err)
+	}
+}
@@ -0,0 +1,98 @@
+package merkletree_test
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/iden3/go-merkletree-sql/v2"
+	"github.com/iden3/go-merkletree-sql/v2/db/memory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// walkOnlyStorage hides the LeafCountStorage methods of the wrapped Storage
+type walkOnlyStorage struct {
+	merkletree.Storage
+}
+
+func TestStats(t *testing.T) {
+	ctx := context.Background()
+	mt, err := merkletree.NewMerkleTree(ctx, memory.NewMemoryStorage(), 10)
+	require.NoError(t, err)
+
+	stats, err := mt.Stats(ctx, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 0, stats.Leafs)
+	assert.Len(t, stats.LeafDepths, 11)
+
+	// keys 1, 3, 5 & 7: 1 and 5 share the path 1-0-0 and 3 and 7 share the
+	// path 1-1-0, so all the leafs are at depth 3
+	for _, k := range []int64{1, 3, 5, 7} {
+		require.NoError(t, mt.Add(ctx, big.NewInt(k), big.NewInt(k)))
+	}
+	stats, err = mt.Stats(ctx, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 4, stats.Leafs)
+	assert.Equal(t, 3, stats.MaxDepth)
+	assert.Equal(t, 4, stats.LeafDepths[3])
+	// root -> right child -> two middle nodes with two leafs each
+	assert.Equal(t, 4, stats.Middles)
+	assert.Equal(t, 1, stats.EmptyChildren)
+}
+
+func TestStatsDeeperThanMaxLevels(t *testing.T) {
+	ctx := context.Background()
+	storage := memory.NewMemoryStorage()
+	mt, err := merkletree.NewMerkleTree(ctx, storage, 40)
+	require.NoError(t, err)
+	// keys 1 and 17 share the path 1-0-0-0, so their leafs are at depth 5
+	for _, k := range []int64{1, 17} {
+		require.NoError(t, mt.Add(ctx, big.NewInt(k), big.NewInt(k)))
+	}
+
+	mt3, err := merkletree.NewMerkleTree(ctx, storage, 3)
+	require.NoError(t, err)
+	_, err = mt3.Stats(ctx, nil)
+	assert.ErrorIs(t, err, merkletree.ErrReachedMaxLevel)
+	err = mt3.WalkNodes(ctx, nil,
+		func(*merkletree.Node, int, []bool) (merkletree.WalkAction, error) {
+			return merkletree.WalkContinue, nil
+		})
+	assert.ErrorIs(t, err, merkletree.ErrReachedMaxLevel)
+
+	mt5, err := merkletree.NewMerkleTree(ctx, storage, 5)
+	require.NoError(t, err)
+	stats, err := mt5.Stats(ctx, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 2, stats.LeafDepths[5])
+}
+
+func TestCount(t *testing.T) {
+	ctx := context.Background()
+	storage := memory.NewMemoryStorage()
+	mt, err := merkletree.NewMerkleTree(ctx, storage, 40)
+	require.NoError(t, err)
+	for i := 0; i < 20; i++ {
+		err = mt.Add(ctx, big.NewInt(int64(i)), big.NewInt(int64(i)))
+		require.NoError(t, err)
+	}
+	_, err = mt.Update(ctx, big.NewInt(3), big.NewInt(33))
+	require.NoError(t, err)
+	require.NoError(t, mt.Delete(ctx, big.NewInt(4)))
+
+	// the count is tracked in the storage
+	count, err := storage.GetLeafCount(ctx, mt.Root())
+	require.NoError(t, err)
+	assert.Equal(t, uint64(19), count)
+	count, err = mt.Count(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(19), count)
+
+	// without LeafCountStorage the tree is walked
+	mtWalk, err := merkletree.OpenReadOnly(ctx, walkOnlyStorage{storage}, 40)
+	require.NoError(t, err)
+	count, err = mtWalk.Count(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(19), count)
+}
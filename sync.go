@@ -0,0 +1,90 @@
+package merkletree
+
+import (
+	"context"
+	"errors"
+)
+
+// SyncProgress reports the progress of a SyncStorage.
+type SyncProgress struct {
+	// Copied is the number of nodes copied to the destination.
+	Copied int
+	// Skipped is the number of subtrees skipped because their root node
+	// already was in the destination.
+	Skipped int
+}
+
+// SyncStorage copies from src to dst the nodes reachable from root that dst
+// doesn't have, and then sets root as the root of dst. The nodes are copied
+// children first, so when a node is found in dst its whole subtree is assumed
+// to be there too, and is skipped. This also makes SyncStorage resumable: if
+// it's interrupted, calling it again copies only the remaining nodes. If
+// progress is not nil, it's called after each copied node. If src stores the
+// name of its Hasher (see HasherStorage), it's stored in dst too, and
+// ErrHasherMismatch is returned if dst already has a different one.
+func SyncStorage(ctx context.Context, src, dst Storage, root *Hash,
+	progress func(SyncProgress)) (SyncProgress, error) {
+	var p SyncProgress
+	srcName, err := storedHasherName(ctx, src)
+	if err != nil {
+		return p, err
+	}
+	dstName, err := storedHasherName(ctx, dst)
+	if err != nil {
+		return p, err
+	}
+	if srcName != "" && dstName != "" {
+		if err := checkHasherName(dstName, srcName); err != nil {
+			return p, err
+		}
+	}
+	type syncItem struct {
+		key *Hash
+		// n is set once the children of the node are pending to be copied
+		n *Node
+	}
+	stack := []syncItem{{key: root}}
+	for len(stack) > 0 {
+		item := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		if err := ctx.Err(); err != nil {
+			return p, err
+		}
+		if item.n == nil {
+			if item.key.Equals(&HashZero) {
+				continue
+			}
+			_, err := dst.Get(ctx, item.key[:])
+			if err == nil {
+				p.Skipped++
+				continue
+			} else if !errors.Is(err, ErrNotFound) {
+				return p, err
+			}
+			n, err := src.Get(ctx, item.key[:])
+			if err != nil {
+				return p, err
+			}
+			if n.Type == NodeTypeMiddle {
+				stack = append(stack, syncItem{key: item.key, n: n},
+					syncItem{key: n.ChildR}, syncItem{key: n.ChildL})
+				continue
+			}
+			item.n = n
+		}
+		if err := dst.Put(ctx, item.key[:], item.n); err != nil {
+			return p, err
+		}
+		p.Copied++
+		if progress != nil {
+			progress(p)
+		}
+	}
+	if srcName != "" && dstName == "" {
+		if err := storeHasherName(ctx, dst, srcName); err != nil {
+			return p, err
+		}
+	}
+	return p, dst.SetRoot(ctx, root)
+}
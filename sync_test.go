@@ -0,0 +1,131 @@
+package merkletree_test
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/iden3/go-merkletree-sql/v2"
+	"github.com/iden3/go-merkletree-sql/v2/db/memory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var errPutLimit = errors.New("put limit reached")
+
+// limitedStorage is a Storage that fails after a number of Puts.
+type limitedStorage struct {
+	merkletree.Storage
+	puts int
+}
+
+func (s *limitedStorage) Put(ctx context.Context, key []byte,
+	n *merkletree.Node) error {
+	if s.puts == 0 {
+		return errPutLimit
+	}
+	s.puts--
+	return s.Storage.Put(ctx, key, n)
+}
+
+func TestSyncStorage(t *testing.T) {
+	ctx := context.Background()
+	src := memory.NewMemoryStorage()
+	mt, err := merkletree.NewMerkleTree(ctx, src, 40)
+	require.NoError(t, err)
+	for i := 0; i < 32; i++ {
+		err = mt.Add(ctx, big.NewInt(int64(i)), big.NewInt(int64(i*2)))
+		require.NoError(t, err)
+	}
+
+	dst := memory.NewMemoryStorage()
+	var calls int
+	p, err := merkletree.SyncStorage(ctx, src, dst, mt.Root(),
+		func(merkletree.SyncProgress) { calls++ })
+	require.NoError(t, err)
+	assert.Equal(t, 0, p.Skipped)
+	assert.Equal(t, p.Copied, calls)
+
+	mtDst, err := merkletree.OpenReadOnly(ctx, dst, 40)
+	require.NoError(t, err)
+	assert.Equal(t, mt.Root(), mtDst.Root())
+	dump, err := mt.DumpLeafs(ctx, nil)
+	require.NoError(t, err)
+	dumpDst, err := mtDst.DumpLeafs(ctx, nil)
+	require.NoError(t, err)
+	assert.Equal(t, dump, dumpDst)
+
+	// only the nodes of the modified path are copied
+	_, err = mt.Update(ctx, big.NewInt(5), big.NewInt(55))
+	require.NoError(t, err)
+	p2, err := merkletree.SyncStorage(ctx, src, dst, mt.Root(), nil)
+	require.NoError(t, err)
+	assert.Less(t, p2.Copied, p.Copied/4)
+	assert.Greater(t, p2.Skipped, 0)
+	root, err := dst.GetRoot(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, mt.Root(), root)
+}
+
+func TestSyncStorageResume(t *testing.T) {
+	ctx := context.Background()
+	src := memory.NewMemoryStorage()
+	mt, err := merkletree.NewMerkleTree(ctx, src, 40)
+	require.NoError(t, err)
+	for i := 0; i < 32; i++ {
+		err = mt.Add(ctx, big.NewInt(int64(i)), big.NewInt(int64(i*2)))
+		require.NoError(t, err)
+	}
+
+	dst := memory.NewMemoryStorage()
+	_, err = merkletree.SyncStorage(ctx, src,
+		&limitedStorage{Storage: dst, puts: 20}, mt.Root(), nil)
+	require.ErrorIs(t, err, errPutLimit)
+	_, err = dst.GetRoot(ctx)
+	require.ErrorIs(t, err, merkletree.ErrNotFound)
+
+	p, err := merkletree.SyncStorage(ctx, src, dst, mt.Root(), nil)
+	require.NoError(t, err)
+	assert.Greater(t, p.Skipped, 0)
+
+	mtDst, err := merkletree.OpenReadOnly(ctx, dst, 40)
+	require.NoError(t, err)
+	dump, err := mt.DumpLeafs(ctx, nil)
+	require.NoError(t, err)
+	dumpDst, err := mtDst.DumpLeafs(ctx, nil)
+	require.NoError(t, err)
+	assert.Equal(t, dump, dumpDst)
+}
+
+func TestSyncStorageHasher(t *testing.T) {
+	ctx := context.Background()
+	src := memory.NewMemoryStorage()
+	mt, err := merkletree.NewMerkleTree(ctx, src, 40,
+		merkletree.WithHasher(merkletree.SHA256Hasher{}))
+	require.NoError(t, err)
+	for i := int64(0); i < 8; i++ {
+		require.NoError(t, mt.Add(ctx, big.NewInt(i), big.NewInt(i)))
+	}
+
+	// the hasher of src is stored in dst
+	dst := memory.NewMemoryStorage()
+	_, err = merkletree.SyncStorage(ctx, src, dst, mt.Root(), nil)
+	require.NoError(t, err)
+	mt2, err := merkletree.NewMerkleTree(ctx, dst, 40)
+	require.NoError(t, err)
+	assert.Equal(t, "sha256", mt2.Hasher().Name())
+	report, err := mt2.Check(ctx, nil)
+	require.NoError(t, err)
+	assert.True(t, report.OK())
+
+	// and a dst with another hasher is rejected
+	dst = memory.NewMemoryStorage()
+	_, err = merkletree.NewMerkleTree(ctx, dst, 40)
+	require.NoError(t, err)
+	_, err = merkletree.SyncStorage(ctx, src, dst, mt.Root(), nil)
+	assert.ErrorIs(t, err, merkletree.ErrHasherMismatch)
+	root, err := dst.GetRoot(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, &merkletree.HashZero, root)
+}
@@ -0,0 +1,169 @@
+package merkletree
+
+import (
+	"context"
+	"sync"
+)
+
+// WalkAction is the value returned by a WalkFunc to control the traversal of
+// the tree.
+type WalkAction int
+
+const (
+	// WalkContinue continues the traversal, visiting the children of the
+	// current node.
+	WalkContinue WalkAction = iota
+	// WalkSkipChildren continues the traversal without visiting the children
+	// of the current node.
+	WalkSkipChildren
+	// WalkStop stops the traversal. WalkNodes returns without error.
+	WalkStop
+)
+
+// WalkFunc is the function called by WalkNodes for each visited node. depth
+// is the level of the node, where the root is at depth 0, and path contains
+// the bits of the path from the root to the node (false for left, true for
+// right). path is only valid during the call and must not be modified. If
+// the function returns an error, the traversal stops and WalkNodes returns
+// that error.
+type WalkFunc func(n *Node, depth int, path []bool) (WalkAction, error)
+
+// WalkNodes iterates over the nodes of the MerkleTree with the given rootKey
+// in depth-first order, visiting the left child before the right one. If
+// rootKey is nil, the current Root of the MerkleTree is used. For each node,
+// it calls f, and continues according to the returned WalkAction. The
+// traversal stops with the error of the context if it's cancelled or its
+// deadline is exceeded. If the MerkleTree was loaded with WithWalkPrefetch,
+// the children of the visited nodes are fetched concurrently in advance. It
+// returns ErrReachedMaxLevel if the tree is deeper than the MaxLevels of the
+// MerkleTree, for example if it was loaded with fewer levels than it has.
+func (mt *MerkleTree) WalkNodes(ctx context.Context, rootKey *Hash,
+	f WalkFunc) error {
+	if rootKey == nil {
+		rootKey = mt.Root()
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	p := newNodePrefetcher(mt, mt.prefetch)
+	defer p.wait()
+	defer cancel()
+
+	stack := []walkItem{{key: rootKey}}
+	for len(stack) > 0 {
+		item := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if len(item.path) > mt.maxLevels {
+			return ErrReachedMaxLevel
+		}
+		n, err := item.node(ctx, mt)
+		if err != nil {
+			return err
+		}
+		if n.Type != NodeTypeEmpty && n.Type != NodeTypeLeaf &&
+			n.Type != NodeTypeMiddle {
+			return ErrInvalidNodeFound
+		}
+		action, err := f(n, len(item.path), item.path)
+		if err != nil {
+			return err
+		}
+		if action == WalkStop {
+			return nil
+		}
+		if action == WalkSkipChildren || n.Type != NodeTypeMiddle {
+			continue
+		}
+		// the right child is pushed first, so the left one is visited first
+		pathL := append(item.path[:len(item.path):len(item.path)], false)
+		pathR := append(item.path[:len(item.path):len(item.path)], true)
+		stack = append(stack,
+			walkItem{key: n.ChildR, path: pathR,
+				fetched: p.prefetch(ctx, n.ChildR)},
+			walkItem{key: n.ChildL, path: pathL,
+				fetched: p.prefetch(ctx, n.ChildL)})
+	}
+	return nil
+}
+
+// walkItem is a node pending to be visited by WalkNodes.
+type walkItem struct {
+	key  *Hash
+	path []bool
+	// fetched is the result of the prefetch of the node, if any
+	fetched *fetchedNode
+}
+
+// node returns the node of the walkItem, waiting for its prefetch or getting
+// it from the MerkleTree.
+func (item walkItem) node(ctx context.Context, mt *MerkleTree) (*Node, error) {
+	return item.fetched.node(ctx, mt, item.key)
+}
+
+// fetchedNode is the result of a node fetched in the background.
+type fetchedNode struct {
+	done chan struct{}
+	n    *Node
+	err  error
+}
+
+// node returns the fetched node, waiting for its fetch to finish. If fn is
+// nil, as the node wasn't prefetched, the node is got from the MerkleTree.
+func (fn *fetchedNode) node(ctx context.Context, mt *MerkleTree,
+	key *Hash) (*Node, error) {
+	if fn == nil {
+		return mt.GetNode(ctx, key)
+	}
+	select {
+	case <-fn.done:
+		return fn.n, fn.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// nodePrefetcher fetches nodes in the background, with up to a fixed number
+// of concurrent fetches.
+type nodePrefetcher struct {
+	mt  *MerkleTree
+	sem chan struct{}
+	wg  sync.WaitGroup
+}
+
+func newNodePrefetcher(mt *MerkleTree, workers int) *nodePrefetcher {
+	p := &nodePrefetcher{mt: mt}
+	if workers > 0 {
+		p.sem = make(chan struct{}, workers)
+	}
+	return p
+}
+
+// prefetch starts fetching the node with the given key in the background. It
+// returns nil, without blocking, if the node is empty or all the workers are
+// busy.
+func (p *nodePrefetcher) prefetch(ctx context.Context, key *Hash) *fetchedNode {
+	if p.sem == nil || key.Equals(&HashZero) {
+		return nil
+	}
+	select {
+	case p.sem <- struct{}{}:
+	default:
+		return nil
+	}
+	fn := &fetchedNode{done: make(chan struct{})}
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		fn.n, fn.err = p.mt.GetNode(ctx, key)
+		<-p.sem
+		close(fn.done)
+	}()
+	return fn
+}
+
+// wait waits for all the background fetches to finish.
+func (p *nodePrefetcher) wait() {
+	p.wg.Wait()
+}
@@ -0,0 +1,124 @@
+package merkletree_test
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/iden3/go-merkletree-sql/v2"
+	"github.com/iden3/go-merkletree-sql/v2/db/memory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWalkNodesPath(t *testing.T) {
+	ctx := context.Background()
+	mt := newTestTree(t, memory.NewMemoryStorage(), 10, 16)
+
+	leafs := 0
+	err := mt.WalkNodes(ctx, nil, func(n *merkletree.Node, depth int,
+		path []bool) (merkletree.WalkAction, error) {
+		require.Len(t, path, depth)
+		if n.Type == merkletree.NodeTypeLeaf {
+			leafs++
+			// the path is the prefix of the bits of the key
+			for i, bit := range path {
+				assert.Equal(t, merkletree.TestBit(n.Entry[0][:], uint(i)),
+					bit)
+			}
+		}
+		return merkletree.WalkContinue, nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 16, leafs)
+}
+
+func TestWalkNodesControl(t *testing.T) {
+	ctx := context.Background()
+	mt := newTestTree(t, memory.NewMemoryStorage(), 10, 16)
+
+	// skipping the right subtree of the root visits only the keys with the
+	// lowest bit unset
+	var keys []int64
+	err := mt.WalkNodes(ctx, nil, func(n *merkletree.Node, depth int,
+		path []bool) (merkletree.WalkAction, error) {
+		if depth == 1 && path[0] {
+			return merkletree.WalkSkipChildren, nil
+		}
+		if n.Type == merkletree.NodeTypeLeaf {
+			keys = append(keys, n.Entry[0].BigInt().Int64())
+		}
+		return merkletree.WalkContinue, nil
+	})
+	require.NoError(t, err)
+	require.Len(t, keys, 8)
+	for _, k := range keys {
+		assert.Zero(t, k%2)
+	}
+
+	visited := 0
+	err = mt.WalkNodes(ctx, nil, func(n *merkletree.Node, _ int,
+		_ []bool) (merkletree.WalkAction, error) {
+		visited++
+		if n.Type == merkletree.NodeTypeLeaf {
+			return merkletree.WalkStop, nil
+		}
+		return merkletree.WalkContinue, nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 5, visited)
+
+	errWalk := errors.New("walk error")
+	err = mt.WalkNodes(ctx, nil, func(n *merkletree.Node, _ int,
+		_ []bool) (merkletree.WalkAction, error) {
+		return merkletree.WalkContinue, errWalk
+	})
+	assert.ErrorIs(t, err, errWalk)
+}
+
+func TestWalkNodesPrefetch(t *testing.T) {
+	ctx := context.Background()
+	storage := memory.NewMemoryStorage()
+	mt, err := merkletree.NewMerkleTree(ctx, storage, 40)
+	require.NoError(t, err)
+	for i := 0; i < 64; i++ {
+		err = mt.Add(ctx, big.NewInt(int64(i)), big.NewInt(int64(i*2)))
+		require.NoError(t, err)
+	}
+	mtPrefetch, err := merkletree.NewMerkleTree(ctx, storage, 40,
+		merkletree.WithWalkPrefetch(4))
+	require.NoError(t, err)
+
+	dump, err := mt.DumpLeafs(ctx, nil)
+	require.NoError(t, err)
+	dumpPrefetch, err := mtPrefetch.DumpLeafs(ctx, nil)
+	require.NoError(t, err)
+	assert.Equal(t, dump, dumpPrefetch)
+}
+
+func TestWalkNodesContext(t *testing.T) {
+	mt := newTestTree(t, memory.NewMemoryStorage(), 10, 16)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := mt.WalkNodes(ctx, nil, func(n *merkletree.Node, _ int,
+		_ []bool) (merkletree.WalkAction, error) {
+		return merkletree.WalkContinue, nil
+	})
+	assert.ErrorIs(t, err, context.Canceled)
+
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	visited := 0
+	err = mt.WalkNodes(ctx, nil, func(n *merkletree.Node, _ int,
+		_ []bool) (merkletree.WalkAction, error) {
+		visited++
+		if visited == 3 {
+			cancel()
+		}
+		return merkletree.WalkContinue, nil
+	})
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, 3, visited)
+}
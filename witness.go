@@ -0,0 +1,251 @@
+package merkletree
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"sync"
+)
+
+var (
+	// ErrMissingWitnessNode is used when an operation over a
+	// PartialMerkleTree needs a node that is not part of the witness.
+	ErrMissingWitnessNode = errors.New("node is missing from the witness")
+	// ErrProofRootMismatch is used when a proof added to a PartialMerkleTree
+	// doesn't correspond to its root.
+	ErrProofRootMismatch = errors.New("proof doesn't match the root of the tree")
+)
+
+// RecordingStorage is a Storage that wraps another Storage and records every
+// node read from it. The recorded nodes are the witness needed to re-execute
+// the same operations with a PartialMerkleTree, without access to the
+// wrapped Storage.
+type RecordingStorage struct {
+	Storage
+	mu    sync.Mutex
+	nodes KvMap
+}
+
+// NewRecordingStorage returns a new RecordingStorage wrapping the given
+// Storage.
+func NewRecordingStorage(storage Storage) *RecordingStorage {
+	return &RecordingStorage{Storage: storage, nodes: make(KvMap)}
+}
+
+// Get retrieves a node from the wrapped Storage, and records it
+func (s *RecordingStorage) Get(ctx context.Context,
+	key []byte) (*Node, error) {
+	n, err := s.Storage.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	s.nodes.Put(key, *n)
+	s.mu.Unlock()
+	return n, nil
+}
+
+// Nodes returns the recorded nodes sorted by key.
+func (s *RecordingStorage) Nodes() []*Node {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	kvs := make([]KV, 0, len(s.nodes))
+	for _, kv := range s.nodes {
+		kvs = append(kvs, kv)
+	}
+	sort.Slice(kvs, func(i, j int) bool {
+		return bytes.Compare(kvs[i].K, kvs[j].K) < 0
+	})
+	nodes := make([]*Node, len(kvs))
+	for i := range kvs {
+		n := kvs[i].V
+		nodes[i] = &n
+	}
+	return nodes
+}
+
+// Reset discards the recorded nodes.
+func (s *RecordingStorage) Reset() {
+	s.mu.Lock()
+	s.nodes = make(KvMap)
+	s.mu.Unlock()
+}
+
+// witnessStorage is the in-memory Storage of a PartialMerkleTree. Reading a
+// node that is not in the witness returns ErrMissingWitnessNode.
+type witnessStorage struct {
+	kv   KvMap
+	root *Hash
+}
+
+func (s *witnessStorage) Get(_ context.Context, key []byte) (*Node, error) {
+	if n, ok := s.kv.Get(key); ok {
+		return &n, nil
+	}
+	return nil, fmt.Errorf("%w: %x", ErrMissingWitnessNode, key)
+}
+
+func (s *witnessStorage) Put(_ context.Context, key []byte, n *Node) error {
+	s.kv.Put(Clone(key), *n)
+	return nil
+}
+
+func (s *witnessStorage) GetRoot(_ context.Context) (*Hash, error) {
+	root := *s.root
+	return &root, nil
+}
+
+func (s *witnessStorage) SetRoot(_ context.Context, hash *Hash) error {
+	root := *hash
+	s.root = &root
+	return nil
+}
+
+// PartialMerkleTree is a MerkleTree that only contains the nodes of a witness,
+// recorded with a RecordingStorage or rebuilt from proofs. It allows to
+// re-execute the operations covered by the witness without access to the
+// original Storage. Any operation that needs a node missing from the witness
+// fails with ErrMissingWitnessNode.
+type PartialMerkleTree struct {
+	db *witnessStorage
+	mt *MerkleTree
+}
+
+// NewPartialMerkleTree returns a new PartialMerkleTree with the given root,
+// containing the given witness nodes. The underlying MerkleTree is configured
+// with the given Options.
+func NewPartialMerkleTree(ctx context.Context, rootKey *Hash, maxLevels int,
+	nodes []*Node, opts ...Option) (*PartialMerkleTree, error) {
+	db := &witnessStorage{kv: make(KvMap), root: &HashZero}
+	if err := db.SetRoot(ctx, rootKey); err != nil {
+		return nil, err
+	}
+	mt, err := NewMerkleTree(ctx, db, maxLevels, opts...)
+	if err != nil {
+		return nil, err
+	}
+	for _, n := range nodes {
+		k, err := n.KeyWithHasher(mt.hasher)
+		if err != nil {
+			return nil, err
+		}
+		if err := db.Put(ctx, k[:], n); err != nil {
+			return nil, err
+		}
+	}
+	return &PartialMerkleTree{db: db, mt: mt}, nil
+}
+
+// AddProof adds to the witness the nodes in the path of the given proof of
+// existence (or non-existence) of k with value v. The proof must correspond
+// to the current root of the PartialMerkleTree. Only the nodes in the path
+// are rebuilt, so operations that need to read a sibling node (for example,
+// a Delete next to a leaf) still need that node in the witness.
+func (pt *PartialMerkleTree) AddProof(ctx context.Context, proof *Proof,
+	k, v *big.Int) error {
+	if proof.depth > uint(pt.mt.maxLevels) {
+		return ErrReachedMaxLevel
+	}
+	if proof.hasher != nil && !sameHasher(proof.hasher, pt.mt.hasher) {
+		return ErrHasherMismatch
+	}
+	kHash, err := NewHashFromBigInt(k)
+	if err != nil {
+		return fmt.Errorf("can't create hash from Key: %w", err)
+	}
+	vHash, err := NewHashFromBigInt(v)
+	if err != nil {
+		return fmt.Errorf("can't create hash from Value: %w", err)
+	}
+
+	var nodes []*Node
+	midKey := &HashZero
+	if proof.Existence {
+		nodes = append(nodes, NewNodeLeaf(kHash, vHash))
+	} else if proof.NodeAux != nil {
+		nodes = append(nodes,
+			NewNodeLeaf(proof.NodeAux.Key, proof.NodeAux.Value))
+	}
+	if len(nodes) > 0 {
+		midKey, err = nodes[0].KeyWithHasher(pt.mt.hasher)
+		if err != nil {
+			return err
+		}
+	}
+	path := getPath(int(proof.depth), kHash[:])
+	siblings := proof.AllSiblings()
+	for lvl := int(proof.depth) - 1; lvl >= 0; lvl-- {
+		var n *Node
+		if path[lvl] {
+			n = NewNodeMiddle(siblings[lvl], midKey)
+		} else {
+			n = NewNodeMiddle(midKey, siblings[lvl])
+		}
+		midKey, err = n.KeyWithHasher(pt.mt.hasher)
+		if err != nil {
+			return err
+		}
+		nodes = append(nodes, n)
+	}
+	if !midKey.Equals(pt.mt.Root()) {
+		return ErrProofRootMismatch
+	}
+
+	for _, n := range nodes {
+		if n.Type == NodeTypeEmpty {
+			continue
+		}
+		key, err := n.KeyWithHasher(pt.mt.hasher)
+		if err != nil {
+			return err
+		}
+		if err := pt.db.Put(ctx, key[:], n); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Root returns the current root of the PartialMerkleTree
+func (pt *PartialMerkleTree) Root() *Hash {
+	return pt.mt.Root()
+}
+
+// MaxLevels returns the maximum level of the PartialMerkleTree
+func (pt *PartialMerkleTree) MaxLevels() int {
+	return pt.mt.MaxLevels()
+}
+
+// Get returns the value of the leaf for the given key. See MerkleTree.Get.
+func (pt *PartialMerkleTree) Get(ctx context.Context,
+	k *big.Int) (*big.Int, *big.Int, []*Hash, error) {
+	return pt.mt.Get(ctx, k)
+}
+
+// Add adds a Key & Value into the PartialMerkleTree. See MerkleTree.Add.
+func (pt *PartialMerkleTree) Add(ctx context.Context, k, v *big.Int) error {
+	return pt.mt.Add(ctx, k, v)
+}
+
+// Update updates the value of a specified key in the PartialMerkleTree. See
+// MerkleTree.Update.
+func (pt *PartialMerkleTree) Update(ctx context.Context,
+	k, v *big.Int) (*CircomProcessorProof, error) {
+	return pt.mt.Update(ctx, k, v)
+}
+
+// Delete removes the specified Key from the PartialMerkleTree. See
+// MerkleTree.Delete.
+func (pt *PartialMerkleTree) Delete(ctx context.Context, k *big.Int) error {
+	return pt.mt.Delete(ctx, k)
+}
+
+// GenerateProof generates the proof of existence (or non-existence) of a key
+// in the PartialMerkleTree. See MerkleTree.GenerateProof.
+func (pt *PartialMerkleTree) GenerateProof(ctx context.Context, k *big.Int,
+	rootKey *Hash) (*Proof, *big.Int, error) {
+	return pt.mt.GenerateProof(ctx, k, rootKey)
+}
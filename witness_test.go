@@ -0,0 +1,91 @@
+package merkletree_test
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/iden3/go-merkletree-sql/v2"
+	"github.com/iden3/go-merkletree-sql/v2/db/memory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPartialMerkleTreeReplay(t *testing.T) {
+	ctx := context.Background()
+	rec := merkletree.NewRecordingStorage(memory.NewMemoryStorage())
+	mt, err := merkletree.NewMerkleTree(ctx, rec, 40)
+	require.NoError(t, err)
+	for i := 0; i < 32; i++ {
+		err = mt.Add(ctx, big.NewInt(int64(i)), big.NewInt(int64(i*2)))
+		require.NoError(t, err)
+	}
+
+	rec.Reset()
+	oldRoot := mt.Root()
+	require.NoError(t, mt.Add(ctx, big.NewInt(100), big.NewInt(1)))
+	_, err = mt.Update(ctx, big.NewInt(7), big.NewInt(70))
+	require.NoError(t, err)
+	require.NoError(t, mt.Delete(ctx, big.NewInt(12)))
+	proof, _, err := mt.GenerateProof(ctx, big.NewInt(3), nil)
+	require.NoError(t, err)
+
+	pt, err := merkletree.NewPartialMerkleTree(ctx, oldRoot, 40, rec.Nodes())
+	require.NoError(t, err)
+	require.NoError(t, pt.Add(ctx, big.NewInt(100), big.NewInt(1)))
+	_, err = pt.Update(ctx, big.NewInt(7), big.NewInt(70))
+	require.NoError(t, err)
+	require.NoError(t, pt.Delete(ctx, big.NewInt(12)))
+	assert.Equal(t, mt.Root(), pt.Root())
+
+	proof2, v, err := pt.GenerateProof(ctx, big.NewInt(3), nil)
+	require.NoError(t, err)
+	assert.Equal(t, big.NewInt(6), v)
+	assert.Equal(t, proof.AllSiblings(), proof2.AllSiblings())
+
+	// key 20 was not touched by the recorded operations
+	_, _, _, err = pt.Get(ctx, big.NewInt(20))
+	assert.ErrorIs(t, err, merkletree.ErrMissingWitnessNode)
+}
+
+func TestPartialMerkleTreeFromProofs(t *testing.T) {
+	ctx := context.Background()
+	mt, err := merkletree.NewMerkleTree(ctx, memory.NewMemoryStorage(), 40)
+	require.NoError(t, err)
+	for i := 0; i < 16; i++ {
+		err = mt.Add(ctx, big.NewInt(int64(i)), big.NewInt(int64(i*2)))
+		require.NoError(t, err)
+	}
+
+	pt, err := merkletree.NewPartialMerkleTree(ctx, mt.Root(), 40, nil)
+	require.NoError(t, err)
+	proof, v, err := mt.GenerateProof(ctx, big.NewInt(5), nil)
+	require.NoError(t, err)
+	require.NoError(t, pt.AddProof(ctx, proof, big.NewInt(5), v))
+	// non-existence proof of 21 ends at the leaf of key 5
+	proof, v, err = mt.GenerateProof(ctx, big.NewInt(21), nil)
+	require.NoError(t, err)
+	require.NoError(t, pt.AddProof(ctx, proof, big.NewInt(21), v))
+
+	proof, _, err = mt.GenerateProof(ctx, big.NewInt(6), nil)
+	require.NoError(t, err)
+	err = pt.AddProof(ctx, proof, big.NewInt(6), big.NewInt(1))
+	assert.ErrorIs(t, err, merkletree.ErrProofRootMismatch)
+
+	_, gotV, _, err := pt.Get(ctx, big.NewInt(5))
+	require.NoError(t, err)
+	assert.Equal(t, big.NewInt(10), gotV)
+
+	_, err = mt.Update(ctx, big.NewInt(5), big.NewInt(55))
+	require.NoError(t, err)
+	_, err = pt.Update(ctx, big.NewInt(5), big.NewInt(55))
+	require.NoError(t, err)
+	assert.Equal(t, mt.Root(), pt.Root())
+
+	require.NoError(t, mt.Add(ctx, big.NewInt(21), big.NewInt(1)))
+	require.NoError(t, pt.Add(ctx, big.NewInt(21), big.NewInt(1)))
+	assert.Equal(t, mt.Root(), pt.Root())
+
+	err = pt.Add(ctx, big.NewInt(6), big.NewInt(1))
+	assert.ErrorIs(t, err, merkletree.ErrMissingWitnessNode)
+}